@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes one process started by an InputManager
+//
+// Fields:
+//
+//	Time: When the process was started
+//	Key: Key of the request
+//	CorrelationID: See WithCorrelationID()
+//	Language: Target language as passed to Request()
+//	File: Target file as passed to Request()
+//	Command: Resolved path of the executable
+//	Args: Arguments of the executable
+//	Dir: Working directory of the process
+//	User: User the process ran as
+//	Duration: Time from start to exit
+//	ExitCode: Exit code of the process (-1 if killed or never started)
+//	Request: Request sent to the process ("" when redacted)
+//	Error: Why the process failed to start or stopped early
+type AuditRecord struct {
+	Time          time.Time     `json:"time"`
+	Key           string        `json:"key"`
+	CorrelationID string        `json:"correlation_id,omitempty"`
+	Language      string        `json:"language"`
+	File          string        `json:"file"`
+	Command       string        `json:"command"`
+	Args          []string      `json:"args"`
+	Dir           string        `json:"cwd"`
+	User          string        `json:"user"`
+	Duration      time.Duration `json:"duration_ns"`
+	ExitCode      int           `json:"exit_code"`
+	Request       string        `json:"request,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// AuditFunc receives an AuditRecord once the process it describes ended
+type AuditFunc func(record AuditRecord)
+
+// Audit hook of InputManagers without their own
+var (
+	auditMu      sync.RWMutex
+	defaultAudit AuditFunc
+)
+
+// SetAudit records the processes started by every InputManager
+//
+// Parameters:
+//
+//	audit: Hook called for each process (see AuditLog()), nil removes it
+func SetAudit(audit AuditFunc) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	defaultAudit = audit
+}
+
+// WithAudit records the processes started by an InputManager, replacing the hook of SetAudit()
+//
+// Parameters:
+//
+//	audit: Hook called for each process (see AuditLog())
+func WithAudit(audit AuditFunc) Option {
+	return func(im *InputManager) {
+		im.audit = audit
+	}
+}
+
+// AuditLog writes AuditRecords to w as JSON lines
+//
+// Safe for concurrent use, one line is written per process.
+//
+// Parameters:
+//
+//	w: Destination of the log (file, syslog writer, ...)
+//	redact: Leave the request payload out of the log
+//
+// Returns:
+//
+//	AuditFunc: Hook for SetAudit() or WithAudit()
+func AuditLog(w io.Writer, redact bool) AuditFunc {
+	var mu sync.Mutex
+	return func(record AuditRecord) {
+		if redact {
+			record.Request = ""
+		}
+		line, _ := json.Marshal(record)
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(append(line, '\n'))
+	}
+}
+
+// Get the audit hook of the InputManager, nil when none
+func (im *InputManager) activeAudit() AuditFunc {
+	if im.audit != nil {
+		return im.audit
+	}
+	auditMu.RLock()
+	defer auditMu.RUnlock()
+	return defaultAudit
+}
+
+// Process started by the transport and its resolved executable, for
+// transports running one (cmd.Path may be the helper of IsolateFiles)
+func (t *ProcessTransport) process() (*exec.Cmd, string) {
+	return t.cmd, t.path
+}
+
+// Record the process started by transport, once it ended
+func (im *InputManager) recordAudit(audit AuditFunc, transport Transport, language, file string, start time.Time, err error) {
+	spawner, ok := transport.(interface{ process() (*exec.Cmd, string) })
+	if !ok {
+		return
+	}
+	cmd, path := spawner.process()
+	if cmd == nil {
+		return
+	}
+	record := AuditRecord{
+		Time:          start,
+		Key:           im.key,
+		CorrelationID: im.info.CorrelationID,
+		Language:      language,
+		File:          file,
+		Command:       path,
+		Args:          append([]string{}, cmd.Args[1:]...),
+		Dir:           cmd.Dir,
+		User:          im.user,
+		Duration:      time.Since(start),
+		ExitCode:      -1,
+		Request:       im.request,
+	}
+	if record.Dir == "" {
+		record.Dir, _ = os.Getwd()
+	}
+	if record.User == "" {
+		if current, userErr := user.Current(); userErr == nil {
+			record.User = current.Username
+		}
+	}
+	if cmd.ProcessState != nil {
+		record.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	audit(record)
+}
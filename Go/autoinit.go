@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// AutoInitEnv is set to "1" by ProcessTransport in the environment of the
+// targets it starts
+//
+// Targets started that way are initialized on the first call to a
+// package-level function (GetData(), Output(), ...) when Init() wasn't
+// called.
+const AutoInitEnv = "MANGLE_AUTODETECT"
+
+var (
+	autoInitMu sync.Mutex
+	autoInit   = os.Getenv(AutoInitEnv) == "1"
+)
+
+// SetAutoInit enables or disables the lazy Init() of the package-level functions
+//
+// Enabled by default when AutoInitEnv is set, e.g. for targets reached
+// through another transport than ProcessTransport.
+func SetAutoInit(enabled bool) {
+	autoInitMu.Lock()
+	defer autoInitMu.Unlock()
+	autoInit = enabled
+}
+
+// Get the OutputManager created by Init(), calling it first when auto-init is enabled
+func autoOutputManager() *OutputManager {
+	autoInitMu.Lock()
+	defer autoInitMu.Unlock()
+	if globalOutputManager == nil && autoInit {
+		Init()
+	}
+	return globalOutputManager
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// CodecBinary marks data holding raw bytes (images, model weights, ...)
+//
+// The bytes travel base64-encoded in the envelope, but callers only ever
+// see []byte on both sides.
+const CodecBinary = "binary"
+
+func init() {
+	RegisterCodec(bytesCodec{name: CodecBinary})
+}
+
+// SendBytes sends a request whose data is raw bytes
+//
+// Parameters:
+//
+//	isUnique: Expect single output (true) or multiple (false)
+//	optionalOutput: Output is optional (true) or required (false)
+//	data: Bytes to send
+//	language: Target language/runtime
+//	file: Path to target file
+func (im *InputManager) SendBytes(isUnique, optionalOutput bool, data []byte, language, file string) {
+	im.exchange(isUnique, optionalOutput, map[string]interface{}{
+		"data":     base64.StdEncoding.EncodeToString(data),
+		"encoding": CodecBinary,
+	}, language, file)
+}
+
+// GetBytes returns the bytes sent by the target with OutputBytes()
+//
+// With isUnique=false, Data is a JSON list: unmarshal it into [][]byte instead.
+//
+// Returns:
+//
+//	[]byte: Response bytes, nil if the request failed or the data isn't bytes
+func (im *InputManager) GetBytes() []byte {
+	var data []byte
+	if json.Unmarshal([]byte(im.GetData()), &data) != nil {
+		return nil
+	}
+	return data
+}
+
+// GetBytes returns the request data sent with InputManager.SendBytes()
+//
+// Returns:
+//
+//	[]byte: Request bytes, nil if the data isn't bytes
+func (om *OutputManager) GetBytes() []byte {
+	if om == nil {
+		return nil
+	}
+	var data []byte
+	if json.Unmarshal([]byte(om.data), &data) != nil {
+		return nil
+	}
+	return data
+}
+
+// OutputBytes sends raw bytes back to the calling process
+//
+// Parameters:
+//
+//	data: Bytes to send
+func (om *OutputManager) OutputBytes(data []byte) {
+	om.writeOutput(data, CodecBinary, nil)
+}
+
+// GetBytes calls GetBytes() on the OutputManager created by Init()
+func GetBytes() []byte {
+	return autoOutputManager().GetBytes()
+}
+
+// OutputBytes calls OutputBytes() on the OutputManager created by Init()
+func OutputBytes(data []byte) {
+	autoOutputManager().OutputBytes(data)
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Broker is the minimal publish/subscribe API used by BrokerTransport and
+// ServeBroker
+//
+// Adapt your message-queue client (NATS, Redis, ...) to it, e.g. for NATS:
+//
+//	Publish:        nc.Publish(subject, data)
+//	Subscribe:      sub, err := nc.Subscribe(subject, func(m *nats.Msg) { handler(m.Data) })
+//	                return sub.Unsubscribe, err
+//	QueueSubscribe: sub, err := nc.QueueSubscribe(subject, queue, func(m *nats.Msg) { handler(m.Data) })
+//	                return sub.Unsubscribe, err
+//
+// QueueSubscribe must deliver each message to one subscriber of the queue
+// group only, it is how the workers of a subject share its requests.
+type Broker interface {
+	Publish(subject string, data []byte) error
+	Subscribe(subject string, handler func(data []byte)) (unsubscribe func() error, err error)
+	QueueSubscribe(subject, queue string, handler func(data []byte)) (unsubscribe func() error, err error)
+}
+
+// Handler processes the data of one request and returns the data to output
+//
+// Both the request data and the returned data are JSON strings (see Bundle()).
+// Returning an error sends a request_status=false response instead.
+type Handler func(data string) (string, error)
+
+// BrokerTransport publishes requests to a broker subject and exchanges the
+// rest of each conversation with the worker that took it
+//
+// The transport subscribes once to its own reply subject. The first message
+// of a conversation goes to Subject with that reply subject, the worker
+// taking it answers with the subject of the conversation, and the later
+// messages (chunks, files, callback replies) go there instead of Subject.
+// Messages travel as they are sent, so signatures stay valid.
+//
+// Fields:
+//
+//	Broker: Publish/subscribe client
+//	Subject: Subject the workers subscribe to (see ServeBroker())
+//	Timeout: Maximum wait for each response message (0 = no limit)
+type BrokerTransport struct {
+	Broker      Broker
+	Subject     string
+	Timeout     time.Duration
+	messages    chan []byte
+	unsubscribe func() error
+	replyTo     string
+	mu          sync.Mutex
+	started     bool
+	worker      string
+	pending     [][]byte
+}
+
+// Message of a conversation on the broker, around the protocol message
+//
+// Fields:
+//
+//	ReplyTo: Reply subject of the requester, on the first message
+//	Worker: Subject of the conversation on the worker that took it
+//	Message: Protocol message, unchanged (nil for the worker announcement)
+type brokerEnvelope struct {
+	ReplyTo string `json:"reply_to,omitempty"`
+	Worker  string `json:"worker,omitempty"`
+	Message []byte `json:"message,omitempty"`
+}
+
+// NewBrokerTransport creates a new BrokerTransport instance
+//
+// Parameters:
+//
+//	broker: Publish/subscribe client
+//	subject: Subject the workers subscribe to
+func NewBrokerTransport(broker Broker, subject string) *BrokerTransport {
+	return &BrokerTransport{Broker: broker, Subject: subject, Timeout: 30 * time.Second}
+}
+
+// Open subscribes to the reply subject of the transport
+func (t *BrokerTransport) Open(target Target) error {
+	if t.Broker == nil || t.Subject == "" {
+		return errors.New("Failed to connect: broker and subject are required")
+	}
+	t.Close()
+	t.mu.Lock()
+	t.started, t.worker, t.pending = false, "", nil
+	t.mu.Unlock()
+	t.messages = make(chan []byte, 64)
+	t.replyTo = t.Subject + ".reply." + genKey()
+
+	messages := t.messages
+	unsubscribe, err := t.Broker.Subscribe(t.replyTo, func(data []byte) {
+		// Zero-length message: end of the conversation
+		if len(data) == 0 {
+			messages <- nil
+			return
+		}
+		var envelope brokerEnvelope
+		if json.Unmarshal(data, &envelope) != nil {
+			return
+		}
+		if envelope.Worker != "" {
+			t.claim(envelope.Worker)
+		}
+		if envelope.Message != nil {
+			messages <- envelope.Message
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to connect: %s", err.Error())
+	}
+	t.unsubscribe = unsubscribe
+	return nil
+}
+
+// Send publishes a message of the conversation
+//
+// The first message goes to Subject, the next ones to the worker that took
+// it, they wait for its announcement if needed.
+func (t *BrokerTransport) Send(message []byte) error {
+	t.mu.Lock()
+	if !t.started {
+		t.started = true
+		t.mu.Unlock()
+		envelope, _ := json.Marshal(brokerEnvelope{ReplyTo: t.replyTo, Message: message})
+		return t.Broker.Publish(t.Subject, envelope)
+	}
+	if t.worker == "" {
+		t.pending = append(t.pending, append([]byte{}, message...))
+		t.mu.Unlock()
+		return nil
+	}
+	worker := t.worker
+	t.mu.Unlock()
+	return t.Broker.Publish(worker, message)
+}
+
+// Record the worker of the conversation and send it the waiting messages
+func (t *BrokerTransport) claim(worker string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.worker != "" {
+		return
+	}
+	t.worker = worker
+	for _, message := range t.pending {
+		t.Broker.Publish(worker, message)
+	}
+	t.pending = nil
+}
+
+// Receive waits for the next response message
+//
+// A zero-length message marks the end of the responses.
+func (t *BrokerTransport) Receive() ([]byte, error) {
+	var timeout <-chan time.Time
+	if t.Timeout > 0 {
+		timer := time.NewTimer(t.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case message := <-t.messages:
+		if len(message) == 0 {
+			return nil, io.EOF
+		}
+		return message, nil
+	case <-timeout:
+		return nil, fmt.Errorf("Timed out waiting for a response on %s", t.Subject)
+	}
+}
+
+// Close unsubscribes from the reply subject
+func (t *BrokerTransport) Close() error {
+	if t.unsubscribe == nil {
+		return nil
+	}
+	unsubscribe := t.unsubscribe
+	t.unsubscribe = nil
+	return unsubscribe()
+}
+
+// ServeBroker subscribes a worker to a broker subject
+//
+// The workers of a subject form one queue group named after it, so each
+// conversation started by a BrokerTransport is taken by one worker, which
+// announces a subject of its own for the rest of the conversation (chunks
+// of large requests). The request is passed to handler and the result is
+// published on the reply subject of the requester.
+//
+// Like the OutputManager, the worker signs and verifies messages with the
+// key of SetSigningKey() or SigningKeyEnv, and decrypts and encrypts data
+// with the key of SetEncryptionKey() or EncryptionKeyEnv. Messages with an
+// invalid signature are dropped.
+//
+// Parameters:
+//
+//	broker: Publish/subscribe client
+//	subject: Subject to serve
+//	handler: Function computing the output of a request
+//
+// Returns:
+//
+//	func() error: Stops serving
+//	error: Subscription error
+func ServeBroker(broker Broker, subject string, handler Handler) (func() error, error) {
+	signKey, encKey := outputSigningKey(), outputEncryptionKey()
+	return broker.QueueSubscribe(subject, subject, func(data []byte) {
+		var envelope brokerEnvelope
+		if json.Unmarshal(data, &envelope) != nil || envelope.ReplyTo == "" || envelope.Message == nil {
+			return
+		}
+		// Forged requests don't start a conversation
+		if _, err := verifyMessage(signKey, envelope.Message); err != nil {
+			return
+		}
+		c := &brokerConversation{
+			broker:  broker,
+			subject: subject + ".conversation." + genKey(),
+			replyTo: envelope.ReplyTo,
+			handler: handler,
+			signKey: signKey,
+			encKey:  encKey,
+			chunks:  newChunkAssembler(),
+		}
+		unsubscribe, err := broker.Subscribe(c.subject, c.add)
+		if err != nil {
+			return
+		}
+		c.mu.Lock()
+		c.unsubscribe = unsubscribe
+		c.mu.Unlock()
+		announcement, _ := json.Marshal(brokerEnvelope{Worker: c.subject})
+		broker.Publish(c.replyTo, announcement)
+		c.add(envelope.Message)
+	})
+}
+
+// Conversation taken by a ServeBroker worker
+type brokerConversation struct {
+	broker      Broker
+	subject     string
+	replyTo     string
+	handler     Handler
+	signKey     []byte
+	encKey      []byte
+	mu          sync.Mutex
+	chunks      *chunkAssembler
+	unsubscribe func() error
+	done        bool
+}
+
+// Handle a message of the conversation, the request once it is whole
+//
+// Files and callback replies aren't used by handlers, they are dropped.
+func (c *brokerConversation) add(message []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return
+	}
+	message, err := verifyMessage(c.signKey, message)
+	if err != nil {
+		return
+	}
+	var request map[string]interface{}
+	if err := unmarshalNumbers(message, &request); err != nil {
+		return
+	}
+	if messageChannel(request) == ChannelChunk {
+		whole, err := c.chunks.add(request)
+		if err != nil {
+			c.reply(request["key"], nil, "", err)
+			return
+		}
+		if whole == nil {
+			return
+		}
+		request = nil
+		if err := unmarshalNumbers(whole, &request); err != nil {
+			c.reply(nil, nil, "", err)
+			return
+		}
+	}
+	if messageChannel(request) != ChannelData {
+		return
+	}
+	if err := decryptMessageData(request, c.encKey); err != nil {
+		c.reply(request["key"], request, "", err)
+		return
+	}
+	if err := decodeMessageData(request, 0); err != nil {
+		c.reply(request["key"], request, "", err)
+		return
+	}
+
+	dataBytes, _ := json.Marshal(request["data"])
+	output, err := c.handler(string(dataBytes))
+	c.reply(request["key"], request, output, err)
+}
+
+// Publish the response of the request and end the conversation
+func (c *brokerConversation) reply(key interface{}, request map[string]interface{}, output string, err error) {
+	c.done = true
+	response := map[string]interface{}{
+		"key":            key,
+		"request_status": err == nil,
+		"data":           nil,
+		"optionalOutput": request["optionalOutput"],
+		"isUnique":       request["isUnique"],
+		"errors":         []string{},
+		"warnings":       []string{},
+	}
+	if err != nil {
+		response["errors"] = []string{fmt.Sprintf("Error: %s", err.Error())}
+	} else if output != "" {
+		var parsed interface{}
+		unmarshalNumbers([]byte(output), &parsed)
+		response["data"] = parsed
+	}
+
+	if encErr := encryptMessageData(response, c.encKey); encErr != nil {
+		response["request_status"] = false
+		response["data"] = nil
+		response["errors"] = []string{fmt.Sprintf("Error: %s", encErr.Error())}
+	}
+	responseBytes, _ := json.Marshal(response)
+	envelope, _ := json.Marshal(brokerEnvelope{Worker: c.subject, Message: signMessage(c.signKey, responseBytes)})
+	c.broker.Publish(c.replyTo, envelope)
+	// Empty message: end of the responses for this request
+	c.broker.Publish(c.replyTo, []byte{})
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+	}
+}
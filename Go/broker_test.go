@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// In-memory Broker, each subscription gets the messages of its subject in order
+type memoryBroker struct {
+	mu            sync.Mutex
+	subscriptions map[string]map[int]*memorySubscription
+	next          int
+	published     map[string]int
+}
+
+// Subscription of a memoryBroker, queue is empty for plain subscriptions
+type memorySubscription struct {
+	queue    string
+	messages chan []byte
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{subscriptions: map[string]map[int]*memorySubscription{}, published: map[string]int{}}
+}
+
+func (b *memoryBroker) Publish(subject string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published[subject]++
+	// One member of each queue group gets the message
+	delivered := map[string]bool{}
+	for _, subscription := range b.subscriptions[subject] {
+		if subscription.queue != "" {
+			if delivered[subscription.queue] {
+				continue
+			}
+			delivered[subscription.queue] = true
+		}
+		subscription.messages <- append([]byte{}, data...)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Subscribe(subject string, handler func(data []byte)) (func() error, error) {
+	return b.QueueSubscribe(subject, "", handler)
+}
+
+func (b *memoryBroker) QueueSubscribe(subject, queue string, handler func(data []byte)) (func() error, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscriptions[subject] == nil {
+		b.subscriptions[subject] = map[int]*memorySubscription{}
+	}
+	b.next++
+	id := b.next
+	subscription := &memorySubscription{queue: queue, messages: make(chan []byte, 1024)}
+	b.subscriptions[subject][id] = subscription
+	go func() {
+		for data := range subscription.messages {
+			handler(data)
+		}
+	}()
+	return func() error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscriptions[subject][id]; ok {
+			close(subscription.messages)
+			delete(b.subscriptions[subject], id)
+		}
+		return nil
+	}, nil
+}
+
+// Number of live subscriptions, by subject prefix
+func (b *memoryBroker) subscribed(prefix string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := 0
+	for subject, handlers := range b.subscriptions {
+		if strings.HasPrefix(subject, prefix) {
+			count += len(handlers)
+		}
+	}
+	return count
+}
+
+func TestBrokerRequest(t *testing.T) {
+	broker := newMemoryBroker()
+	stop, err := ServeBroker(broker, "jobs", func(data string) (string, error) {
+		return data, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	im := NewInputManager(WithTransport(NewBrokerTransport(broker, "jobs")))
+	im.Request(true, false, `{"x":[1,"a",null]}`, "", "")
+	if !im.Response.RequestStatus || im.Response.Data != `{"x":[1,"a",null]}` {
+		t.Errorf("expected the request echoed, got %+v", im.Response)
+	}
+}
+
+func TestBrokerHandlerError(t *testing.T) {
+	broker := newMemoryBroker()
+	stop, _ := ServeBroker(broker, "jobs", func(data string) (string, error) {
+		return "", errors.New("no model loaded")
+	})
+	defer stop()
+
+	im := NewInputManager(WithTransport(NewBrokerTransport(broker, "jobs")))
+	im.Request(true, false, `1`, "", "")
+	if im.Response.RequestStatus || len(im.Response.Errors) != 1 || !strings.Contains(im.Response.Errors[0], "no model loaded") {
+		t.Errorf("expected the handler error, got %+v", im.Response)
+	}
+}
+
+func TestBrokerChunkedRequest(t *testing.T) {
+	broker := newMemoryBroker()
+	stop, err := ServeBroker(broker, "jobs", func(data string) (string, error) {
+		return data, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	transport := NewBrokerTransport(broker, "jobs")
+	im := NewInputManager(WithTransport(transport), WithChunking(64))
+	data := `"` + strings.Repeat("x", 1000) + `"`
+	im.Request(true, false, data, "", "")
+
+	if !im.Response.RequestStatus || im.Response.Data != data {
+		t.Fatalf("expected the request echoed, got %+v", im.Response)
+	}
+	if n := broker.published["jobs"]; n != 1 {
+		t.Errorf("expected 1 message on the worker subject, got %d", n)
+	}
+	if n := broker.subscribed("jobs.reply."); n != 0 {
+		t.Errorf("%d reply subscriptions left after the request", n)
+	}
+	if n := broker.subscribed("jobs.conversation."); n != 0 {
+		t.Errorf("%d conversation subscriptions left after the request", n)
+	}
+}
+
+func TestBrokerSignedRequest(t *testing.T) {
+	broker := newMemoryBroker()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	var received []byte
+	stop, _ := broker.Subscribe("jobs", func(data []byte) {
+		var envelope brokerEnvelope
+		if jsonErr := unmarshalNumbers(data, &envelope); jsonErr == nil {
+			received = envelope.Message
+		}
+		broker.Publish(envelope.ReplyTo, []byte{})
+	})
+	defer stop()
+
+	im := NewInputManager(WithTransport(NewBrokerTransport(broker, "jobs")), WithSigningKey(key))
+	im.Request(true, true, `{"a": 1}`, "", "")
+	if _, err := verifyMessage(key, received); err != nil {
+		t.Errorf("the request reached the worker with an invalid signature: %s", received)
+	}
+}
+
+func TestBrokerOneWorkerPerRequest(t *testing.T) {
+	broker := newMemoryBroker()
+	var mu sync.Mutex
+	calls := 0
+	for i := 0; i < 3; i++ {
+		stop, err := ServeBroker(broker, "jobs", func(data string) (string, error) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			return data, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stop()
+	}
+
+	im := NewInputManager(WithTransport(NewBrokerTransport(broker, "jobs")))
+	im.Request(true, true, `2`, "", "")
+	if !im.Response.RequestStatus || im.Response.Data != `2` {
+		t.Fatalf("expected the request echoed, got %+v", im.Response)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("expected one worker to handle the request, %d did", calls)
+	}
+}
+
+func TestBrokerWorkerKeys(t *testing.T) {
+	signKey := []byte("0123456789abcdef0123456789abcdef")
+	encKey := []byte("fedcba9876543210fedcba9876543210")
+	broker := newMemoryBroker()
+	// The worker takes the keys when it starts serving
+	SetSigningKey(signKey)
+	SetEncryptionKey(encKey)
+	stop, err := ServeBroker(broker, "jobs", func(data string) (string, error) {
+		return data, nil
+	})
+	SetSigningKey(nil)
+	SetEncryptionKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	im := NewInputManager(WithTransport(NewBrokerTransport(broker, "jobs")), WithSigningKey(signKey), WithEncryptionKey(encKey))
+	im.Request(true, true, `{"secret":[1,2]}`, "", "")
+	if !im.Response.RequestStatus || im.Response.Data != `{"secret":[1,2]}` {
+		t.Fatalf("expected the request echoed, got %+v", im.Response)
+	}
+
+	// Messages signed with another key are dropped by the worker
+	other := NewInputManager(WithTransport(&BrokerTransport{Broker: broker, Subject: "jobs", Timeout: 200 * time.Millisecond}), WithSigningKey([]byte("another key, 32 bytes long......")))
+	other.Request(true, true, `1`, "", "")
+	if other.Response.RequestStatus {
+		t.Errorf("a request with an invalid signature was answered: %+v", other.Response)
+	}
+}
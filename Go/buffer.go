@@ -0,0 +1,62 @@
+package main
+
+import "bytes"
+
+// BufferOutput holds the outputs back until Flush() or Cleanup()
+//
+// Outputs are then written in one piece, and a failure (OutputError(),
+// ValidateData(), ...) drops the outputs held back so the calling process
+// never gets a partial response. Side-channel messages (progress, logs,
+// warnings, ...) are still sent right away.
+func (om *OutputManager) BufferOutput() {
+	if om != nil {
+		om.buffered = true
+	}
+}
+
+// Write an output response, held back in buffered mode
+func (om *OutputManager) writeResponse(message []byte) {
+	if om.buffered {
+		om.pending = append(om.pending, message)
+		return
+	}
+	om.writeMessage(message)
+}
+
+// Flush writes the outputs held back by BufferOutput()
+//
+// Returns:
+//
+//	error: Write error
+func (om *OutputManager) Flush() error {
+	if om == nil || len(om.pending) == 0 {
+		return nil
+	}
+	om.writeMu.Lock()
+	defer om.writeMu.Unlock()
+	var buf bytes.Buffer
+	for _, message := range om.pending {
+		om.writeChunked(&buf, message)
+	}
+	om.pending = nil
+
+	om.restoreStdout()
+	defer om.suppressStdout()
+	_, err := om.out.Write(buf.Bytes())
+	return err
+}
+
+// Drop the outputs held back by BufferOutput()
+func (om *OutputManager) discardPending() {
+	om.pending = nil
+}
+
+// BufferOutput calls BufferOutput() on the OutputManager created by Init()
+func BufferOutput() {
+	autoOutputManager().BufferOutput()
+}
+
+// Flush calls Flush() on the OutputManager created by Init()
+func Flush() error {
+	return globalOutputManager.Flush()
+}
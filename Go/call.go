@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Call sends req to a target and decodes its single output into Resp
+//
+// Shortcut for Bundle(), Request(), GetData() and json.Unmarshal() with
+// type checking on both ends, e.g.:
+//
+//	sum, err := Call[Operands, Result](Target{Language: "python", File: "add.py"}, Operands{1, 2})
+//
+// Parameters:
+//
+//	target: Language and File of the target (Command is ignored)
+//	req: Request data, any JSON-serializable value
+//	opts: InputManager options (WithTransport, WithCodec, ...)
+//
+// Returns:
+//
+//	Resp: Decoded output, zero value on error
+//	error: Request errors (joined) or decoding error
+func Call[Req, Resp any](target Target, req Req, opts ...Option) (Resp, error) {
+	var resp Resp
+
+	im := NewInputManager(opts...)
+	reqBytes, err := im.marshal(req)
+	if err != nil {
+		return resp, fmt.Errorf("Invalid request data: %s", err.Error())
+	}
+
+	im.Request(true, false, string(reqBytes), target.Language, target.File)
+
+	if err := im.Err(); err != nil {
+		return resp, err
+	}
+	if !im.Response.RequestStatus {
+		if len(im.Response.Errors) == 0 {
+			return resp, errors.New("Request failed")
+		}
+		return resp, errors.New(strings.Join(im.Response.Errors, "; "))
+	}
+	if err := im.unmarshal([]byte(im.GetData()), &resp); err != nil {
+		return resp, fmt.Errorf("Invalid response data: %s", err.Error())
+	}
+	return resp, nil
+}
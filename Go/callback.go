@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// WithCallback lets the target call back the calling process mid-task
+//
+// The target calls CallParent(method, data) and waits for the result
+// of handler (e.g. "give me the next batch", "ask the user"). The target
+// stdin stays open until it exits, so WithCallback can't be combined with
+// WithStdin().
+//
+// Parameters:
+//
+//	method: Callback name
+//	handler: Function receiving the callback data and returning its result (JSON strings)
+func WithCallback(method string, handler Handler) Option {
+	return func(im *InputManager) {
+		if im.callbacks == nil {
+			im.callbacks = make(map[string]Handler)
+		}
+		im.callbacks[method] = handler
+	}
+}
+
+// Answer a callback of the target
+func (im *InputManager) answerCallback(transport Transport, message map[string]interface{}) {
+	method, _ := message["method"].(string)
+	reply := map[string]interface{}{
+		"key":     im.key,
+		"channel": ChannelReply,
+		"id":      message["id"],
+		"data":    nil,
+	}
+
+	handler, ok := im.callbacks[method]
+	if !ok {
+		reply["error"] = fmt.Sprintf("Unknown callback: %s", method)
+	} else {
+		dataBytes, _ := json.Marshal(message["data"])
+		output, err := handler(string(dataBytes))
+		if err != nil {
+			reply["error"] = err.Error()
+		} else if output != "" {
+			var parsed interface{}
+			unmarshalNumbers([]byte(output), &parsed)
+			reply["data"] = parsed
+		}
+	}
+
+	replyBytes, _ := json.Marshal(reply)
+	if err := sendChunked(signedSender(im.signKey, transport.Send), im.key, fmt.Sprintf("%s-reply-%v", im.key, message["id"]), replyBytes, im.chunkSize); err != nil {
+		im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: failed to answer callback %s: %s", method, err.Error()))
+	}
+}
+
+// CallParent calls a callback of the calling process and waits for its result
+//
+// The calling process registers it with WithCallback().
+//
+// Parameters:
+//
+//	method: Callback name
+//	data: Callback data as JSON string
+//
+// Returns:
+//
+//	string: Result as JSON string
+//	error: Callbacks not accepted, stdin closed, or error of the callback
+func (om *OutputManager) CallParent(method, data string) (string, error) {
+	if om == nil || om.data == "" {
+		return "", errors.New("OutputManager isn't initialized")
+	}
+	if !om.acceptCallbacks {
+		return "", errors.New("The calling process doesn't accept callbacks")
+	}
+
+	om.callbackSeq++
+	id := om.callbackSeq
+	var parsed interface{}
+	unmarshalNumbers([]byte(data), &parsed)
+	om.emitMessage(map[string]interface{}{
+		"key":     om.key,
+		"channel": ChannelCallback,
+		"id":      id,
+		"method":  method,
+		"data":    parsed,
+	})
+
+	for {
+		line, err := readMessage(om.stdin, om.signKey)
+		if line == "" && err != nil {
+			return "", fmt.Errorf("No reply to callback %s: %s", method, err.Error())
+		}
+		var reply map[string]interface{}
+		if unmarshalNumbers([]byte(line), &reply) != nil || messageChannel(reply) != ChannelReply {
+			continue
+		}
+		if replyID, _ := numberValue(reply["id"]); int(replyID) != id {
+			continue
+		}
+		if message, ok := reply["error"].(string); ok {
+			return "", errors.New(message)
+		}
+		replyBytes, _ := json.Marshal(reply["data"])
+		return string(replyBytes), nil
+	}
+}
+
+// CallParent calls CallParent() on the OutputManager created by Init()
+func CallParent(method, data string) (string, error) {
+	return autoOutputManager().CallParent(method, data)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Capabilities describes what a target needs to reach
+//
+// Targets declare them with DeclareCapabilities(), they are sent to the
+// calling process in the handshake (see PeerInfo.Capabilities) and checked
+// against Policy.Capabilities. The declaration is cooperative, combine it
+// with a Sandbox to enforce it.
+//
+// Fields:
+//
+//	Network: Network access
+//	Read: Files and directories read
+//	Write: Files and directories written
+//	Exec: Programs started (names looked up in PATH or paths)
+type Capabilities struct {
+	Network bool     `json:"network,omitempty"`
+	Read    []string `json:"read,omitempty"`
+	Write   []string `json:"write,omitempty"`
+	Exec    []string `json:"exec,omitempty"`
+}
+
+// Capabilities declared by the target, sent with the handshake
+var (
+	capabilitiesMu       sync.RWMutex
+	declaredCapabilities *Capabilities
+)
+
+// DeclareCapabilities announces what the target needs in its handshake
+//
+// Must be called before Init(). The calling process stops targets
+// declaring more than its Policy allows before their outputs are used.
+// Relative paths are relative to the working directory.
+//
+// Parameters:
+//
+//	capabilities: Capabilities needed by the target
+func DeclareCapabilities(capabilities Capabilities) {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+	for i, path := range capabilities.Read {
+		capabilities.Read[i], _ = filepath.Abs(path)
+	}
+	for i, path := range capabilities.Write {
+		capabilities.Write[i], _ = filepath.Abs(path)
+	}
+	declaredCapabilities = &capabilities
+}
+
+// Get the capabilities declared by the target, nil when none
+func currentCapabilities() *Capabilities {
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	return declaredCapabilities
+}
+
+// Build Capabilities from a handshake message, nil when none were declared
+func parseCapabilities(value interface{}) *Capabilities {
+	if value == nil {
+		return nil
+	}
+	valueBytes, _ := json.Marshal(value)
+	var capabilities Capabilities
+	if json.Unmarshal(valueBytes, &capabilities) != nil {
+		return nil
+	}
+	return &capabilities
+}
+
+// Check the capabilities declared by a target against Policy.Capabilities
+func (p *Policy) checkCapabilities(requested *Capabilities) error {
+	allowed := p.Capabilities
+	if allowed == nil || requested == nil {
+		return nil
+	}
+	denied := []string{}
+	if requested.Network && !allowed.Network {
+		denied = append(denied, "network")
+	}
+	for _, path := range requested.Read {
+		if !pathAllowed(path, append(append([]string{}, allowed.Read...), allowed.Write...)) {
+			denied = append(denied, "read "+path)
+		}
+	}
+	for _, path := range requested.Write {
+		if !pathAllowed(path, allowed.Write) {
+			denied = append(denied, "write "+path)
+		}
+	}
+	for _, program := range requested.Exec {
+		if !programAllowed(program, allowed.Exec) {
+			denied = append(denied, "exec "+program)
+		}
+	}
+	if len(denied) > 0 {
+		return &PolicyError{Reason: fmt.Sprintf("capabilities not allowed: %s", strings.Join(denied, ", "))}
+	}
+	return nil
+}
+
+// Tell whether path is one of dirs or inside one of them
+func pathAllowed(path string, dirs []string) bool {
+	path = capabilityPath(path)
+	for _, dir := range dirs {
+		if insideDir(capabilityPath(dir), path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Absolute path with symlinks resolved, when it exists
+func capabilityPath(path string) string {
+	if resolved, err := resolvedPath(path); err == nil {
+		return resolved
+	}
+	path, _ = filepath.Abs(path)
+	return path
+}
+
+// Tell whether program is one of the allowed programs
+func programAllowed(program string, programs []string) bool {
+	resolve := func(name string) string {
+		if path, err := exec.LookPath(name); err == nil {
+			return capabilityPath(path)
+		}
+		return name
+	}
+	program = resolve(program)
+	for _, allowed := range programs {
+		if resolve(allowed) == program {
+			return true
+		}
+	}
+	return false
+}
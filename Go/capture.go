@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// WithStdoutCapture asks the target to capture what it prints
+//
+// Text the target writes to stdout is collected instead of discarded and
+// returned in Response.Stdout (see CaptureStdout()).
+func WithStdoutCapture() Option {
+	return func(im *InputManager) {
+		im.capture = true
+	}
+}
+
+// Text printed by the target while it is captured
+type stdoutCapture struct {
+	w    *os.File
+	buf  bytes.Buffer
+	done chan struct{}
+}
+
+// CaptureStdout collects what the program prints instead of discarding it
+//
+// The text is sent with the final status of the request (see ChannelDone)
+// and ends up in Response.Stdout, calling processes speaking the original
+// protocol get it on stderr. Called by Init() when the calling process
+// uses WithStdoutCapture().
+//
+// Returns:
+//
+//	error: Not the OutputManager created by Init(), or pipe error
+func (om *OutputManager) CaptureStdout() error {
+	if om == nil || om.originalStdout == nil {
+		return errors.New("Only the OutputManager created by Init() can capture stdout")
+	}
+	if om.capture != nil {
+		return nil
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("Failed to capture stdout: %s", err.Error())
+	}
+	capture := &stdoutCapture{w: w, done: make(chan struct{})}
+	go func() {
+		io.Copy(&capture.buf, r)
+		r.Close()
+		close(capture.done)
+	}()
+	om.capture = capture
+	om.suppressStdout()
+	return nil
+}
+
+// Stop capturing stdout, returns the text printed so far
+func (om *OutputManager) stopCapture() string {
+	if om.capture == nil {
+		return ""
+	}
+	om.capture.w.Close()
+	<-om.capture.done
+	text := om.capture.buf.String()
+	om.capture = nil
+	return text
+}
+
+// CaptureStdout calls CaptureStdout() on the OutputManager created by Init()
+func CaptureStdout() error {
+	return autoOutputManager().CaptureStdout()
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// CodecCBOR encodes data as CBOR (RFC 8949)
+//
+// Unlike JSON, CBOR keeps byte strings and 64-bit integers intact. Larger
+// integers are bignums (tags 2 and 3), decimals float64 would round are
+// decimal fractions (tag 4).
+const CodecCBOR = "cbor"
+
+func init() {
+	RegisterCodec(cborCodec{})
+}
+
+// CBOR codec for generic values
+type cborCodec struct{}
+
+func (cborCodec) Name() string {
+	return CodecCBOR
+}
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return cborAppend(nil, v)
+}
+
+func (cborCodec) Unmarshal(data []byte) (interface{}, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if v == cborBreak {
+		return nil, errors.New("cbor: unexpected break")
+	}
+	if d.pos != len(data) {
+		return nil, errors.New("cbor: trailing bytes")
+	}
+	return v, nil
+}
+
+// Append a major type with its argument
+func cborAppendHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), n)
+	}
+}
+
+func cborAppendInt(b []byte, i int64) []byte {
+	if i >= 0 {
+		return cborAppendHead(b, 0, uint64(i))
+	}
+	return cborAppendHead(b, 1, uint64(-1-i))
+}
+
+// Append an integer of any size, as a bignum (tag 2 or 3) when it needs to
+func cborAppendBignum(b []byte, i *big.Int) []byte {
+	if i.IsInt64() {
+		return cborAppendInt(b, i.Int64())
+	}
+	if i.IsUint64() {
+		return cborAppendHead(b, 0, i.Uint64())
+	}
+	if i.Sign() > 0 {
+		return append(cborAppendHead(cborAppendHead(b, 6, 2), 2, uint64(len(i.Bytes()))), i.Bytes()...)
+	}
+	// Negative bignums hold -1 - i
+	n := new(big.Int).Neg(i)
+	n.Sub(n, big.NewInt(1))
+	return append(cborAppendHead(cborAppendHead(b, 6, 3), 2, uint64(len(n.Bytes()))), n.Bytes()...)
+}
+
+func cborAppend(b []byte, v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return append(b, 0xf6), nil
+	case bool:
+		if x {
+			return append(b, 0xf5), nil
+		}
+		return append(b, 0xf4), nil
+	case int:
+		return cborAppendInt(b, int64(x)), nil
+	case int32:
+		return cborAppendInt(b, int64(x)), nil
+	case int64:
+		return cborAppendInt(b, x), nil
+	case uint64:
+		return cborAppendHead(b, 0, x), nil
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<63 {
+			return cborAppendInt(b, int64(x)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xfb), math.Float64bits(x)), nil
+	case float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xfa), math.Float32bits(x)), nil
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return cborAppendInt(b, i), nil
+		}
+		if u, ok := parseUint64(string(x)); ok {
+			return cborAppendHead(b, 0, u), nil
+		}
+		if f, exact := exactFloat(x); exact {
+			return cborAppend(b, f)
+		}
+		mantissa, exponent, ok := decimalParts(string(x))
+		if !ok {
+			return nil, fmt.Errorf("cbor: invalid number %s", x)
+		}
+		if exponent == 0 {
+			return cborAppendBignum(b, mantissa), nil
+		}
+		// Decimal fraction: [exponent, mantissa]
+		b = cborAppendHead(cborAppendHead(b, 6, 4), 4, 2)
+		b = cborAppendInt(b, int64(exponent))
+		return cborAppendBignum(b, mantissa), nil
+	case []byte:
+		return append(cborAppendHead(b, 2, uint64(len(x))), x...), nil
+	case string:
+		return append(cborAppendHead(b, 3, uint64(len(x))), x...), nil
+	case []interface{}:
+		b = cborAppendHead(b, 4, uint64(len(x)))
+		var err error
+		for _, item := range x {
+			if b, err = cborAppend(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		b = cborAppendHead(b, 5, uint64(len(x)))
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, key := range keys {
+			b, _ = cborAppend(b, key)
+			if b, err = cborAppend(b, x[key]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		// Other Go values: go through their JSON form
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(jsonBytes, &generic); err != nil {
+			return nil, err
+		}
+		return cborAppend(b, generic)
+	}
+}
+
+// Marker returned for the "break" stop code of indefinite-length items
+type cborBreakMarker struct{}
+
+var cborBreak = cborBreakMarker{}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errors.New("cbor: unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// Read the argument following an initial byte
+func (d *cborDecoder) readArg(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		b, err := d.read(1)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(b[0]), nil
+	case info == 25:
+		b, err := d.read(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err := d.read(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err := d.read(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(b), nil
+	}
+	return 0, fmt.Errorf("cbor: invalid additional info %d", info)
+}
+
+func (d *cborDecoder) decode() (interface{}, error) {
+	head, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	major, info := head[0]>>5, head[0]&0x1f
+
+	if major == 7 {
+		return d.decodeSimple(info)
+	}
+
+	indefinite := info == 31
+	var n uint64
+	if !indefinite {
+		if n, err = d.readArg(info); err != nil {
+			return nil, err
+		}
+	} else if major < 2 || major == 6 {
+		return nil, errors.New("cbor: invalid indefinite length")
+	}
+
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			neg := new(big.Int).SetUint64(n)
+			neg.Neg(neg).Sub(neg, big.NewInt(1))
+			return json.Number(neg.String()), nil
+		}
+		return -1 - int64(n), nil
+	case 2, 3:
+		var b []byte
+		if indefinite {
+			for {
+				chunk, err := d.decode()
+				if err != nil {
+					return nil, err
+				}
+				if chunk == cborBreak {
+					break
+				}
+				switch c := chunk.(type) {
+				case []byte:
+					b = append(b, c...)
+				case string:
+					b = append(b, c...)
+				default:
+					return nil, errors.New("cbor: invalid string chunk")
+				}
+			}
+		} else {
+			raw, err := d.read(n)
+			if err != nil {
+				return nil, err
+			}
+			b = append([]byte{}, raw...)
+		}
+		if major == 3 {
+			return string(b), nil
+		}
+		if b == nil {
+			b = []byte{}
+		}
+		return b, nil
+	case 4:
+		list := []interface{}{}
+		for i := uint64(0); indefinite || i < n; i++ {
+			item, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			if item == cborBreak {
+				if !indefinite {
+					return nil, errors.New("cbor: unexpected break")
+				}
+				break
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	case 5:
+		m := map[string]interface{}{}
+		for i := uint64(0); indefinite || i < n; i++ {
+			key, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			if key == cborBreak {
+				if !indefinite {
+					return nil, errors.New("cbor: unexpected break")
+				}
+				break
+			}
+			value, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := key.(string); ok {
+				m[s] = value
+			} else {
+				m[fmt.Sprint(key)] = value
+			}
+		}
+		return m, nil
+	default:
+		item, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		switch n {
+		case 2, 3:
+			return cborBignum(n, item)
+		case 4:
+			return cborDecimal(item)
+		}
+		// Other tags: keep the tagged item, drop the tag
+		return item, nil
+	}
+}
+
+// Decode a bignum (tag 2 or 3) as json.Number
+func cborBignum(tag uint64, item interface{}) (interface{}, error) {
+	raw, ok := item.([]byte)
+	if !ok {
+		return nil, errors.New("cbor: bignum is not a byte string")
+	}
+	i := new(big.Int).SetBytes(raw)
+	if tag == 3 {
+		i.Neg(i).Sub(i, big.NewInt(1))
+	}
+	return json.Number(i.String()), nil
+}
+
+// Decode a decimal fraction (tag 4) as json.Number
+func cborDecimal(item interface{}) (interface{}, error) {
+	parts, ok := item.([]interface{})
+	if !ok || len(parts) != 2 {
+		return nil, errors.New("cbor: invalid decimal fraction")
+	}
+	exponent, ok := parts[0].(int64)
+	if !ok {
+		return nil, errors.New("cbor: invalid decimal fraction exponent")
+	}
+	var mantissa string
+	switch m := parts[1].(type) {
+	case int64, uint64, json.Number:
+		mantissa = fmt.Sprint(m)
+	default:
+		return nil, errors.New("cbor: invalid decimal fraction mantissa")
+	}
+	if exponent == 0 {
+		return json.Number(mantissa), nil
+	}
+	return json.Number(fmt.Sprintf("%se%d", mantissa, exponent)), nil
+}
+
+func (d *cborDecoder) decodeSimple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		b, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return cborHalfToFloat(binary.BigEndian.Uint16(b)), nil
+	case 26:
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 27:
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 31:
+		return cborBreak, nil
+	}
+	if info < 24 {
+		return int64(info), nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+}
+
+// Convert an IEEE 754 half-precision float
+func cborHalfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
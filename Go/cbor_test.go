@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCBORRoundTrip(t *testing.T) {
+	testCodecRoundTrip(t, cborCodec{})
+}
+
+func TestCBORNumberRoundTrip(t *testing.T) {
+	testNumberRoundTrip(t, cborCodec{})
+}
+
+func TestCBORBignumTags(t *testing.T) {
+	for text, tag := range map[string]byte{
+		"123456789012345678901234567890":  0xc2,
+		"-123456789012345678901234567890": 0xc3,
+		"3.14159265358979323846":          0xc4,
+	} {
+		encoded, err := cborCodec{}.Marshal(json.Number(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoded[0] != tag {
+			t.Errorf("%s: expected tag 0x%02x, got 0x%02x", text, tag, encoded[0])
+		}
+	}
+}
+
+func TestCBORUint64(t *testing.T) {
+	encoded, err := cborCodec{}.Marshal(json.Number("18446744073709551615"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded[0] != 0x1b {
+		t.Errorf("expected major type 0 with 8-byte argument (0x1b), got 0x%02x", encoded[0])
+	}
+}
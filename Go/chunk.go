@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultChunkSize is the largest message sent in one piece (1 MiB)
+//
+// Larger messages are split into chunk messages on ChannelChunk and put
+// back together by the receiver before being handled.
+const DefaultChunkSize = 1 << 20
+
+// WithChunking splits requests larger than size into chunk messages
+//
+// Only targets using the Go OutputManager can reassemble them. Outputs
+// larger than size are always chunked by the Go OutputManager.
+//
+// Parameters:
+//
+//	size: Largest message sent in one piece (0 = DefaultChunkSize)
+func WithChunking(size int) Option {
+	return func(im *InputManager) {
+		if size <= 0 {
+			size = DefaultChunkSize
+		}
+		im.chunkSize = size
+	}
+}
+
+// Send a message, split into chunk messages when larger than size
+//
+// Each chunk carries its sequence number, the total number of chunks and
+// a base64 slice of the message, the last one is flagged final.
+func sendChunked(send func(message []byte) error, key interface{}, id string, message []byte, size int) error {
+	if size <= 0 || len(message) <= size {
+		return send(message)
+	}
+	total := (len(message) + size - 1) / size
+	for seq := 0; seq < total; seq++ {
+		end := (seq + 1) * size
+		if end > len(message) {
+			end = len(message)
+		}
+		chunk := map[string]interface{}{
+			"key":     key,
+			"channel": ChannelChunk,
+			"id":      id,
+			"seq":     seq,
+			"total":   total,
+			"data":    base64.StdEncoding.EncodeToString(message[seq*size : end]),
+		}
+		if seq == total-1 {
+			chunk["final"] = true
+		}
+		chunkBytes, _ := json.Marshal(chunk)
+		if err := send(chunkBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reassembles messages sent with sendChunked()
+type chunkAssembler struct {
+	parts map[string][]byte
+	seqs  map[string]int
+}
+
+func newChunkAssembler() *chunkAssembler {
+	return &chunkAssembler{
+		parts: make(map[string][]byte),
+		seqs:  make(map[string]int),
+	}
+}
+
+// Add a chunk message, returns the whole message once it is complete
+func (a *chunkAssembler) add(message map[string]interface{}) ([]byte, error) {
+	id, _ := message["id"].(string)
+	if id == "" {
+		return nil, errors.New("Message chunk without id")
+	}
+	seq, _ := numberValue(message["seq"])
+	total, _ := numberValue(message["total"])
+	if int(seq) != a.seqs[id] || int(seq) >= int(total) {
+		delete(a.parts, id)
+		delete(a.seqs, id)
+		return nil, fmt.Errorf("Message %s: chunk %d out of order", id, int(seq))
+	}
+	a.seqs[id]++
+
+	encoded, _ := message["data"].(string)
+	part, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		delete(a.parts, id)
+		delete(a.seqs, id)
+		return nil, fmt.Errorf("Message %s: %s", id, err.Error())
+	}
+	a.parts[id] = append(a.parts[id], part...)
+
+	if final, _ := message["final"].(bool); !final {
+		return nil, nil
+	}
+	whole := a.parts[id]
+	delete(a.parts, id)
+	delete(a.seqs, id)
+	if int(seq) != int(total)-1 {
+		return nil, fmt.Errorf("Message %s: missing chunks", id)
+	}
+	return whole, nil
+}
+
+// Read the next message from r, reassembling chunked messages
+//
+// With a signing key, every line must carry a valid signature (see
+// WithSigningKey()).
+func readMessage(r *bufio.Reader, key []byte) (string, error) {
+	assembler := newChunkAssembler()
+	for {
+		line, err := r.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			verified, verifyErr := verifyMessage(key, line)
+			if verifyErr != nil {
+				return "", verifyErr
+			}
+			// Only the channel is decoded, the message is parsed once by the caller
+			var header struct {
+				Channel string `json:"channel"`
+			}
+			if json.Unmarshal(verified, &header) != nil || header.Channel != ChannelChunk {
+				return string(verified), nil
+			}
+			var chunk map[string]interface{}
+			if unmarshalNumbers(verified, &chunk) != nil {
+				return string(verified), nil
+			}
+			whole, addErr := assembler.add(chunk)
+			if addErr != nil {
+				return "", addErr
+			}
+			if whole != nil {
+				return string(whole), nil
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// Write a message to the calling process, chunked when it allows it
+//
+// Safe for concurrent use (see Heartbeat()), the chunks of a message are
+// never interleaved with other messages.
+func (om *OutputManager) writeMessage(message []byte) {
+	om.writeMu.Lock()
+	defer om.writeMu.Unlock()
+	om.writeChunked(om.out, message)
+}
+
+// Write a message to w, the caller holds writeMu
+func (om *OutputManager) writeChunked(w io.Writer, message []byte) {
+	om.chunkSeq++
+	sendChunked(func(chunk []byte) error {
+		return writeLine(w, signMessage(om.signKey, chunk))
+	}, om.key, fmt.Sprintf("%s-%d", om.key, om.chunkSeq), message, om.maxMessageSize)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+func init() {
+	cliCommands["conformance"] = cliCommand{
+		usage:   "--file FILE [--lang LANGUAGE] [--case NAME,...]",
+		summary: "Check that a target implements the protocol",
+		run:     cliConformance,
+	}
+}
+
+// mangle conformance: run the cases of RunConformance() on a target
+//
+// Exit codes: 0 when every case passed, 1 otherwise, 2 for bad arguments.
+func cliConformance(args []string) int {
+	flags := cliFlags("conformance")
+	file := flags.String("file", "", "Target file (required)")
+	language := flags.String("lang", "", "Target language (detected from the file when empty)")
+	only := flags.String("case", "", "Comma-separated cases to run (all when empty)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" || flags.NArg() > 0 {
+		flags.Usage()
+		fmt.Fprintln(flags.Output(), "\nCases:")
+		for _, c := range ConformanceCases() {
+			fmt.Fprintf(flags.Output(), "  %-15s %s\n", c.Name, c.Description)
+		}
+		return 2
+	}
+
+	cases := []string{}
+	if *only != "" {
+		for _, name := range strings.Split(*only, ",") {
+			cases = append(cases, strings.TrimSpace(name))
+		}
+	}
+	passed := 0
+	results := RunConformance(*language, *file, cases...)
+	for _, result := range results {
+		if result.Passed {
+			passed++
+			fmt.Printf("PASS  %-15s %s\n", result.Case, result.Duration.Round(time.Millisecond))
+		} else {
+			fmt.Printf("FAIL  %-15s %s\n", result.Case, result.Reason)
+		}
+	}
+	fmt.Printf("\n%d/%d cases passed\n", passed, len(results))
+	if passed != len(results) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+//go:build ignore
+
+// Copies the Go files of the library next to the mangle command (see go:generate in main.go)
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory of the library, from cmd/mangle
+const libraryDir = "../.."
+
+// Header of the copies, tools and editors treat them as generated
+const copyHeader = "// Code generated by copy_library.go from %s. DO NOT EDIT.\n\n"
+
+func main() {
+	old, _ := filepath.Glob("lib_*.go")
+	for _, file := range old {
+		os.Remove(file)
+	}
+	files, err := filepath.Glob(filepath.Join(libraryDir, "*.go"))
+	if err != nil || len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no Go files in %s\n", libraryDir)
+		os.Exit(1)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+		// Build suffixes (_linux, _windows, ...) still apply to the copy
+		var copied bytes.Buffer
+		fmt.Fprintf(&copied, copyHeader, filepath.ToSlash(filepath.Join("Go", name)))
+		copied.Write(source)
+		if err := os.WriteFile("lib_"+name, copied.Bytes(), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+}
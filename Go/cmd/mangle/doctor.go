@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+)
+
+func init() {
+	cliCommands["doctor"] = cliCommand{
+		usage:   "[--file FILE] [--lang LANGUAGE] [LANGUAGE...]",
+		summary: "Check the installed runtimes and why a target can't run",
+		run:     cliDoctor,
+	}
+}
+
+// mangle doctor: probe the runtimes, then check a target file
+//
+// Without languages every registered runtime is listed, the missing ones
+// are only reported. Runtimes named on the command line or needed by the
+// file must be installed.
+//
+// Exit codes: 0 when everything checked is usable, 1 otherwise, 2 for bad
+// arguments.
+func cliDoctor(args []string) int {
+	flags := cliFlags("doctor")
+	file := flags.String("file", "", "Target file to check")
+	language := flags.String("lang", "", "Language of the target file (detected when empty)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	names := flags.Args()
+	if *language != "" && *file == "" {
+		names = append(names, *language)
+	}
+
+	ok := true
+	if *file == "" || len(names) > 0 {
+		fmt.Println("Runtimes:")
+		out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, result := range Doctor(names...) {
+			if !result.Installed && len(names) > 0 {
+				ok = false
+			}
+			fmt.Fprintln(out, doctorLine(result))
+		}
+		out.Flush()
+	}
+	if *file != "" {
+		if len(names) > 0 {
+			fmt.Println()
+		}
+		if !doctorFile(*file, *language) {
+			ok = false
+		}
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// One tab-separated line describing a probed runtime
+func doctorLine(result ProbeResult) string {
+	if !result.Installed {
+		return fmt.Sprintf("  %s\tmissing\t%s", result.Language, result.Hint)
+	}
+	return fmt.Sprintf("  %s\tok\t%s", result.Language, doctorRuntime(result))
+}
+
+// Where an installed runtime is and its version
+func doctorRuntime(result ProbeResult) string {
+	switch {
+	case result.Tool == "":
+		return "compiled, no runtime needed"
+	case result.Version == "":
+		return result.Path
+	}
+	return fmt.Sprintf("%s (%s)", result.Path, result.Version)
+}
+
+// Check a target file as Request() would, printing each step
+//
+// Returns false at the first step failing, with a hint to fix it.
+func doctorFile(file, language string) bool {
+	fmt.Printf("Target %s:\n", file)
+
+	info, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return doctorFail("exists", fmt.Sprintf("File not found: %s", file), "Check the path, relative paths start from the working directory")
+		}
+		return doctorFail("exists", err.Error(), "")
+	}
+	if info.IsDir() {
+		return doctorFail("exists", fmt.Sprintf("Path is not a file: %s", file), "Pass the file to run, not its directory")
+	}
+	reader, err := os.Open(file)
+	if err != nil {
+		return doctorFail("readable", err.Error(), "Give the user running mangle read access to the file")
+	}
+	reader.Close()
+	doctorPass("readable", "")
+
+	detected, detectErr := DetectLanguage(file)
+	if language == "" {
+		if detectErr != nil {
+			return doctorFail("language", detectErr.Error(), "Pass the language with --lang")
+		}
+		language = detected
+		doctorPass("language", language+" (detected)")
+	} else {
+		spec, known := lookupLanguage(language)
+		if !known {
+			return doctorFail("language", fmt.Sprintf("Unsupported language: %s", language), "Register it with RegisterLanguage()")
+		}
+		if other, ok := lookupLanguage(detected); detectErr == nil && ok && other.name != spec.name {
+			doctorPass("language", fmt.Sprintf("%s (the file looks like %s)", spec.name, detected))
+		} else {
+			doctorPass("language", spec.name)
+		}
+	}
+
+	result := Probe(language)
+	if !result.Installed {
+		return doctorFail("runtime", result.Err.Error(), result.Hint)
+	}
+	doctorPass("runtime", doctorRuntime(result))
+
+	cmd, err := NewInputManager().getCommand(language, file)
+	if err != nil {
+		return doctorFail("command", err.Error(), doctorHint(err, file))
+	}
+	doctorPass("command", strings.Join(cmd, " "))
+	return true
+}
+
+// What to do about an error of getCommand()
+func doctorHint(err error, file string) string {
+	message := err.Error()
+	switch {
+	case strings.HasPrefix(message, "File is not executable"):
+		if runtime.GOOS == "windows" {
+			return ""
+		}
+		return fmt.Sprintf("Run chmod +x %s, or pass the language running it", file)
+	case strings.HasPrefix(message, "Invalid file"):
+		return "Pass the language matching the extension, or leave --lang out to detect it"
+	}
+	return ""
+}
+
+func doctorPass(step, detail string) {
+	if detail == "" {
+		fmt.Printf("  ok    %s\n", step)
+		return
+	}
+	fmt.Printf("  ok    %s: %s\n", step, detail)
+}
+
+func doctorFail(step, message, hint string) bool {
+	fmt.Printf("  FAIL  %s: %s\n", step, message)
+	if hint != "" {
+		fmt.Printf("        %s\n", hint)
+	}
+	return false
+}
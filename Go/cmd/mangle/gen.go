@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	cliCommands["gen"] = cliCommand{
+		usage:   "[--out DIR] LANGUAGE...",
+		summary: "Write OutputManager helper modules for other languages",
+		run:     cliGen,
+	}
+}
+
+// mangle gen: write the helper modules of GenerateStub()
+//
+// Exit codes: 0 when every module was written, 1 otherwise, 2 for bad
+// arguments.
+func cliGen(args []string) int {
+	flags := cliFlags("gen")
+	out := flags.String("out", ".", "Directory to write the modules to (- for stdout)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		fmt.Fprintf(flags.Output(), "\nLanguages: %s\n", strings.Join(StubLanguages(), ", "))
+		return 2
+	}
+
+	status := 0
+	for _, language := range flags.Args() {
+		name, source, err := GenerateStub(language)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			status = 1
+			continue
+		}
+		if *out == "-" {
+			os.Stdout.Write(source)
+			continue
+		}
+		path := filepath.Join(*out, name)
+		if err := os.WriteFile(path, source, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			status = 1
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	}
+	return status
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+func init() {
+	cliCommands["init"] = cliCommand{
+		usage:   "--lang LANGUAGE [--dir DIR] [--force]",
+		summary: "Create an example target and the Go program calling it",
+		run:     cliInit,
+	}
+}
+
+// Example target of a language, using the module of GenerateStub()
+//
+// Fields:
+//
+//	file: Name of the target file
+//	source: Target reading {"numbers": [...]}, sending each square with a progress report
+type exampleTarget struct {
+	file   string
+	source string
+}
+
+// Example targets by main language name, one per language of StubLanguages()
+var exampleTargets = map[string]exampleTarget{
+	"PYTHON": {file: "child.py", source: `import mangle_stub as om
+
+om.init()
+numbers = (om.get_data() or {}).get("numbers")
+if not isinstance(numbers, list):
+    # The failure is the output of the request, the caller gets the error
+    om.fail('expected {"numbers": [...]}')
+else:
+    for i, n in enumerate(numbers):
+        om.progress(100 * i / len(numbers), "squaring %s" % n)
+        if n < 0:
+            om.warn("%s is negative" % n)
+        om.output(n * n)
+    om.progress(100, "done")
+`},
+	"JAVASCRIPT": {file: "child.js", source: `const om = require("./mangle_stub");
+
+om.init();
+const numbers = (om.getData() || {}).numbers;
+if (!Array.isArray(numbers)) {
+  // The failure is the output of the request, the caller gets the error
+  om.fail('expected {"numbers": [...]}');
+} else {
+  numbers.forEach((n, i) => {
+    om.progress((100 * i) / numbers.length, "squaring " + n);
+    if (n < 0) om.warn(n + " is negative");
+    om.output(n * n);
+  });
+  om.progress(100, "done");
+}
+`},
+	"RUBY": {file: "child.rb", source: `require_relative "mangle_stub"
+
+MangleStub.init
+numbers = (MangleStub.get_data || {})["numbers"]
+if !numbers.is_a?(Array)
+  # The failure is the output of the request, the caller gets the error
+  MangleStub.fail('expected {"numbers": [...]}')
+else
+  numbers.each_with_index do |n, i|
+    MangleStub.progress(100.0 * i / numbers.length, "squaring #{n}")
+    MangleStub.warn("#{n} is negative") if n < 0
+    MangleStub.output(n * n)
+  end
+  MangleStub.progress(100, "done")
+end
+`},
+	"PERL": {file: "child.pl", source: `use strict;
+use warnings;
+use FindBin;
+use lib $FindBin::Bin;
+use MangleStub;
+
+MangleStub::init();
+my $data = MangleStub::get_data();
+my $numbers = ref $data eq 'HASH' ? $data->{numbers} : undef;
+if (ref $numbers ne 'ARRAY') {
+    # The failure is the output of the request, the caller gets the error
+    MangleStub::fail('expected {"numbers": [...]}');
+} else {
+    for my $i (0 .. $#$numbers) {
+        my $n = $numbers->[$i];
+        MangleStub::progress(100 * $i / @$numbers, "squaring $n");
+        MangleStub::warn("$n is negative") if $n < 0;
+        MangleStub::output($n * $n);
+    }
+    MangleStub::progress(100, "done");
+}
+`},
+}
+
+// Go program calling the example target, <% %> delimiters
+const exampleCaller = `// Calls <%.File%> with the InputManager of mangle.dev
+//
+// Copy the Go files of mangle.dev into this directory, then:
+//
+//	go run .
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	im := NewInputManager(
+		WithProgress(func(percent float64, message string) {
+			fmt.Fprintf(os.Stderr, "%3.0f%% %s\n", percent, message)
+		}),
+	)
+
+	// Outputs arrive as soon as the target sends them (isUnique=false)
+	data := ` + "`" + `{"numbers": [1, 2, -3, 4]}` + "`" + `
+	for output := range im.ResponseStream(false, data, "<%.Language%>", "<%.File%>") {
+		fmt.Println("output:", string(output))
+	}
+
+	response := im.GetResponse()
+	for _, warning := range response.Warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+	if !response.RequestStatus {
+		for _, err := range response.Errors {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+`
+
+// mangle init: write an example target, its helper module and a Go caller
+//
+// Existing files are kept unless --force is given.
+//
+// Exit codes: 0 when the files were written, 1 otherwise, 2 for bad
+// arguments.
+func cliInit(args []string) int {
+	flags := cliFlags("init")
+	language := flags.String("lang", "", "Language of the example target (required)")
+	dir := flags.String("dir", ".", "Directory to create the files in")
+	force := flags.Bool("force", false, "Overwrite existing files")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *language == "" || flags.NArg() > 0 {
+		flags.Usage()
+		fmt.Fprintf(flags.Output(), "\nLanguages: %s\n", strings.Join(StubLanguages(), ", "))
+		return 2
+	}
+
+	stubName, stub, err := GenerateStub(*language)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 1
+	}
+	spec, _ := lookupLanguage(*language)
+	target := exampleTargets[spec.name]
+	caller, err := exampleCallerSource(strings.ToLower(spec.name), target.file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 1
+	}
+
+	files := []struct {
+		name   string
+		source []byte
+	}{
+		{stubName, stub},
+		{target.file, []byte(target.source)},
+		{"main.go", caller},
+	}
+	if !*force {
+		for _, file := range files {
+			if _, err := os.Stat(filepath.Join(*dir, file.name)); err == nil {
+				fmt.Fprintf(os.Stderr, "Error: %s already exists, pass --force to overwrite it\n", filepath.Join(*dir, file.name))
+				return 1
+			} else if !errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+				return 1
+			}
+		}
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 1
+	}
+	for _, file := range files {
+		path := filepath.Join(*dir, file.name)
+		if err := os.WriteFile(path, file.source, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	}
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Try the target:")
+	fmt.Fprintf(os.Stderr, "  mangle call --multiple --file %s --data '{\"numbers\": [1, 2, -3]}'\n", filepath.Join(*dir, target.file))
+	fmt.Fprintln(os.Stderr, "Then copy the Go files of mangle.dev next to main.go and run it:")
+	fmt.Fprintf(os.Stderr, "  cd %s && go run .\n", *dir)
+	return 0
+}
+
+// Fill the Go caller template for a target
+func exampleCallerSource(language, file string) ([]byte, error) {
+	tmpl, err := template.New("main.go").Delims("<%", "%>").Parse(exampleCaller)
+	if err != nil {
+		return nil, err
+	}
+	var source strings.Builder
+	err = tmpl.Execute(&source, map[string]string{"Language": language, "File": file})
+	return []byte(source.String()), err
+}
@@ -0,0 +1,192 @@
+// The mangle command runs targets from the terminal, so their authors can
+// test them without writing a Go program first
+//
+// The library is copied next to the command (lib_*.go, not committed), as
+// Go programs using it do. Build it from this directory:
+//
+//	go generate
+//	go build -o mangle .
+//
+// Then:
+//
+//	mangle call --lang python --file script.py --data '{"x":1}'
+package main
+
+//go:generate go run copy_library.go
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Subcommand of the mangle command
+//
+// Fields:
+//
+//	usage: Arguments, after the subcommand name
+//	summary: One line description
+//	run: Runs the subcommand with its arguments, returns the exit code
+type cliCommand struct {
+	usage   string
+	summary string
+	run     func(args []string) int
+}
+
+// Subcommands by name, each file adds its own
+var cliCommands = map[string]cliCommand{}
+
+func init() {
+	cliCommands["call"] = cliCommand{
+		usage:   "--file FILE [--lang LANGUAGE] [--data JSON] [options]",
+		summary: "Send a request to a target and print the response",
+		run:     cliCall,
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		cliUsage(os.Stderr)
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		cliUsage(os.Stdout)
+		return
+	}
+	command, ok := cliCommands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+		cliUsage(os.Stderr)
+		os.Exit(2)
+	}
+	os.Exit(command.run(os.Args[2:]))
+}
+
+// Print the subcommands
+func cliUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: mangle COMMAND [arguments]")
+	fmt.Fprintln(w)
+	names := []string{}
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, cliCommands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run mangle COMMAND -h for the arguments of a command.")
+}
+
+// Flag set of a subcommand, printing its usage on -h
+func cliFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		command := cliCommands[name]
+		fmt.Fprintf(flags.Output(), "Usage: mangle %s %s\n\n%s\n\n", name, command.usage, command.summary)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// mangle call: send a request and print the response
+//
+// Exit codes: 0 when the request succeeded, 1 when it failed, 2 for bad
+// arguments.
+func cliCall(args []string) int {
+	flags := cliFlags("call")
+	file := flags.String("file", "", "Target file (required)")
+	language := flags.String("lang", "", "Target language (detected from the file when empty)")
+	data := flags.String("data", "null", "Request data as JSON")
+	dataFile := flags.String("data-file", "", "Read the request data from a file (- for stdin)")
+	multiple := flags.Bool("multiple", false, "Accept several outputs (isUnique=false)")
+	optional := flags.Bool("optional", false, "The output is optional")
+	timeout := flags.Duration("timeout", 0, "Stop the target after this long (0 = no limit)")
+	raw := flags.Bool("raw", false, "Print the data only, errors go to stderr")
+	logs := flags.Bool("logs", false, "Collect the Log() lines of the target")
+	debug := flags.Bool("debug", false, "Dump every line exchanged with the target to stderr")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if *dataFile != "" {
+		var content []byte
+		var err error
+		if *dataFile == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(*dataFile)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			return 2
+		}
+		*data = string(content)
+	}
+	if !json.Valid([]byte(*data)) {
+		fmt.Fprintln(os.Stderr, "Error: the request data isn't valid JSON")
+		return 2
+	}
+
+	opts := []Option{}
+	if *timeout > 0 {
+		opts = append(opts, WithTimeout(*timeout))
+	}
+	if *logs {
+		opts = append(opts, WithLogs())
+	}
+	if *debug {
+		opts = append(opts, WithDebug(""))
+	}
+	im := NewInputManager(opts...)
+	start := time.Now()
+	im.Request(!*multiple, *optional, *data, *language, *file)
+
+	response := im.Response
+	if *raw {
+		if response.Data != "" {
+			fmt.Println(response.Data)
+		}
+		for _, warning := range response.Warnings {
+			fmt.Fprintln(os.Stderr, warning)
+		}
+		for _, err := range response.Errors {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	} else {
+		fmt.Println(cliResponseJSON(response))
+		fmt.Fprintf(os.Stderr, "%s in %s\n", cliOutcome(response.RequestStatus), time.Since(start).Round(time.Millisecond))
+	}
+	if !response.RequestStatus {
+		return 1
+	}
+	return 0
+}
+
+// Indented JSON of a response, its data shown as JSON rather than a string
+func cliResponseJSON(response InputManagerResponse) string {
+	responseBytes, _ := json.Marshal(response)
+	var fields map[string]json.RawMessage
+	json.Unmarshal(responseBytes, &fields)
+	if json.Valid([]byte(response.Data)) {
+		fields["data"] = json.RawMessage(response.Data)
+	}
+	ordered, _ := json.MarshalIndent(fields, "", "  ")
+	return string(ordered)
+}
+
+func cliOutcome(ok bool) string {
+	if ok {
+		return "Succeeded"
+	}
+	return "Failed"
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Codec encodes the "data" field of protocol messages
+//
+// Encoded data travels base64-encoded in the JSON envelope, next to an
+// "encoding" field holding the codec name. The envelope itself stays JSON,
+// so children that don't know a codec still read the request.
+//
+// Methods:
+//
+//	Name(): Codec name used in the "encoding" and "accept" fields
+//	Marshal(v): Encode a generic value (nil, bool, numbers, string, slices, maps)
+//	Unmarshal(data): Decode bytes back to a generic value
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// CodecJSON is the default codec, data is sent as plain JSON
+const CodecJSON = "json"
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		CodecJSON: jsonCodec{},
+	}
+)
+
+// RegisterCodec makes a codec available to InputManager and OutputManager
+//
+// Parameters:
+//
+//	codec: Codec implementation, replaces any codec with the same name
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// Get a registered codec by name
+func lookupCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// Pick the first registered codec of an "accept" list, JSON when none match
+func negotiateCodec(accept interface{}) string {
+	list, _ := accept.([]interface{})
+	for _, item := range list {
+		if name, ok := item.(string); ok {
+			if _, ok := lookupCodec(name); ok {
+				return name
+			}
+		}
+	}
+	return CodecJSON
+}
+
+// Encode the "data" field of a message in place
+func encodeMessageData(message map[string]interface{}, codecName string) error {
+	if codecName == "" || codecName == CodecJSON || message["data"] == nil {
+		return nil
+	}
+	codec, ok := lookupCodec(codecName)
+	if !ok {
+		return fmt.Errorf("Unsupported encoding: %s", codecName)
+	}
+	encoded, err := codec.Marshal(message["data"])
+	if err != nil {
+		return err
+	}
+	message["encoding"] = codecName
+	message["data"] = base64.StdEncoding.EncodeToString(encoded)
+	return nil
+}
+
+// Decode the "data" field of a message in place, compressed data can't
+// expand past limit bytes (0 = no limit)
+func decodeMessageData(message map[string]interface{}, limit int64) error {
+	if err := decompressMessageData(message, limit); err != nil {
+		return err
+	}
+
+	codecName, _ := message["encoding"].(string)
+	if codecName == "" || codecName == CodecJSON {
+		return nil
+	}
+	delete(message, "encoding")
+
+	codec, ok := lookupCodec(codecName)
+	if !ok {
+		message["data"] = nil
+		return fmt.Errorf("Unsupported encoding: %s", codecName)
+	}
+	encoded, ok := message["data"].(string)
+	if !ok {
+		message["data"] = nil
+		return fmt.Errorf("Invalid %s data", codecName)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		message["data"] = nil
+		return fmt.Errorf("Invalid %s data: %s", codecName, err.Error())
+	}
+	decoded, err := codec.Unmarshal(raw)
+	if err != nil {
+		message["data"] = nil
+		return fmt.Errorf("Invalid %s data: %s", codecName, err.Error())
+	}
+	message["data"] = decoded
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return CodecJSON
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	err := unmarshalNumbers(data, &v)
+	return v, err
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUndecodableOutputFailsOnce(t *testing.T) {
+	transport := &scriptedTransport{lines: func(requestKey string) [][]byte {
+		return [][]byte{[]byte(fmt.Sprintf(`{"key":%q,"request_status":true,"data":"!!not base64","encoding":"msgpack","optionalOutput":false,"isUnique":true,"errors":[],"warnings":[]}`, requestKey))}
+	}}
+	im := NewInputManager(WithTransport(transport))
+	im.Request(true, false, "1", "", "")
+
+	if im.Response.RequestStatus {
+		t.Errorf("request succeeded with undecodable data: %+v", im.Response)
+	}
+	if len(im.Response.Errors) != 1 {
+		t.Errorf("expected one error, got %q", im.Response.Errors)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Compiler of a source extension
+//
+// Fields:
+//
+//	command: Default compiler (see SetInterpreterCandidates())
+//	args: Builds the arguments compiling src into out
+type sourceCompiler struct {
+	command string
+	args    func(src, out string) []string
+}
+
+// Compilers used by WithCompile(), by source extension
+var sourceCompilers = map[string]sourceCompiler{
+	".c": {
+		command: "cc",
+		args:    func(src, out string) []string { return []string{"-O2", "-o", out, src} },
+	},
+	".cpp": {
+		command: "c++",
+		args:    func(src, out string) []string { return []string{"-O2", "-o", out, src} },
+	},
+	".rs": {
+		command: "rustc",
+		args:    func(src, out string) []string { return []string{"-O", "-o", out, src} },
+	},
+	".go": {
+		command: "go",
+		args:    func(src, out string) []string { return []string{"build", "-o", out, src} },
+	},
+}
+
+func init() {
+	sourceCompilers[".cc"] = sourceCompilers[".cpp"]
+	sourceCompilers[".cxx"] = sourceCompilers[".cpp"]
+}
+
+// WithCompile compiles C, C++, Rust and Go source targets before running them
+//
+// The binary is cached by content hash, so a source is only compiled
+// again once it changed. Without it, Go sources run with go run and the
+// other sources must already be executables.
+//
+// Parameters:
+//
+//	cacheDir: Directory of the compiled binaries ("" = user cache directory)
+func WithCompile(cacheDir string) Option {
+	return func(im *InputManager) {
+		if cacheDir == "" {
+			base, err := os.UserCacheDir()
+			if err != nil {
+				base = os.TempDir()
+			}
+			cacheDir = filepath.Join(base, "mangledotdev", "build")
+		}
+		im.compileDir = cacheDir
+	}
+}
+
+// Compile a source file into the cache, returns the path of the binary
+//
+// Returns "" when the file isn't a source of a compiled language. With a
+// policy, the compiler must be allowed even when the binary is cached.
+func compileSource(language, file, cacheDir string, policy *Policy) (string, error) {
+	compiler, ok := sourceCompilers[strings.ToLower(filepath.Ext(file))]
+	if !ok {
+		return "", nil
+	}
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(strings.ToLower(filepath.Ext(file))+"\x00"), source...))
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + "-" + hex.EncodeToString(sum[:8])
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	binary, err := filepath.Abs(filepath.Join(cacheDir, name))
+	if err != nil {
+		return "", err
+	}
+
+	command := ""
+	if policy != nil {
+		// The binary is the output of the compiler, cached or not
+		if command, err = lookupInterpreter(language, compiler.command); err != nil {
+			return "", err
+		}
+		if err := policy.checkCommand(append([]string{command}, compiler.args(file, binary)...), file); err != nil {
+			return "", err
+		}
+	}
+	if _, err := os.Stat(binary); err == nil {
+		return binary, nil
+	}
+	if command == "" {
+		if command, err = lookupInterpreter(language, compiler.command); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", fmt.Errorf("Failed to create compile cache: %s", err.Error())
+	}
+
+	// Built aside then renamed, concurrent builds can't run a partial binary
+	tmp, err := os.CreateTemp(cacheDir, name+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("Failed to create compile cache: %s", err.Error())
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	output, err := exec.Command(command, compiler.args(file, tmp.Name())...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("Compilation of %s failed: %s", file, strings.TrimSpace(string(output)))
+	}
+	if err := os.Rename(tmp.Name(), binary); err != nil {
+		return "", fmt.Errorf("Failed to store compiled binary: %s", err.Error())
+	}
+	return binary, nil
+}
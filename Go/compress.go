@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compressor compresses the "data" field of large protocol messages
+//
+// gzip is built in. Other algorithms (e.g. zstd) can be plugged in with
+// RegisterCompressor() using any library, on both sides of the protocol.
+//
+// Methods:
+//
+//	Name(): Name used in the "compression" and "accept_compression" fields
+//	Compress(data): Compress bytes
+//	Decompress(data): Restore compressed bytes
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// CompressionGzip compresses data with gzip
+const CompressionGzip = "gzip"
+
+// DefaultCompressionThreshold is the data size (bytes) above which data is compressed
+const DefaultCompressionThreshold = 1024
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{
+		CompressionGzip: gzipCompressor{},
+	}
+)
+
+// RegisterCompressor makes a compressor available to InputManager and OutputManager
+//
+// Parameters:
+//
+//	compressor: Compressor implementation, replaces any compressor with the same name
+func RegisterCompressor(compressor Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[compressor.Name()] = compressor
+}
+
+// Get a registered compressor by name
+func lookupCompressor(name string) (Compressor, bool) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	compressor, ok := compressors[name]
+	return compressor, ok
+}
+
+// Pick the first registered compressor of an "accept_compression" list
+func negotiateCompressor(accept interface{}) string {
+	list, _ := accept.([]interface{})
+	for _, item := range list {
+		if name, ok := item.(string); ok {
+			if _, ok := lookupCompressor(name); ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// Compress the "data" field of a message in place when larger than threshold
+//
+// Must run after encodeMessageData(): the compressed bytes are the encoded
+// data (or its JSON form when no codec is set).
+func compressMessageData(message map[string]interface{}, name string, threshold int) error {
+	if name == "" || message["data"] == nil {
+		return nil
+	}
+	compressor, ok := lookupCompressor(name)
+	if !ok {
+		return fmt.Errorf("Unsupported compression: %s", name)
+	}
+
+	var raw []byte
+	var err error
+	if _, encoded := message["encoding"]; encoded {
+		raw, err = base64.StdEncoding.DecodeString(message["data"].(string))
+	} else {
+		raw, err = json.Marshal(message["data"])
+	}
+	if err != nil {
+		return err
+	}
+	if len(raw) < threshold {
+		return nil
+	}
+
+	compressed, err := compressor.Compress(raw)
+	if err != nil {
+		return err
+	}
+	message["compression"] = name
+	message["data"] = base64.StdEncoding.EncodeToString(compressed)
+	return nil
+}
+
+// Undo compressMessageData() in place, the data can't expand past limit bytes (0 = no limit)
+func decompressMessageData(message map[string]interface{}, limit int64) error {
+	name, _ := message["compression"].(string)
+	if name == "" {
+		return nil
+	}
+	delete(message, "compression")
+
+	compressor, ok := lookupCompressor(name)
+	if !ok {
+		message["data"] = nil
+		return fmt.Errorf("Unsupported compression: %s", name)
+	}
+	encoded, _ := message["data"].(string)
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		message["data"] = nil
+		return fmt.Errorf("Invalid %s data: %s", name, err.Error())
+	}
+	var raw []byte
+	if limited, ok := compressor.(limitedDecompressor); ok && limit > 0 {
+		raw, err = limited.decompressLimit(compressed, limit)
+	} else {
+		raw, err = compressor.Decompress(compressed)
+	}
+	var limitErr *SizeLimitError
+	if errors.As(err, &limitErr) {
+		message["data"] = nil
+		return err
+	}
+	if err != nil {
+		message["data"] = nil
+		return fmt.Errorf("Invalid %s data: %s", name, err.Error())
+	}
+	// Compressors without a bounded read are checked once done
+	if limit > 0 && int64(len(raw)) > limit {
+		message["data"] = nil
+		return &SizeLimitError{Direction: "response", Limit: limit, Size: int64(len(raw))}
+	}
+
+	if _, encoded := message["encoding"]; encoded {
+		message["data"] = base64.StdEncoding.EncodeToString(raw)
+		return nil
+	}
+	var data interface{}
+	if err := unmarshalNumbers(raw, &data); err != nil {
+		message["data"] = nil
+		return fmt.Errorf("Invalid %s data: %s", name, err.Error())
+	}
+	message["data"] = data
+	return nil
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string {
+	return CompressionGzip
+}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.decompressLimit(data, 0)
+}
+
+// Compressors able to stop once limit bytes were restored, so a small
+// message can't expand into a huge one in memory
+type limitedDecompressor interface {
+	decompressLimit(data []byte, limit int64) ([]byte, error)
+}
+
+func (gzipCompressor) decompressLimit(data []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	raw, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > limit {
+		return nil, &SizeLimitError{Direction: "response", Limit: limit, Size: int64(len(raw))}
+	}
+	return raw, nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Longest time a target gets for each conformance case
+const conformanceTimeout = 30 * time.Second
+
+// ConformanceCase describes a check of RunConformance()
+//
+// Fields:
+//
+//	Name: Case name, as passed to RunConformance()
+//	Description: What the target must do to pass it
+type ConformanceCase struct {
+	Name        string
+	Description string
+}
+
+// ConformanceResult reports one case of RunConformance()
+//
+// Fields:
+//
+//	Case: Case name
+//	Passed: The target behaved as the protocol expects
+//	Reason: Why the case failed ("" when it passed)
+//	Duration: Time the case took
+type ConformanceResult struct {
+	Case     string
+	Passed   bool
+	Reason   string
+	Duration time.Duration
+}
+
+// Case of the conformance suite, check returns why the target failed it
+type conformanceCheck struct {
+	ConformanceCase
+	check func(language, file string) string
+}
+
+// Payload of the types case, one value of each JSON type
+const conformanceTypes = `{"int":42,"negative":-7,"float":1.5,"string":"héllo \"wörld\"\n\t✓","empty":"","null":null,"true":true,"false":false,"list":[1,"a",null,[]],"object":{"nested":{"deep":[{}]}}}`
+
+// Cases of the conformance suite, in the order they run
+var conformanceChecks = []conformanceCheck{
+	{ConformanceCase{"echo", "A unique output comes back as sent"}, func(language, file string) string {
+		response, reason := conformanceRequest(language, file, true, false, "echo", `{"x":1}`, 0)
+		if reason != "" {
+			return reason
+		}
+		return conformanceSuccess(response, `{"x":1}`)
+	}},
+	{ConformanceCase{"types", "Every JSON type and escaped text keep their value"}, func(language, file string) string {
+		response, reason := conformanceRequest(language, file, true, false, "echo", conformanceTypes, 0)
+		if reason != "" {
+			return reason
+		}
+		return conformanceSuccess(response, conformanceTypes)
+	}},
+	{ConformanceCase{"multiple", "Several outputs are accepted when isUnique=false"}, func(language, file string) string {
+		response, reason := conformanceRequest(language, file, false, false, "repeat", `"again"`, 3)
+		if reason != "" {
+			return reason
+		}
+		return conformanceSuccess(response, `["again","again","again"]`)
+	}},
+	{ConformanceCase{"out-of-bound", "A second output fails the request when isUnique=true"}, func(language, file string) string {
+		response, reason := conformanceRequest(language, file, true, false, "repeat", `1`, 2)
+		if reason != "" {
+			return reason
+		}
+		if response.RequestStatus {
+			return "the request succeeded with 2 outputs"
+		}
+		return conformanceErrors(response, "")
+	}},
+	{ConformanceCase{"optional", "No output and no error when the output is optional"}, func(language, file string) string {
+		response, reason := conformanceRequest(language, file, true, true, "silent", `null`, 0)
+		if reason != "" {
+			return reason
+		}
+		if response.RequestStatusSet || len(response.Errors) > 0 {
+			return fmt.Sprintf("expected no output, got status %v with errors %q", response.RequestStatus, response.Errors)
+		}
+		return ""
+	}},
+	{ConformanceCase{"missing-output", "No output fails the request when the output is required"}, func(language, file string) string {
+		response, reason := conformanceRequest(language, file, true, false, "silent", `null`, 0)
+		if reason != "" {
+			return reason
+		}
+		if response.RequestStatus {
+			return "the request succeeded without output"
+		}
+		return conformanceErrors(response, "")
+	}},
+	{ConformanceCase{"error", "A failure reaches the caller with its message"}, func(language, file string) string {
+		response, reason := conformanceRequest(language, file, true, false, "fail", `"conformance failure"`, 0)
+		if reason != "" {
+			return reason
+		}
+		if response.RequestStatus {
+			return "the request succeeded"
+		}
+		return conformanceErrors(response, "conformance failure")
+	}},
+	{ConformanceCase{"large", "A payload of 4 MiB goes both ways"}, func(language, file string) string {
+		large, _ := json.Marshal(strings.Repeat("0123456789abcdef", 1<<18))
+		response, reason := conformanceRequest(language, file, true, false, "echo", string(large), 0)
+		if reason != "" {
+			return reason
+		}
+		return conformanceSuccess(response, string(large))
+	}},
+	{ConformanceCase{"stdout", "Text printed to stdout doesn't break the protocol"}, func(language, file string) string {
+		response, reason := conformanceRequest(language, file, true, false, "print", `"{\"not\": \"an output\"}"`, 0)
+		if reason != "" {
+			return reason
+		}
+		return conformanceSuccess(response, `"{\"not\": \"an output\"}"`)
+	}},
+	{ConformanceCase{"bad-json", "A malformed request is reported, not answered"}, conformanceBadJSON},
+}
+
+// ConformanceCases lists the cases of RunConformance()
+//
+// Returns:
+//
+//	[]ConformanceCase: Cases in the order they run
+func ConformanceCases() []ConformanceCase {
+	cases := make([]ConformanceCase, len(conformanceChecks))
+	for i, check := range conformanceChecks {
+		cases[i] = check.ConformanceCase
+	}
+	return cases
+}
+
+// RunConformance checks that a target implements the protocol
+//
+// Authors of OutputManager implementations for other languages write a
+// small target with their library, the runner sends it a request per case
+// and checks the response. The request data is {"action": ..., "value":
+// ..., "count": ...} and the target must:
+//
+//	echo: output value
+//	repeat: output value count times
+//	print: print value (a string) to stdout the usual way, then output it
+//	silent: output nothing
+//	fail: fail the request with the error message value
+//
+// ServeConformance() is such a target for the Go OutputManager.
+//
+// Parameters:
+//
+//	language: Language of the target ("" to detect it)
+//	file: Path to the target file
+//	cases: Names of the cases to run (see ConformanceCases()), all when empty
+//
+// Returns:
+//
+//	[]ConformanceResult: One result per case, in order
+func RunConformance(language, file string, cases ...string) []ConformanceResult {
+	if len(cases) == 0 {
+		for _, check := range conformanceChecks {
+			cases = append(cases, check.Name)
+		}
+	}
+	results := make([]ConformanceResult, 0, len(cases))
+	for _, name := range cases {
+		result := ConformanceResult{Case: name, Reason: fmt.Sprintf("Unknown case: %s", name)}
+		for _, check := range conformanceChecks {
+			if check.Name == name {
+				start := time.Now()
+				result.Reason = check.check(language, file)
+				result.Duration = time.Since(start)
+				result.Passed = result.Reason == ""
+				break
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ServeConformance answers the requests of RunConformance()
+//
+// It is the reference target of the suite, run it from the main function
+// of a Go target to check the Go OutputManager itself.
+func ServeConformance() {
+	Init()
+	defer Cleanup()
+	var request struct {
+		Action string          `json:"action"`
+		Value  json.RawMessage `json:"value"`
+		Count  int             `json:"count"`
+	}
+	if err := GetDataInto(&request); err != nil {
+		OutputError(err)
+		return
+	}
+	switch request.Action {
+	case "echo":
+		Output(string(request.Value))
+	case "repeat":
+		for i := 0; i < request.Count; i++ {
+			Output(string(request.Value))
+		}
+	case "print":
+		var text string
+		json.Unmarshal(request.Value, &text)
+		fmt.Println(text)
+		Output(string(request.Value))
+	case "silent":
+	case "fail":
+		var message string
+		json.Unmarshal(request.Value, &message)
+		OutputError(errors.New(message))
+	default:
+		OutputError(fmt.Errorf("Unknown conformance action: %s", request.Action))
+	}
+}
+
+// Send one conformance request, returns why it couldn't be made
+//
+// Targets announcing FeatureDone must end every request with its final
+// status.
+func conformanceRequest(language, file string, isUnique, optionalOutput bool, action, value string, count int) (InputManagerResponse, string) {
+	data := fmt.Sprintf(`{"action":%q,"value":%s,"count":%d}`, action, value, count)
+	im := NewInputManager(WithTimeout(conformanceTimeout))
+	im.Request(isUnique, optionalOutput, data, language, file)
+	if err := im.Err(); err != nil {
+		return im.Response, err.Error()
+	}
+	if peer := im.Response.Peer; peer != nil && peer.Supports(FeatureDone) && !im.Response.Done {
+		return im.Response, "FeatureDone announced but no final status on ChannelDone"
+	}
+	return im.Response, ""
+}
+
+// Check a response succeeded with the expected data
+func conformanceSuccess(response InputManagerResponse, expected string) string {
+	if !response.RequestStatus {
+		return fmt.Sprintf("the request failed: %s", strings.Join(response.Errors, "; "))
+	}
+	var got, want interface{}
+	if err := json.Unmarshal([]byte(response.Data), &got); err != nil {
+		return fmt.Sprintf("invalid output data: %s", err.Error())
+	}
+	json.Unmarshal([]byte(expected), &want)
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Sprintf("expected %s, got %s", conformanceShort(expected), conformanceShort(response.Data))
+	}
+	return ""
+}
+
+// Check a failed response reports an error containing text
+func conformanceErrors(response InputManagerResponse, text string) string {
+	if len(response.Errors) == 0 {
+		return "the request failed without error"
+	}
+	if text != "" && !strings.Contains(strings.Join(response.Errors, "\n"), text) {
+		return fmt.Sprintf("expected an error containing %q, got %q", text, response.Errors)
+	}
+	return ""
+}
+
+// Cut long data for a failure reason
+func conformanceShort(data string) string {
+	if len(data) > 80 {
+		return data[:77] + "..."
+	}
+	return data
+}
+
+// Send a request that isn't valid JSON: the target may answer with a
+// failure or exit, it must not succeed nor hang
+func conformanceBadJSON(language, file string) string {
+	im := NewInputManager()
+	command, err := im.getCommand(language, file)
+	if err != nil {
+		return err.Error()
+	}
+	transport := NewProcessTransport()
+	if err := transport.Open(Target{Language: language, File: file, Command: command}); err != nil {
+		return err.Error()
+	}
+	timer := time.AfterFunc(conformanceTimeout, func() { transport.Kill() })
+	defer timer.Stop()
+
+	reason := ""
+	if err := transport.Send([]byte(`{"key": "conformance", "isUnique": true, "data": [1, 2`)); err == nil {
+		transport.CloseSend()
+	}
+	for {
+		line, err := transport.Receive()
+		if err != nil {
+			if err != io.EOF && reason == "" {
+				reason = err.Error()
+			}
+			break
+		}
+		var message map[string]interface{}
+		if json.Unmarshal(line, &message) != nil {
+			continue
+		}
+		if status, _ := message["request_status"].(bool); status && messageChannel(message) == ChannelData {
+			reason = "the malformed request succeeded"
+		}
+	}
+	transport.Close()
+	if !timer.Stop() {
+		return fmt.Sprintf("the target didn't end within %s", conformanceTimeout)
+	}
+	return reason
+}
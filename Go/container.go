@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ContainerTransport runs the target inside a fresh container
+//
+// The directory holding the target file is mounted read-only into the
+// container and stdin/stdout are wired through `<runtime> run -i`, so each
+// request gets its own isolated environment with the image's dependencies.
+// Target.Env is passed by name with -e NAME, its values come from the
+// environment of the runtime process, never from its arguments.
+//
+// Fields:
+//
+//	Image: Container image providing the runtime (e.g. "python:3.12-slim")
+//	Runtime: Container CLI to use (default: "docker", also works with "podman")
+//	WorkDir: Mount point of the target directory inside the container (default: "/work")
+//	Args: Extra `run` arguments (e.g. "--network", "none", "--memory", "256m")
+type ContainerTransport struct {
+	Image   string
+	Runtime string
+	WorkDir string
+	Args    []string
+	ProcessTransport
+}
+
+// NewContainerTransport creates a new ContainerTransport instance
+//
+// Parameters:
+//
+//	image: Container image providing the runtime
+//	args: Extra `run` arguments
+func NewContainerTransport(image string, args ...string) *ContainerTransport {
+	return &ContainerTransport{Image: image, Args: args}
+}
+
+// Open starts the container running target.Command
+func (t *ContainerTransport) Open(target Target) error {
+	if t.Image == "" {
+		return fmt.Errorf("Failed to start process: no container image")
+	}
+	command, err := t.containerCommand(target)
+	if err != nil {
+		return fmt.Errorf("Failed to start process: %s", err.Error())
+	}
+	target.Command = command
+	return t.ProcessTransport.Open(target)
+}
+
+// Build the container run command wrapping target.Command
+func (t *ContainerTransport) containerCommand(target Target) ([]string, error) {
+	runtimeName := t.Runtime
+	if runtimeName == "" {
+		runtimeName = "docker"
+	}
+	workDir := t.WorkDir
+	if workDir == "" {
+		workDir = "/work"
+	}
+
+	absFile, err := filepath.Abs(target.File)
+	if err != nil {
+		return nil, err
+	}
+	containerFile := path.Join(workDir, filepath.Base(absFile))
+
+	command := []string{runtimeName, "run", "-i", "--rm",
+		"-v", filepath.Dir(absFile) + ":" + workDir + ":ro",
+		"-w", workDir}
+	// The runtime process has the environment (see ProcessTransport.Open()),
+	// only names are passed so values like keys stay out of the process list
+	passed := map[string]bool{}
+	for _, env := range append([]string{AutoInitEnv + "=1"}, target.Env...) {
+		name := strings.SplitN(env, "=", 2)[0]
+		if name != "" && !passed[name] {
+			passed[name] = true
+			command = append(command, "-e", name)
+		}
+	}
+	command = append(command, t.Args...)
+	command = append(command, t.Image)
+
+	// Point the target command at the mounted copy of the file
+	for _, arg := range target.Command {
+		if filepath.Clean(arg) == filepath.Clean(target.File) {
+			arg = containerFile
+		}
+		command = append(command, arg)
+	}
+	return command, nil
+}
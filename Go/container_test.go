@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContainerCommand(t *testing.T) {
+	transport := &ContainerTransport{Image: "python:3.12-slim", Runtime: "podman", WorkDir: "/app", Args: []string{"--network", "none"}}
+	file, _ := filepath.Abs(filepath.Join("scripts", "target.py"))
+	cmd, err := transport.containerCommand(Target{File: file, Command: []string{"python", file, "--verbose"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd[0] != "podman" || cmd[1] != "run" {
+		t.Errorf("expected a podman run command, got %q", cmd)
+	}
+	mount := filepath.Dir(file) + ":/app:ro"
+	if !containsSequence(cmd, []string{"-v", mount}) || !containsSequence(cmd, []string{"-w", "/app"}) {
+		t.Errorf("expected %s mounted on the work directory, got %q", mount, cmd)
+	}
+	// The image comes last before the target command, pointed at the mounted file
+	if want := []string{"--network", "none", "python:3.12-slim", "python", "/app/target.py", "--verbose"}; !reflect.DeepEqual(cmd[len(cmd)-len(want):], want) {
+		t.Errorf("expected the command to end with %q, got %q", want, cmd)
+	}
+}
+
+// Tell whether values holds sequence, in order and contiguous
+func containsSequence(values, sequence []string) bool {
+	for i := 0; i+len(sequence) <= len(values); i++ {
+		if reflect.DeepEqual(values[i:i+len(sequence)], sequence) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestContainerCommandSkipsHostRuntime(t *testing.T) {
+	RegisterLanguage("mangle-test-remote", []string{".remote"}, func(file string) ([]string, error) {
+		return []string{"mangle-missing-runtime", file}, nil
+	})
+	file := filepath.Join(t.TempDir(), "target.remote")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewInputManager().getCommand("mangle-test-remote", file); err == nil {
+		t.Error("expected the missing runtime to fail on the host")
+	}
+	im := NewInputManager(WithTransport(NewContainerTransport("image")), WithPolicy(&Policy{Interpreters: []string{"mangle-missing-runtime"}}))
+	cmd, err := im.getCommand("mangle-test-remote", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"mangle-missing-runtime", file}; !reflect.DeepEqual(cmd, want) {
+		t.Errorf("expected %q, got %q", want, cmd)
+	}
+}
+
+func TestContainerCommandEnv(t *testing.T) {
+	transport := NewContainerTransport("image", "--network", "none")
+	cmd, err := transport.containerCommand(Target{File: "/src/target.py", Command: []string{"python", "/src/target.py"}, Env: []string{"A=1", SigningKeyEnv + "=00ff", "A=2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"docker", "run", "-i", "--rm", "-v", "/src:/work:ro", "-w", "/work",
+		"-e", AutoInitEnv, "-e", "A", "-e", SigningKeyEnv,
+		"--network", "none", "image", "python", "/work/target.py"}
+	if !reflect.DeepEqual(cmd, want) {
+		t.Errorf("expected %q, got %q", want, cmd)
+	}
+	for _, arg := range cmd {
+		if strings.Contains(arg, "00ff") {
+			t.Errorf("the signing key is in the arguments: %q", cmd)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// WithCorrelationID tags the requests of the InputManager with a correlation ID
+//
+// The ID travels in the envelope, the target reads it with
+// GetCorrelationID() and its Log() lines carry it. It is echoed in
+// Response.CorrelationID and attached to the logs, hooks, audit records
+// and spans of the requests, so one request can be followed across
+// processes and log files. Requests made by a target without their own ID
+// pass on the one it received.
+//
+// Parameters:
+//
+//	id: Correlation ID (e.g. the request ID of an HTTP service)
+func WithCorrelationID(id string) Option {
+	return func(im *InputManager) {
+		im.correlation = id
+	}
+}
+
+// Get the correlation ID of the next request, "" when there is none
+func (im *InputManager) correlationID() string {
+	if im.correlation != "" {
+		return im.correlation
+	}
+	if owner := globalOutputManager; owner != nil && !owner.closed {
+		return owner.correlation
+	}
+	return ""
+}
+
+// GetCorrelationID returns the correlation ID of the request
+//
+// Returns:
+//
+//	string: ID set by the calling process with WithCorrelationID() ("" when none)
+func (om *OutputManager) GetCorrelationID() string {
+	if om == nil {
+		return ""
+	}
+	return om.correlation
+}
+
+// GetCorrelationID calls GetCorrelationID() on the OutputManager created by Init()
+func GetCorrelationID() string {
+	return autoOutputManager().GetCorrelationID()
+}
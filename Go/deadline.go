@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// WithTimeout limits the time each request may take
+//
+// The target gets the deadline of the request (see GetDeadline()) and is
+// killed once it is exceeded when the transport can do it (see Killer).
+//
+// Parameters:
+//
+//	timeout: Maximum duration of a request, from the moment it is sent
+func WithTimeout(timeout time.Duration) Option {
+	return func(im *InputManager) {
+		im.timeout = timeout
+	}
+}
+
+// WithDeadline sets the time by which requests must be complete
+//
+// Same as WithTimeout() with an absolute time.
+func WithDeadline(deadline time.Time) Option {
+	return func(im *InputManager) {
+		im.deadline = deadline
+	}
+}
+
+// Get the deadline of the next request, zero when there is none
+func (im *InputManager) requestDeadline() time.Time {
+	deadline := im.deadline
+	if im.timeout > 0 {
+		if fromTimeout := time.Now().Add(im.timeout); deadline.IsZero() || fromTimeout.Before(deadline) {
+			deadline = fromTimeout
+		}
+	}
+	return deadline
+}
+
+// Kill the target once the deadline is exceeded
+//
+// Returns:
+//
+//	func() bool: Stops the watch, tells whether the deadline was exceeded
+func watchDeadline(deadline time.Time, transport Transport) func() bool {
+	if deadline.IsZero() {
+		return func() bool { return false }
+	}
+	var mu sync.Mutex
+	expired := false
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		mu.Lock()
+		expired = true
+		mu.Unlock()
+		if killer, ok := transport.(Killer); ok {
+			killer.Kill()
+		}
+	})
+	return func() bool {
+		timer.Stop()
+		mu.Lock()
+		defer mu.Unlock()
+		return expired
+	}
+}
+
+// GetDeadline returns the time by which the request must be complete
+//
+// Returns:
+//
+//	time.Time: Deadline set by the calling process (see WithTimeout())
+//	bool: false when the request has no deadline
+func (om *OutputManager) GetDeadline() (time.Time, bool) {
+	if om == nil || om.deadline.IsZero() {
+		return time.Time{}, false
+	}
+	return om.deadline, true
+}
+
+// RemainingTime returns the time left before the deadline of the request
+//
+// Long computations can check it to output partial results in time.
+//
+// Returns:
+//
+//	time.Duration: Time left (negative once exceeded, math.MaxInt64 without deadline)
+func (om *OutputManager) RemainingTime() time.Duration {
+	deadline, ok := om.GetDeadline()
+	if !ok {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Until(deadline)
+}
+
+// GetDeadline calls GetDeadline() on the OutputManager created by Init()
+func GetDeadline() (time.Time, bool) {
+	return autoOutputManager().GetDeadline()
+}
+
+// RemainingTime calls RemainingTime() on the OutputManager created by Init()
+func RemainingTime() time.Duration {
+	return autoOutputManager().RemainingTime()
+}
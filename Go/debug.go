@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DebugEnv turns on the wire dump of every InputManager (see WithDebug())
+//
+// "1" writes the dump to stderr, any other value is the path of a file
+// the dump is appended to.
+const DebugEnv = "MANGLE_DEBUG"
+
+// WithDebug dumps everything exchanged with the targets
+//
+// Every line written to the target (request, file chunks) and every raw
+// line read back, non-JSON lines included, is written as is with a
+// timestamp, the request key and its direction ("->" sent, "<-"
+// received). The command run, its end and its stderr are noted with "#".
+//
+// Parameters:
+//
+//	path: File the dump is appended to ("" = stderr)
+func WithDebug(path string) Option {
+	return func(im *InputManager) {
+		im.debug = true
+		im.debugPath = path
+	}
+}
+
+// Wire dump of one request, nil when debugging is off
+type wireDump struct {
+	mu  sync.Mutex
+	w   io.Writer
+	f   *os.File
+	key string
+}
+
+// Start the dump of the current request
+func (im *InputManager) openDump() *wireDump {
+	enabled, path := im.debug, im.debugPath
+	if !enabled {
+		switch value := os.Getenv(DebugEnv); value {
+		case "", "0":
+			return nil
+		case "1":
+			enabled = true
+		default:
+			enabled, path = true, value
+		}
+	}
+	dump := &wireDump{w: os.Stderr, key: im.key}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: can't open debug file %s: %s\n", path, err.Error())
+			return nil
+		}
+		dump.w, dump.f = f, f
+	}
+	return dump
+}
+
+func (d *wireDump) write(direction string, line []byte) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprintf(d.w, "%s %s %s %s\n", time.Now().UTC().Format(time.RFC3339Nano), d.key, direction, line)
+}
+
+// Note an event of the request
+func (d *wireDump) note(format string, args ...interface{}) {
+	d.write("#", []byte(fmt.Sprintf(format, args...)))
+}
+
+func (d *wireDump) received(line []byte) {
+	d.write("<-", line)
+}
+
+// Dump each message written with send
+func (d *wireDump) send(send func(message []byte) error) func(message []byte) error {
+	if d == nil {
+		return send
+	}
+	return func(message []byte) error {
+		d.write("->", message)
+		return send(message)
+	}
+}
+
+func (d *wireDump) close() {
+	if d != nil && d.f != nil {
+		d.f.Close()
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Languages picked for extensions accepted by several equivalent languages
+var detectDefaults = map[string]string{
+	".go":  "GO",
+	".jar": "JAVA",
+	".js":  "NODE",
+	".sh":  "SHELL",
+	".ts":  "TYPESCRIPT",
+}
+
+// Languages of the interpreters found in shebang lines
+var shebangLanguages = map[string]string{
+	"python":     "PYTHON",
+	"node":       "NODE",
+	"ruby":       "RUBY",
+	"perl":       "PERL",
+	"php":        "PHP",
+	"lua":        "LUA",
+	"luajit":     "LUA",
+	"sh":         "SH",
+	"bash":       "BASH",
+	"dash":       "SH",
+	"zsh":        "SHELL",
+	"rscript":    "R",
+	"julia":      "JULIA",
+	"deno":       "DENO",
+	"tsx":        "TYPESCRIPT",
+	"ts-node":    "TYPESCRIPT",
+	"elixir":     "ELIXIR",
+	"escript":    "ERLANG",
+	"runghc":     "HASKELL",
+	"runhaskell": "HASKELL",
+	"kotlin":     "KOTLIN",
+	"scala-cli":  "SCALA",
+	"swift":      "SWIFT",
+}
+
+// DetectLanguage infers the language of a file
+//
+// The shebang line (#!/usr/bin/env python3) wins over the extension.
+// Extensions accepted by several languages (.dll, ...) are ambiguous,
+// except the ones they all run the same way (.jar, ...). Executables
+// without extension run as they are (EXE).
+//
+// Parameters:
+//
+//	file: Path to the target file
+//
+// Returns:
+//
+//	string: Language name, as passed to Request()
+//	error: File not found, or unknown or ambiguous language
+func DetectLanguage(file string) (string, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("File not found: %s", file)
+		}
+		return "", err
+	}
+
+	if interpreter := shebangInterpreter(file); interpreter != "" {
+		if language, ok := shebangLanguages[interpreter]; ok {
+			return language, nil
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == "" || ext == ".exe" || ext == ".out" {
+		if ext == ".exe" || (!info.IsDir() && info.Mode()&0111 != 0) {
+			return "EXE", nil
+		}
+		return "", fmt.Errorf("Can't detect the language of '%s': not an executable, pass the language", file)
+	}
+	if language, ok := detectDefaults[ext]; ok {
+		return language, nil
+	}
+
+	// Aliases share their entry, each entry is counted once
+	languagesMu.RLock()
+	names := map[string]bool{}
+	for _, spec := range languages {
+		if containsString(spec.extensions, ext) {
+			names[spec.name] = true
+		}
+	}
+	languagesMu.RUnlock()
+
+	candidates := []string{}
+	for name := range names {
+		candidates = append(candidates, name)
+	}
+	sort.Strings(candidates)
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("Can't detect the language of '%s': unknown extension %s", file, ext)
+	case 1:
+		return candidates[0], nil
+	}
+	return "", fmt.Errorf("Can't detect the language of '%s': %s is used by %s, pass the language", file, ext, strings.Join(candidates, ", "))
+}
+
+// Get the interpreter named by the shebang line of a file, without version
+//
+// "#!/usr/bin/env python3" and "#!/usr/bin/python3.11" both give "python".
+func shebangInterpreter(file string) string {
+	if !hasShebang(file) {
+		return ""
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		// Skip the options of env (-S, ...)
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") {
+				interpreter = field
+				break
+			}
+		}
+	}
+	interpreter = strings.ToLower(interpreter)
+	return strings.TrimRight(interpreter, "0123456789.")
+}
+
+// RequestFile sends a request to a file, its language is detected
+//
+// Same as Request() with the language given by DetectLanguage().
+//
+// Parameters:
+//
+//	isUnique: Expect single output (true) or multiple (false)
+//	optionalOutput: Output is optional (true) or required (false)
+//	data: Data to send as JSON string
+//	file: Path to target file
+func (im *InputManager) RequestFile(isUnique, optionalOutput bool, data, file string) {
+	im.Request(isUnique, optionalOutput, data, "", file)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	methodsMu sync.RWMutex
+	methods   = map[string]Handler{}
+)
+
+// WithMethod names the operation the target should run
+//
+// The target dispatches the request to the handler registered for this
+// method with RegisterHandler().
+//
+// Parameters:
+//
+//	method: Method name
+func WithMethod(method string) Option {
+	return func(im *InputManager) {
+		im.method = method
+	}
+}
+
+// RegisterHandler exposes an operation of the child to calling processes
+//
+// Requests sent with WithMethod(method) are passed to the handler by
+// Dispatch(). The "" method handles requests without a method.
+//
+// Parameters:
+//
+//	method: Method name
+//	handler: Function receiving the request data and returning the output (JSON strings)
+func RegisterHandler(method string, handler Handler) {
+	methodsMu.Lock()
+	defer methodsMu.Unlock()
+	methods[method] = handler
+}
+
+// Get the handler registered for a method
+func lookupHandler(method string) (Handler, bool) {
+	methodsMu.RLock()
+	defer methodsMu.RUnlock()
+	handler, ok := methods[method]
+	return handler, ok
+}
+
+// GetMethod returns the method requested by the calling process
+//
+// Returns:
+//
+//	string: Method name, empty when the request has none
+func (om *OutputManager) GetMethod() string {
+	if om == nil {
+		return ""
+	}
+	return om.method
+}
+
+// Dispatch runs the handler registered for the requested method
+//
+// The handler output is sent with Output(). A handler error, or a method
+// without handler, sends a request_status=false response instead.
+//
+// Returns:
+//
+//	error: Not initialized, unknown method or handler error
+func (om *OutputManager) Dispatch() error {
+	if om == nil {
+		return errors.New("OutputManager isn't initialized")
+	}
+	handler, ok := lookupHandler(om.method)
+	if !ok && om.data != "" {
+		err := fmt.Errorf("Unknown method: %s", om.method)
+		om.writeFailure([]Problem{{Code: CodeUnknownMethod, Message: err.Error()}}, nil)
+		return err
+	}
+	return om.runHandler(handler)
+}
+
+// GetMethod calls GetMethod() on the OutputManager created by Init()
+func GetMethod() string {
+	return autoOutputManager().GetMethod()
+}
+
+// Dispatch calls Dispatch() on the OutputManager created by Init()
+func Dispatch() error {
+	return autoOutputManager().Dispatch()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Longest time a runtime gets to report its version
+const probeTimeout = 10 * time.Second
+
+// ProbeResult reports whether the runtime of a language is installed
+//
+// Fields:
+//
+//	Language: Main name of the language (e.g. "PYTHON")
+//	Installed: The runtime was found (always true for compiled executables)
+//	Tool: Command found in PATH (e.g. "python3"), "" when none is needed
+//	Path: Full path of Tool
+//	Version: First line reported by the runtime version flag
+//	Hint: What to do when the runtime is missing
+//	Err: Why the runtime can't be used (*RuntimeNotFoundError when missing)
+type ProbeResult struct {
+	Language  string
+	Installed bool
+	Tool      string
+	Path      string
+	Version   string
+	Hint      string
+	Err       error
+}
+
+// Arguments printing the version of a runtime, "--version" when missing
+var versionArgs = map[string][]string{
+	"java":    {"-version"},
+	"go":      {"version"},
+	"sh":      nil,
+	"escript": nil,
+}
+
+// Probe checks that the runtime of a language is installed
+//
+// The runtimes are looked up as Request() does (see
+// SetInterpreterCandidates()) and asked for their version, so missing
+// dependencies show at startup rather than on the first request. The
+// result is kept for Status().
+//
+// Parameters:
+//
+//	language: Language as passed to Request()
+//
+// Returns:
+//
+//	ProbeResult: Runtime found, with its path and version, or what is missing
+func Probe(language string) ProbeResult {
+	result := probeRuntime(language)
+	recordProbe(result)
+	return result
+}
+
+func probeRuntime(language string) ProbeResult {
+	spec, known := lookupLanguage(language)
+	if !known {
+		return ProbeResult{
+			Language: strings.ToUpper(language),
+			Hint:     "Register it with RegisterLanguage()",
+			Err:      fmt.Errorf("Unsupported language: %s", language),
+		}
+	}
+	result := ProbeResult{Language: spec.name}
+	if len(spec.tools) == 0 {
+		result.Installed = true
+		return result
+	}
+
+	candidates := []string{}
+	for _, tool := range spec.tools {
+		found, err := lookupInterpreter(spec.name, tool)
+		if err != nil {
+			if notFound, ok := err.(*RuntimeNotFoundError); ok {
+				candidates = append(candidates, notFound.Candidates...)
+			}
+			continue
+		}
+		result.Installed = true
+		result.Tool = found
+		result.Path, _ = exec.LookPath(found)
+		if abs, err := filepath.Abs(result.Path); err == nil {
+			result.Path = abs
+		}
+		result.Version = toolVersion(found, tool)
+		return result
+	}
+
+	result.Err = &RuntimeNotFoundError{Language: spec.name, Candidates: candidates}
+	result.Hint = fmt.Sprintf("Install %s or set its path with WithInterpreter()", strings.Join(candidates, " or "))
+	return result
+}
+
+// Doctor probes the runtimes of several languages
+//
+// Parameters:
+//
+//	names: Languages to check, every registered language when empty
+//
+// Returns:
+//
+//	[]ProbeResult: One result per language, in the given (or alphabetical) order
+func Doctor(names ...string) []ProbeResult {
+	if len(names) == 0 {
+		languagesMu.RLock()
+		seen := map[string]bool{}
+		for _, spec := range languages {
+			seen[spec.name] = true
+		}
+		languagesMu.RUnlock()
+		for name := range seen {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	results := make([]ProbeResult, 0, len(names))
+	for _, language := range names {
+		results = append(results, Probe(language))
+	}
+	return results
+}
+
+// Get the first line printed by a runtime asked for its version
+func toolVersion(command, tool string) string {
+	args, ok := versionArgs[tool]
+	if !ok {
+		args = []string{"--version"}
+	}
+	if args == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, command, args...).CombinedOutput()
+	if err != nil && len(output) == 0 {
+		return ""
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// EncryptionAESGCM encrypts data with AES-GCM
+const EncryptionAESGCM = "aes-gcm"
+
+// EncryptionKeyEnv passes the key of WithEncryptionKey() to the target, hex encoded
+//
+// Like SigningKeyEnv, the OutputManager removes it from its environment.
+// Targets reached over the network get their key with SetEncryptionKey().
+const EncryptionKeyEnv = "MANGLE_ENCRYPTION_KEY"
+
+// WithEncryptionKey encrypts the data exchanged with the target
+//
+// The "data" and "fields" of the request and of the outputs are encrypted
+// with AES-GCM (after encoding and compression), bound to the request key
+// so they can't be replayed in another request. Data the target sends in
+// clear is refused. Metadata, errors, logs, captured stdout and files sent
+// with SendFile() are not encrypted.
+//
+// Parameters:
+//
+//	key: AES key shared with the target (16, 24 or 32 bytes)
+func WithEncryptionKey(key []byte) Option {
+	return func(im *InputManager) {
+		im.encKey = key
+	}
+}
+
+// Key of the OutputManager, from SetEncryptionKey() or EncryptionKeyEnv
+var (
+	encryptionMu  sync.Mutex
+	encryptionKey []byte
+)
+
+// SetEncryptionKey sets the key the OutputManager encrypts and decrypts data with
+//
+// Only needed when the key isn't passed in EncryptionKeyEnv, call it
+// before Init().
+//
+// Parameters:
+//
+//	key: AES key shared with the calling process (16, 24 or 32 bytes)
+func SetEncryptionKey(key []byte) {
+	encryptionMu.Lock()
+	defer encryptionMu.Unlock()
+	encryptionKey = key
+}
+
+// Get the key of the OutputManager, nil when data isn't encrypted
+func outputEncryptionKey() []byte {
+	encryptionMu.Lock()
+	defer encryptionMu.Unlock()
+	if encryptionKey == nil {
+		if encoded := os.Getenv(EncryptionKeyEnv); encoded != "" {
+			encryptionKey, _ = hex.DecodeString(encoded)
+			os.Unsetenv(EncryptionKeyEnv)
+		}
+	}
+	return encryptionKey
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid encryption key: %s", err.Error())
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt the "data" and "fields" of a message in place
+//
+// Must run after compressMessageData(): the encrypted bytes are the
+// compressed or encoded data (or its JSON form when neither is set).
+func encryptMessageData(message map[string]interface{}, key []byte) error {
+	if key == nil {
+		return nil
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	requestKey, _ := message["key"].(string)
+	seal := func(plain []byte) string {
+		nonce := make([]byte, gcm.NonceSize())
+		rand.Read(nonce)
+		return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, []byte(requestKey)))
+	}
+
+	if message["data"] != nil {
+		var raw []byte
+		if binaryData(message) {
+			raw, err = base64.StdEncoding.DecodeString(message["data"].(string))
+		} else {
+			raw, err = json.Marshal(message["data"])
+		}
+		if err != nil {
+			return err
+		}
+		message["data"] = seal(raw)
+	}
+	if message["fields"] != nil {
+		raw, err := json.Marshal(message["fields"])
+		if err != nil {
+			return err
+		}
+		message["fields"] = seal(raw)
+	}
+	message["encryption"] = EncryptionAESGCM
+	return nil
+}
+
+// Undo encryptMessageData() in place
+func decryptMessageData(message map[string]interface{}, key []byte) error {
+	name, _ := message["encryption"].(string)
+	if name == "" {
+		if key != nil && (message["data"] != nil || message["fields"] != nil) {
+			message["data"] = nil
+			delete(message, "fields")
+			return errors.New("Unencrypted data refused")
+		}
+		return nil
+	}
+	delete(message, "encryption")
+	if name != EncryptionAESGCM {
+		message["data"] = nil
+		return fmt.Errorf("Unsupported encryption: %s", name)
+	}
+	if key == nil {
+		message["data"] = nil
+		return errors.New("Encrypted data but no encryption key")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		message["data"] = nil
+		return err
+	}
+	requestKey, _ := message["key"].(string)
+	open := func(value interface{}) ([]byte, error) {
+		encoded, _ := value.(string)
+		sealed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(sealed) < gcm.NonceSize() {
+			return nil, errors.New("Invalid encrypted data")
+		}
+		plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(requestKey))
+		if err != nil {
+			return nil, errors.New("Invalid encrypted data: authentication failed")
+		}
+		return plain, nil
+	}
+
+	if message["data"] != nil {
+		raw, err := open(message["data"])
+		if err != nil {
+			message["data"] = nil
+			return err
+		}
+		if binaryData(message) {
+			message["data"] = base64.StdEncoding.EncodeToString(raw)
+		} else {
+			var data interface{}
+			if err := unmarshalNumbers(raw, &data); err != nil {
+				message["data"] = nil
+				return fmt.Errorf("Invalid encrypted data: %s", err.Error())
+			}
+			message["data"] = data
+		}
+	}
+	if message["fields"] != nil {
+		raw, err := open(message["fields"])
+		if err != nil {
+			delete(message, "fields")
+			return err
+		}
+		var fields map[string]interface{}
+		if err := unmarshalNumbers(raw, &fields); err != nil {
+			delete(message, "fields")
+			return fmt.Errorf("Invalid encrypted data: %s", err.Error())
+		}
+		message["fields"] = fields
+	}
+	return nil
+}
+
+// Tell whether the "data" of a message is base64 bytes (encoded or compressed)
+func binaryData(message map[string]interface{}) bool {
+	_, encoded := message["encoding"]
+	_, compressed := message["compression"]
+	return encoded || compressed
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Variables every target needs to start, kept by WithCleanEnv()
+var essentialEnv = []string{"PATH"}
+
+func init() {
+	if runtime.GOOS == "windows" {
+		essentialEnv = append(essentialEnv, "PATHEXT", "SYSTEMROOT", "WINDIR", "COMSPEC", "TEMP", "TMP")
+	}
+}
+
+// WithCleanEnv starts targets with a minimal environment
+//
+// Targets don't inherit the environment of the calling process (and the
+// secrets it may hold), only PATH (plus the variables Windows needs to
+// start a process) and the given variables. The variables set by the
+// library (see WithVirtualenv(), WithSigningKey(), ...) are still passed.
+//
+// Parameters:
+//
+//	vars: "KEY=value" to set a variable, "KEY" to pass the value of the calling process
+func WithCleanEnv(vars ...string) Option {
+	return func(im *InputManager) {
+		env := []string{}
+		for _, name := range append(append([]string{}, essentialEnv...), vars...) {
+			if strings.Contains(name, "=") {
+				env = append(env, name)
+			} else if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+		}
+		im.environ = env
+	}
+}
+
+// WithTempHome gives each target an empty, read-only HOME
+//
+// The directory is created before the target starts and removed once it
+// ended, so the target can't read the files of the calling user nor leave
+// any behind. Targets running as root can still write it (see WithUser()).
+func WithTempHome() Option {
+	return func(im *InputManager) {
+		im.tempHome = true
+	}
+}
+
+// Create an empty read-only HOME, returns its variables and its removal
+func createTempHome() ([]string, func(), error) {
+	dir, err := os.MkdirTemp("", "mangledotdev-home-")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	remove := func() {
+		os.Chmod(dir, 0700)
+		os.RemoveAll(dir)
+	}
+	return []string{"HOME=" + dir, "USERPROFILE=" + dir}, remove, nil
+}
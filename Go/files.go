@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Raw bytes per file chunk (base64 lines stay well under 64KB)
+const fileChunkSize = 32 * 1024
+
+// Send a file as chunk messages on ChannelFile
+//
+// Each chunk carries a sequence number, the last one is flagged final and
+// carries the file size and SHA-256 so the receiver can verify it.
+func sendFileChunks(send func(message []byte) error, key, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	buf := make([]byte, fileChunkSize)
+	var size int64
+	for seq := 0; ; seq++ {
+		n, readErr := io.ReadFull(f, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return readErr
+		}
+		hash.Write(buf[:n])
+		size += int64(n)
+
+		chunk := map[string]interface{}{
+			"key":     key,
+			"channel": ChannelFile,
+			"name":    name,
+			"seq":     seq,
+			"data":    base64.StdEncoding.EncodeToString(buf[:n]),
+		}
+		final := readErr != nil
+		if final {
+			chunk["final"] = true
+			chunk["size"] = size
+			chunk["sha256"] = hex.EncodeToString(hash.Sum(nil))
+		}
+
+		chunkBytes, _ := json.Marshal(chunk)
+		if err := send(chunkBytes); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// Reassembles files sent with sendFileChunks()
+type fileAssembler struct {
+	parts map[string]*bytes.Buffer
+	seqs  map[string]int
+	files map[string][]byte
+}
+
+func newFileAssembler() *fileAssembler {
+	return &fileAssembler{
+		parts: make(map[string]*bytes.Buffer),
+		seqs:  make(map[string]int),
+		files: make(map[string][]byte),
+	}
+}
+
+// Add a chunk message, returns the file name once it is complete
+func (a *fileAssembler) add(message map[string]interface{}) (string, error) {
+	name, _ := message["name"].(string)
+	if name == "" {
+		return "", errors.New("File chunk without name")
+	}
+	seq, _ := numberValue(message["seq"])
+	if int(seq) != a.seqs[name] {
+		delete(a.parts, name)
+		delete(a.seqs, name)
+		return "", fmt.Errorf("File %s: chunk %d out of order", name, int(seq))
+	}
+	a.seqs[name]++
+
+	encoded, _ := message["data"].(string)
+	chunk, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("File %s: %s", name, err.Error())
+	}
+	if a.parts[name] == nil {
+		a.parts[name] = &bytes.Buffer{}
+	}
+	a.parts[name].Write(chunk)
+
+	if final, _ := message["final"].(bool); !final {
+		return "", nil
+	}
+
+	data := a.parts[name].Bytes()
+	delete(a.parts, name)
+	delete(a.seqs, name)
+
+	size, _ := numberValue(message["size"])
+	expected, _ := message["sha256"].(string)
+	sum := sha256.Sum256(data)
+	if int64(size) != int64(len(data)) || hex.EncodeToString(sum[:]) != expected {
+		return "", fmt.Errorf("File %s: checksum mismatch", name)
+	}
+	a.files[name] = data
+	return name, nil
+}
+
+// Write a received file to dest
+func writeReceivedFile(files map[string][]byte, name, dest string) error {
+	data, ok := files[name]
+	if !ok {
+		return fmt.Errorf("File not received: %s", name)
+	}
+	return os.WriteFile(dest, data, 0644)
+}
+
+// SendFile attaches a file to the next Request()
+//
+// The file is streamed to the target in checksummed chunks right after the
+// request, the target gets it with ReceiveFile(name, dest) where name is
+// the base name of path.
+//
+// Parameters:
+//
+//	path: Path of the file to send
+//
+// Returns:
+//
+//	error: File not found or not a regular file
+func (im *InputManager) SendFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("Path is not a file: %s", path)
+	}
+	im.attachments = append(im.attachments, path)
+	return nil
+}
+
+// ReceiveFile writes a file sent by the target with SendFile()
+//
+// Parameters:
+//
+//	name: Base name of the file sent by the target (see Response.Files)
+//	dest: Destination path
+//
+// Returns:
+//
+//	error: File not received or write error
+func (im *InputManager) ReceiveFile(name, dest string) error {
+	return writeReceivedFile(im.files, name, dest)
+}
+
+// ReceiveFile writes a file sent by the calling process with InputManager.SendFile()
+//
+// Parameters:
+//
+//	name: Base name of the file sent by the calling process
+//	dest: Destination path
+//
+// Returns:
+//
+//	error: File not received or write error
+func (om *OutputManager) ReceiveFile(name, dest string) error {
+	if om == nil {
+		return errors.New("OutputManager isn't initialized")
+	}
+	return writeReceivedFile(om.files, name, dest)
+}
+
+// SendFile streams a file back to the calling process
+//
+// The calling process gets it with InputManager.ReceiveFile(name, dest)
+// where name is the base name of path.
+//
+// Parameters:
+//
+//	path: Path of the file to send
+//
+// Returns:
+//
+//	error: Not initialized, caller can't receive files, or read error
+func (om *OutputManager) SendFile(path string) error {
+	if om == nil || om.data == "" {
+		return errors.New("OutputManager isn't initialized")
+	}
+	if !om.acceptFiles {
+		return errors.New("The calling process can't receive files")
+	}
+	return sendFileChunks(func(message []byte) error {
+		om.writeMu.Lock()
+		defer om.writeMu.Unlock()
+		return writeLine(om.out, signMessage(om.signKey, message))
+	}, om.key, filepath.Base(path), path)
+}
+
+// ReceiveFile calls ReceiveFile() on the OutputManager created by Init()
+func ReceiveFile(name, dest string) error {
+	return autoOutputManager().ReceiveFile(name, dest)
+}
+
+// SendFile calls SendFile() on the OutputManager created by Init()
+func SendFile(path string) error {
+	return autoOutputManager().SendFile(path)
+}
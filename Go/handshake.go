@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ProtocolVersion is the version of the protocol spoken by this library
+//
+// Version 1 is the original envelope (key, data, optionalOutput, isUnique),
+// it has no "version" field and no handshake.
+const ProtocolVersion = 2
+
+// Protocol features announced in the handshake
+const (
+	// FeatureChunks: oversized messages can be chunked (see WithChunking())
+	FeatureChunks = "chunks"
+	// FeatureFiles: files can be sent both ways (see SendFile())
+	FeatureFiles = "files"
+	// FeatureFields: named data fields (see RequestFields())
+	FeatureFields = "fields"
+	// FeatureMeta: request metadata (see WithMeta())
+	FeatureMeta = "meta"
+	// FeatureNumbers: numbers are kept exact (see GetDataExact())
+	FeatureNumbers = "numbers"
+	// FeatureMethods: requests are dispatched by method (see RegisterHandler())
+	FeatureMethods = "methods"
+	// FeatureChannels: named output channels (see OutputTo())
+	FeatureChannels = "channels"
+	// FeatureDone: every request ends with a final status on ChannelDone
+	FeatureDone = "done"
+)
+
+// Features of this library, announced by the OutputManager
+var protocolFeatures = []string{FeatureChunks, FeatureFiles, FeatureFields, FeatureMeta, FeatureNumbers, FeatureMethods, FeatureChannels, FeatureDone}
+
+// PeerInfo describes the protocol support of a target
+//
+// Targets using a protocol-aware OutputManager announce it in a handshake
+// message (ChannelHandshake) when the request carries a "version" field.
+// Targets that answer without a handshake speak version 1.
+//
+// Fields:
+//
+//	Version: Protocol version of the target (1 for legacy targets)
+//	Library: Implementation of the target (e.g. "go")
+//	Features: Supported protocol features (FeatureChunks, ...)
+//	Codecs: Codecs the target can decode
+//	Compressors: Compressors the target can decode
+//	Capabilities: Capabilities declared by the target (nil when none, see DeclareCapabilities())
+type PeerInfo struct {
+	Version      int           `json:"version"`
+	Library      string        `json:"library,omitempty"`
+	Features     []string      `json:"features,omitempty"`
+	Codecs       []string      `json:"codecs,omitempty"`
+	Compressors  []string      `json:"compression,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// Supports tells whether the target announced a feature
+//
+// Parameters:
+//
+//	feature: Feature name (FeatureChunks, ...)
+//
+// Returns:
+//
+//	bool: true if the feature was announced
+func (p *PeerInfo) Supports(feature string) bool {
+	return containsString(p.Features, feature)
+}
+
+// SupportsCodec tells whether the target can decode a codec
+func (p *PeerInfo) SupportsCodec(name string) bool {
+	return name == CodecJSON || containsString(p.Codecs, name)
+}
+
+// SupportsCompressor tells whether the target can decode a compressor
+func (p *PeerInfo) SupportsCompressor(name string) bool {
+	return containsString(p.Compressors, name)
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Build PeerInfo from a handshake message
+func parsePeerInfo(message map[string]interface{}) *PeerInfo {
+	stringList := func(value interface{}) []string {
+		list, _ := value.([]interface{})
+		result := []string{}
+		for _, item := range list {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+	version, _ := numberValue(message["version"])
+	library, _ := message["library"].(string)
+	return &PeerInfo{
+		Version:      int(version),
+		Library:      library,
+		Features:     stringList(message["features"]),
+		Codecs:       stringList(message["codecs"]),
+		Compressors:  stringList(message["compression"]),
+		Capabilities: parseCapabilities(message["capabilities"]),
+	}
+}
+
+// Protocol support of the targets already reached, by language and file
+var (
+	peersMu sync.RWMutex
+	peers   = map[string]*PeerInfo{}
+)
+
+func peerKey(language, file string) string {
+	return fmt.Sprintf("%s\x00%s", language, file)
+}
+
+// Get the protocol support of a target, nil when it was never reached
+func lookupPeer(language, file string) *PeerInfo {
+	peersMu.RLock()
+	defer peersMu.RUnlock()
+	return peers[peerKey(language, file)]
+}
+
+func storePeer(language, file string, peer *PeerInfo) {
+	// Custom transports without a file can't be told apart
+	if language == "" && file == "" {
+		return
+	}
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	peers[peerKey(language, file)] = peer
+}
+
+// Build the handshake message of the OutputManager
+func handshakeMessage(key string) map[string]interface{} {
+	codecsMu.RLock()
+	codecNames := []string{}
+	for name := range codecs {
+		codecNames = append(codecNames, name)
+	}
+	codecsMu.RUnlock()
+	sort.Strings(codecNames)
+
+	compressorsMu.RLock()
+	compressorNames := []string{}
+	for name := range compressors {
+		compressorNames = append(compressorNames, name)
+	}
+	compressorsMu.RUnlock()
+	sort.Strings(compressorNames)
+
+	message := map[string]interface{}{
+		"key":         key,
+		"channel":     ChannelHandshake,
+		"version":     ProtocolVersion,
+		"library":     "go",
+		"features":    protocolFeatures,
+		"codecs":      codecNames,
+		"compression": compressorNames,
+	}
+	if capabilities := currentCapabilities(); capabilities != nil {
+		message["capabilities"] = capabilities
+	}
+	return message
+}
+
+// Codecs picked by WithAutoNegotiation(), most compact first
+var codecPreference = []string{CodecMsgpack, CodecCBOR}
+
+// WithAutoNegotiation picks the best codec and compression for each target
+//
+// The target is offered every codec of the preference list (msgpack, then
+// CBOR, then JSON) and gzip for its outputs. Once its handshake is known
+// (after a first request), the request data is also encoded with the best
+// codec and compressor it supports. Targets that never answered a
+// handshake get plain JSON. Pass it only to the InputManagers of the
+// targets it should apply to.
+func WithAutoNegotiation() Option {
+	return func(im *InputManager) {
+		im.negotiate = true
+	}
+}
+
+// Pick the most compact codec supported by both sides, JSON when none
+func bestCodec(peer *PeerInfo) string {
+	for _, name := range codecPreference {
+		if _, ok := lookupCodec(name); ok && peer.SupportsCodec(name) {
+			return name
+		}
+	}
+	return CodecJSON
+}
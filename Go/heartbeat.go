@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultHeartbeatInterval is the delay between two heartbeats (10 seconds)
+const DefaultHeartbeatInterval = 10 * time.Second
+
+// Heartbeat sends heartbeats to the calling process until stopped
+//
+// Keeps the request alive during long computations that produce no
+// output, so inactivity timeouts of the calling process don't end it:
+//
+//	stop := Heartbeat(0)
+//	defer stop()
+//
+// Heartbeats are sent on ChannelHeartbeat to calling processes speaking
+// the versioned protocol only.
+//
+// Parameters:
+//
+//	interval: Delay between two heartbeats (0 = DefaultHeartbeatInterval)
+//
+// Returns:
+//
+//	func(): Stops the heartbeats, safe to call several times
+func (om *OutputManager) Heartbeat(interval time.Duration) func() {
+	if om == nil || om.data == "" || !om.versioned {
+		return func() {}
+	}
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				om.emitMessage(map[string]interface{}{
+					"key":     om.key,
+					"channel": ChannelHeartbeat,
+				})
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// Heartbeat calls Heartbeat() on the OutputManager created by Init()
+func Heartbeat(interval time.Duration) func() {
+	return autoOutputManager().Heartbeat(interval)
+}
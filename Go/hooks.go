@@ -0,0 +1,58 @@
+package main
+
+import "encoding/json"
+
+// MarshalFunc encodes a value to JSON (json.Marshal by default)
+//
+// Plug in a custom encoder to control how data is written: time.Time
+// layouts, decimal types, protojson, a faster JSON library, ...
+type MarshalFunc func(v interface{}) ([]byte, error)
+
+// UnmarshalFunc decodes JSON into a value (json.Unmarshal by default)
+type UnmarshalFunc func(data []byte, v interface{}) error
+
+// Marshal/unmarshal hooks of the OutputManager, see SetMarshaler()
+var (
+	outputMarshal   MarshalFunc   = json.Marshal
+	outputUnmarshal UnmarshalFunc = json.Unmarshal
+)
+
+// WithMarshaler replaces the JSON encoder and decoder of the data field
+//
+// The marshal function is used by Bundle() and Call() to encode request
+// data, the unmarshal function by Call() to decode the response.
+//
+// Parameters:
+//
+//	marshal: Custom encoder (nil keeps json.Marshal)
+//	unmarshal: Custom decoder (nil keeps json.Unmarshal)
+func WithMarshaler(marshal MarshalFunc, unmarshal UnmarshalFunc) Option {
+	return func(im *InputManager) {
+		if marshal != nil {
+			im.marshal = marshal
+		}
+		if unmarshal != nil {
+			im.unmarshal = unmarshal
+		}
+	}
+}
+
+// SetMarshaler replaces the JSON encoder and decoder of the OutputManager
+//
+// The marshal function is used by Bundle() to encode outputs, the
+// unmarshal function by GetData() to decode the request data.
+//
+// Parameters:
+//
+//	marshal: Custom encoder (nil restores json.Marshal)
+//	unmarshal: Custom decoder (nil restores json.Unmarshal)
+func SetMarshaler(marshal MarshalFunc, unmarshal UnmarshalFunc) {
+	if marshal == nil {
+		marshal = json.Marshal
+	}
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	outputMarshal = marshal
+	outputUnmarshal = unmarshal
+}
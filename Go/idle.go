@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrIdleTimeout reports a target stopped after being inactive for too long
+// (see WithIdleTimeout() and WithWriteTimeout())
+var ErrIdleTimeout = errors.New("Inactivity timeout")
+
+// WithIdleTimeout stops targets that stay silent for too long
+//
+// Unlike WithTimeout(), a target may run for as long as it needs as long
+// as it keeps writing: every message counts, heartbeats included, so long
+// computations can stay alive with Heartbeat(). A target silent for
+// longer than timeout without exiting is killed (see Killer) and the
+// request fails with ErrIdleTimeout.
+//
+// Parameters:
+//
+//	timeout: Longest time without a message from the target
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(im *InputManager) {
+		im.idleRead = timeout
+	}
+}
+
+// WithWriteTimeout stops targets that stop reading their input
+//
+// A write to the target (request, files, forwarded stdin) still blocked
+// after timeout, because the target doesn't read and its pipe is full,
+// kills it and the request fails with ErrIdleTimeout.
+//
+// Parameters:
+//
+//	timeout: Longest time a single write may block
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(im *InputManager) {
+		im.idleWrite = timeout
+	}
+}
+
+// Kills the target once it was inactive for too long, nil when there is
+// no timeout
+type idleWatch struct {
+	timer   *time.Timer
+	timeout time.Duration
+	mu      sync.Mutex
+	expired bool
+}
+
+// Start watching transport, armed right away or on the first arm()
+func watchIdle(timeout time.Duration, transport Transport, armed bool) *idleWatch {
+	if timeout <= 0 {
+		return nil
+	}
+	w := &idleWatch{timeout: timeout}
+	w.timer = time.AfterFunc(timeout, func() {
+		w.mu.Lock()
+		w.expired = true
+		w.mu.Unlock()
+		if killer, ok := transport.(Killer); ok {
+			killer.Kill()
+		}
+	})
+	if !armed {
+		w.timer.Stop()
+	}
+	return w
+}
+
+// Restart the countdown
+func (w *idleWatch) arm() {
+	if w != nil {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+func (w *idleWatch) disarm() {
+	if w != nil {
+		w.timer.Stop()
+	}
+}
+
+// Stop watching, tells whether the target was killed
+func (w *idleWatch) stop() bool {
+	if w == nil {
+		return false
+	}
+	w.timer.Stop()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.expired
+}
+
+// Time each write of send
+func (w *idleWatch) send(send func(message []byte) error) func(message []byte) error {
+	if w == nil {
+		return send
+	}
+	return func(message []byte) error {
+		w.arm()
+		defer w.disarm()
+		return send(message)
+	}
+}
+
+// Time the writes of what is read from r, not the reads themselves
+func (w *idleWatch) reader(r io.Reader) io.Reader {
+	if w == nil {
+		return r
+	}
+	return &idleReader{r: r, watch: w}
+}
+
+type idleReader struct {
+	r     io.Reader
+	watch *idleWatch
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	// The previous chunk was written
+	r.watch.disarm()
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.watch.arm()
+	}
+	return n, err
+}
@@ -0,0 +1,77 @@
+package main
+
+import "os"
+
+// RequestInfo describes the request being handled and where it comes from
+//
+// Fields:
+//
+//	Key: Unique key of the request
+//	Version: Protocol version of the calling process (1 for the original protocol)
+//	Transport: Transport used by the calling process ("process", "tcp", "http", "broker", "custom")
+//	ParentPID: PID of the calling process
+//	Method: Method of the request (see WithMethod())
+//	Meta: Metadata of the request (see WithMeta())
+//	CorrelationID: Correlation ID of the request (see WithCorrelationID())
+type RequestInfo struct {
+	Key           string            `json:"key"`
+	Version       int               `json:"version"`
+	Transport     string            `json:"transport,omitempty"`
+	ParentPID     int               `json:"parent_pid,omitempty"`
+	Method        string            `json:"method,omitempty"`
+	Meta          map[string]string `json:"meta,omitempty"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+}
+
+// Name of a transport, announced to the target
+func transportName(transport Transport) string {
+	switch t := transport.(type) {
+	case nil, *ProcessTransport:
+		return "process"
+	case *TCPTransport:
+		return "tcp"
+	case *HTTPTransport:
+		return "http"
+	case *BrokerTransport:
+		return "broker"
+	case *muxConversation:
+		return transportName(t.mux.transport)
+	}
+	return "custom"
+}
+
+// GetRequestInfo returns the correlation information of the request
+//
+// Calling processes speaking the original protocol only send the key, the
+// parent PID is then the one of the process that started the target.
+//
+// Returns:
+//
+//	RequestInfo: Key, protocol version, transport, parent PID, method, metadata and correlation ID
+func (om *OutputManager) GetRequestInfo() RequestInfo {
+	if om == nil {
+		return RequestInfo{}
+	}
+	info := RequestInfo{
+		Key:       om.key,
+		Version:   1,
+		Transport: om.transport,
+		ParentPID: om.parentPID,
+		Method:    om.method,
+		Meta:      om.GetMeta(),
+
+		CorrelationID: om.correlation,
+	}
+	if om.versioned {
+		info.Version = om.version
+	}
+	if info.ParentPID == 0 {
+		info.ParentPID = os.Getppid()
+	}
+	return info
+}
+
+// GetRequestInfo calls GetRequestInfo() on the OutputManager created by Init()
+func GetRequestInfo() RequestInfo {
+	return autoOutputManager().GetRequestInfo()
+}
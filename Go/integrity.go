@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IntegrityError reports a target whose content doesn't match its pinned hash
+//
+// Fields:
+//
+//	File: Path of the target
+//	Expected: Pinned SHA-256 (hex)
+//	Actual: SHA-256 of the file (hex)
+type IntegrityError struct {
+	File     string
+	Expected string
+	Actual   string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("Integrity check failed for %s: expected SHA-256 %s, got %s", e.File, e.Expected, e.Actual)
+}
+
+// WithChecksum pins the content of a target file
+//
+// The file is hashed right before it is run (before it is compiled with
+// WithCompile()), a different content fails with *IntegrityError. Call
+// it once per file, files without a pinned hash run unchecked.
+//
+// The hash covers the file as it was when it was read: the target is then
+// started (or compiled) from its path, a change made in between isn't
+// detected. Keep pinned files where only the calling user can write, see
+// WithStrictMode().
+//
+// Parameters:
+//
+//	file: Path of the target, symlinks resolved
+//	sum: Expected SHA-256 of the file (hex, e.g. from sha256sum)
+func WithChecksum(file, sum string) Option {
+	return func(im *InputManager) {
+		if im.checksums == nil {
+			im.checksums = make(map[string]string)
+		}
+		im.checksums[checksumKey(file)] = strings.ToLower(strings.TrimSpace(sum))
+	}
+}
+
+// Canonical path a checksum is pinned to
+func checksumKey(file string) string {
+	if resolved, err := filepath.EvalSymlinks(file); err == nil {
+		file = resolved
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	return file
+}
+
+// Check a target against its pinned hash, if any
+func (im *InputManager) verifyChecksum(file string) error {
+	expected, ok := im.checksums[checksumKey(file)]
+	if !ok {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return &IntegrityError{File: file, Expected: expected, Actual: actual}
+	}
+	return nil
+}
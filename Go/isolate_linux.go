@@ -0,0 +1,313 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Environment variable carrying the view built by isolate(), it turns
+// the calling program into the helper entering it before the target runs
+const isolateEnv = "MANGLE_ISOLATE"
+
+// System paths visible with IsolateFiles, when they exist
+var isolatedSystemPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+	"/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d", "/etc/alternatives",
+	"/etc/passwd", "/etc/group", "/etc/nsswitch.conf", "/etc/hosts", "/etc/resolv.conf",
+	"/etc/localtime", "/etc/ssl", "/etc/pki", "/etc/ca-certificates",
+}
+
+// prctl() options
+const (
+	prCapBSetDrop   = 24
+	prSetNoNewPrivs = 38
+)
+
+// Devices visible with IsolateFiles
+var isolatedDevices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom", "/dev/tty"}
+
+// Filesystem and limits of a target, applied by the helper (no Root
+// without IsolateFiles)
+type isolatedView struct {
+	Root      string         `json:"root,omitempty"`
+	Mounts    []isolatedPath `json:"mounts,omitempty"`
+	Dir       string         `json:"dir"`
+	Path      string         `json:"path"`
+	Args      []string       `json:"args"`
+	Uid       *uint32        `json:"uid,omitempty"`
+	Gid       *uint32        `json:"gid,omitempty"`
+	MaxMemory int64          `json:"max_memory,omitempty"`
+}
+
+type isolatedPath struct {
+	Source   string `json:"source"`
+	Writable bool   `json:"writable"`
+}
+
+// Make cmd start the helper applying the sandbox before the target runs
+//
+// The helper is the calling program itself, run again with isolateEnv set:
+// inside the namespaces of the Sandbox, it mounts the view on an empty
+// directory and enters it (IsolateFiles, see enterIsolatedView()), limits
+// its address space (MaxMemory) and executes the target. The limits are
+// in place before the first instruction of the target.
+func (s *Sandbox) isolate(cmd *exec.Cmd, file string, extra []string) (func(), error) {
+	if !s.IsolateFiles && s.MaxMemory <= 0 {
+		return func() {}, nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	view := isolatedView{Path: cmd.Path, Args: cmd.Args, MaxMemory: s.MaxMemory}
+	view.Dir, _ = os.Getwd()
+	if !s.IsolateFiles {
+		spec, _ := json.Marshal(view)
+		cmd.Path = self
+		cmd.Env = append(cmd.Env, isolateEnv+"="+string(spec))
+		return func() {}, nil
+	}
+	root, err := os.MkdirTemp("", "mangledotdev-root-")
+	if err != nil {
+		return nil, err
+	}
+	view.Root = root
+
+	seen := map[string]bool{}
+	add := func(path string, writable bool) {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return
+		}
+		// Symlinks are recreated in the view, their target must be there too
+		paths := []string{path}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil && resolved != path {
+			paths = append(paths, resolved)
+		}
+		for _, p := range paths {
+			if _, err := os.Lstat(p); err == nil && !seen[p] {
+				seen[p] = true
+				view.Mounts = append(view.Mounts, isolatedPath{Source: p, Writable: writable})
+			}
+		}
+	}
+	for _, path := range isolatedSystemPaths {
+		add(path, false)
+	}
+	// The installation the interpreter belongs to (venv, nvm, pyenv, ...)
+	executables := []string{cmd.Path}
+	if resolved, err := filepath.EvalSymlinks(cmd.Path); err == nil {
+		executables = append(executables, resolved)
+	}
+	for _, path := range executables {
+		dir := filepath.Dir(path)
+		switch filepath.Base(dir) {
+		case "bin", "sbin", "shims":
+			dir = filepath.Dir(dir)
+		}
+		if dir != "/" {
+			add(dir, false)
+		}
+	}
+	if file != "" {
+		add(filepath.Dir(file), false)
+	}
+	for _, dir := range append(append([]string{}, s.ReadOnlyDirs...), extra...) {
+		add(dir, false)
+	}
+	for _, dir := range s.WritableDirs {
+		add(dir, true)
+	}
+	// Parents are mounted first, what they already show is left out
+	sort.SliceStable(view.Mounts, func(i, j int) bool {
+		return len(view.Mounts[i].Source) < len(view.Mounts[j].Source)
+	})
+	mounts := []isolatedPath{}
+	for _, mount := range view.Mounts {
+		shown := false
+		for _, parent := range mounts {
+			if insideDir(parent.Source, mount.Source) && (parent.Writable || !mount.Writable) {
+				shown = true
+				break
+			}
+		}
+		if !shown {
+			mounts = append(mounts, mount)
+		}
+	}
+	view.Mounts = mounts
+
+	// The helper must be root of the user namespace to mount the view, it
+	// then drops to the user of WithUser() or gives up its capabilities
+	attr := cmd.SysProcAttr
+	uid, gid := os.Getuid(), os.Getgid()
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}}
+	if credential := attr.Credential; credential != nil {
+		if credential.Uid != 0 {
+			attr.UidMappings = append(attr.UidMappings, syscall.SysProcIDMap{ContainerID: int(credential.Uid), HostID: int(credential.Uid), Size: 1})
+		}
+		if credential.Gid != 0 {
+			attr.GidMappings = append(attr.GidMappings, syscall.SysProcIDMap{ContainerID: int(credential.Gid), HostID: int(credential.Gid), Size: 1})
+		}
+		view.Uid = &credential.Uid
+		view.Gid = &credential.Gid
+		attr.Credential = nil
+	}
+
+	spec, _ := json.Marshal(view)
+	cmd.Path = self
+	cmd.Env = append(cmd.Env, isolateEnv+"="+string(spec))
+	return func() { os.Remove(root) }, nil
+}
+
+// Run as the helper of isolate() when isolateEnv is set
+func init() {
+	spec := os.Getenv(isolateEnv)
+	if spec == "" {
+		return
+	}
+	// Capabilities are dropped for the thread running the target
+	runtime.LockOSThread()
+	var view isolatedView
+	err := json.Unmarshal([]byte(spec), &view)
+	if err == nil && view.Root != "" {
+		err = enterIsolatedView(&view)
+	}
+	if err == nil && view.MaxMemory > 0 {
+		// Kept across exec, the target starts with it
+		err = syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: uint64(view.MaxMemory), Max: uint64(view.MaxMemory)})
+	}
+	if err == nil {
+		env := []string{}
+		for _, entry := range os.Environ() {
+			if !strings.HasPrefix(entry, isolateEnv+"=") {
+				env = append(env, entry)
+			}
+		}
+		err = syscall.Exec(view.Path, view.Args, env)
+	}
+	fmt.Fprintf(os.Stderr, "Failed to isolate process: %s\n", err.Error())
+	os.Exit(126)
+}
+
+// Mount the view on its root and enter it
+func enterIsolatedView(view *isolatedView) error {
+	// Nothing mounted here may reach the calling process
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", view.Root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+		return err
+	}
+
+	proc := filepath.Join(view.Root, "proc")
+	tmp := filepath.Join(view.Root, "tmp")
+	os.MkdirAll(proc, 0555)
+	os.MkdirAll(tmp, 0755)
+	if err := syscall.Mount("proc", proc, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("/proc: %s", err.Error())
+	}
+	if err := syscall.Mount("tmpfs", tmp, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("/tmp: %s", err.Error())
+	}
+	for _, device := range isolatedDevices {
+		if _, err := os.Stat(device); err == nil {
+			if err := bindIsolatedPath(view.Root, device, true); err != nil {
+				return fmt.Errorf("%s: %s", device, err.Error())
+			}
+		}
+	}
+	for _, mount := range view.Mounts {
+		if err := bindIsolatedPath(view.Root, mount.Source, mount.Writable); err != nil {
+			return fmt.Errorf("%s: %s", mount.Source, err.Error())
+		}
+	}
+	// Relative paths of the command resolve from the same directory
+	if view.Dir != "" {
+		os.MkdirAll(filepath.Join(view.Root, view.Dir), 0755)
+	}
+	if err := syscall.Mount("", view.Root, "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return err
+	}
+
+	if err := syscall.Chroot(view.Root); err != nil {
+		return err
+	}
+	if view.Dir == "" || syscall.Chdir(view.Dir) != nil {
+		if err := syscall.Chdir("/"); err != nil {
+			return err
+		}
+	}
+	// Without a capability left, the target can't undo the view
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return errno
+	}
+	if view.Uid == nil {
+		for capability := uintptr(0); capability <= 63; capability++ {
+			if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapBSetDrop, capability, 0); errno == syscall.EINVAL {
+				break
+			}
+		}
+		return nil
+	}
+	if err := syscall.Setgid(int(*view.Gid)); err != nil {
+		return err
+	}
+	return syscall.Setuid(int(*view.Uid))
+}
+
+// Make source visible at the same path below root
+func bindIsolatedPath(root, source string, writable bool) error {
+	target := filepath.Join(root, source)
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		os.MkdirAll(filepath.Dir(target), 0755)
+		return os.Symlink(link, target)
+	}
+	if info.IsDir() {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+	} else {
+		os.MkdirAll(filepath.Dir(target), 0755)
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	if err := syscall.Mount(source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	if writable {
+		return nil
+	}
+	// The flags locked on the original mount must be kept
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(target, &stat); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+	flags |= uintptr(stat.Flags) & (syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC | syscall.MS_NOATIME | syscall.MS_NODIRATIME)
+	if stat.Flags&4096 != 0 {
+		flags |= syscall.MS_RELATIME
+	}
+	return syscall.Mount("", target, "", flags, "")
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// CommandFunc builds the command running a file of a registered language
+//
+// Parameters:
+//
+//	file: Path of the target file (checked to exist)
+//
+// Returns:
+//
+//	[]string: Command array for subprocess, e.g. {"racket", file}
+//	error: File that can't be run
+type CommandFunc func(file string) ([]string, error)
+
+// Entry of the language table
+//
+// Fields:
+//
+//	name: Main name of the language (the first one registered)
+//	extensions: Accepted extensions ("" for none), nil accepts any file
+//	compiled: Files are executables (checked executable, run with ./ prefix)
+//	tools: Runtimes running its files, any of them is enough (see Probe())
+//	subcommands: Subcommands of its runtimes (e.g. "run"), WithRuntimeArgs() arguments go after them
+//	command: Builds the command from the checked file
+type languageSpec struct {
+	name        string
+	extensions  []string
+	compiled    bool
+	tools       []string
+	subcommands []string
+	command     func(im *InputManager, language, file string, info os.FileInfo) ([]string, error)
+}
+
+// Language table used by getCommand(), by upper-case name
+var (
+	languagesMu sync.RWMutex
+	languages   = map[string]*languageSpec{}
+)
+
+// RegisterLanguage adds a language to the table used by Request()
+//
+// Registering an existing name replaces it, so built-in languages can be
+// customized too. WithInterpreter() and WithRuntimeArgs() apply to
+// commands of more than one element, e.g.:
+//
+//	RegisterLanguage("racket", []string{".rkt"}, func(file string) ([]string, error) {
+//		return []string{"racket", file}, nil
+//	})
+//
+// Parameters:
+//
+//	name: Language name as passed to Request() (case-insensitive)
+//	extensions: Accepted file extensions (e.g. ".rkt"), nil accepts any file
+//	command: Builds the command running a file
+func RegisterLanguage(name string, extensions []string, command CommandFunc) {
+	registerLanguage([]string{name}, &languageSpec{
+		extensions: lowerStrings(extensions),
+		command: func(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+			return command(file)
+		},
+	})
+}
+
+func registerLanguage(names []string, spec *languageSpec) {
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+	spec.name = strings.ToUpper(names[0])
+	for _, name := range names {
+		languages[strings.ToUpper(name)] = spec
+	}
+}
+
+func lookupLanguage(name string) (*languageSpec, bool) {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+	spec, ok := languages[strings.ToUpper(name)]
+	return spec, ok
+}
+
+func lowerStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = strings.ToLower(value)
+	}
+	return result
+}
+
+// Get where the WithRuntimeArgs() arguments go in a command of the language
+//
+// They follow the interpreter, or its subcommand when it has one (deno run,
+// go run, ...), so they reach the runtime rather than the target.
+func (spec *languageSpec) runtimeArgsAt(cmd []string) int {
+	if len(cmd) > 2 {
+		for _, subcommand := range spec.subcommands {
+			if cmd[1] == subcommand {
+				return 2
+			}
+		}
+	}
+	return 1
+}
+
+// Command running the file with a fixed interpreter
+func interpreted(interpreter ...string) func(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	return func(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+		return append(append([]string{}, interpreter...), file), nil
+	}
+}
+
+// Command running the file itself
+func executable(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	return []string{file}, nil
+}
+
+func init() {
+	registerLanguage([]string{"PYTHON", "PY"}, &languageSpec{extensions: []string{".py"}, tools: []string{"python"}, command: interpreted("python")})
+	registerLanguage([]string{"JAVASCRIPT", "JS", "NODE", "NODEJS"}, &languageSpec{extensions: []string{".js"}, tools: []string{"node"}, command: interpreted("node")})
+	registerLanguage([]string{"RUBY", "RB"}, &languageSpec{extensions: []string{".rb"}, tools: []string{"ruby"}, command: interpreted("ruby")})
+	registerLanguage([]string{"C"}, &languageSpec{extensions: []string{".c", ".out", ".exe", ""}, compiled: true, command: executable})
+	registerLanguage([]string{"CS", "C#", "CSHARP"}, &languageSpec{extensions: []string{".exe", ".dll", ""}, compiled: true, command: executable})
+	registerLanguage([]string{"CPP", "C++", "CPLUSPLUS", "EXE"}, &languageSpec{extensions: []string{".cpp", ".cc", ".cxx", ".out", ".exe", ""}, compiled: true, command: executable})
+	registerLanguage([]string{"JAR"}, &languageSpec{extensions: []string{".jar"}, tools: []string{"java"}, command: interpreted("java", "-jar")})
+	registerLanguage([]string{"JAVA"}, &languageSpec{extensions: []string{".jar", ".java", ".class"}, tools: []string{"java"}, command: javaCommand})
+	registerLanguage([]string{"RUST", "RS"}, &languageSpec{extensions: []string{".rs", ".exe", ".out", ""}, compiled: true, command: executable})
+	registerLanguage([]string{"GO"}, &languageSpec{extensions: []string{".go", ".exe", ".out", ""}, compiled: true, tools: []string{"go"}, subcommands: []string{"run"}, command: goCommand})
+	registerLanguage([]string{"GOLANG"}, &languageSpec{extensions: []string{".go", ".exe", ".out", ""}, compiled: true, tools: []string{"go"}, subcommands: []string{"run"}, command: interpreted("go", "run")})
+	registerLanguage([]string{"PHP"}, &languageSpec{extensions: []string{".php"}, tools: []string{"php"}, command: interpreted("php")})
+	registerLanguage([]string{"LUA"}, &languageSpec{extensions: []string{".lua"}, tools: []string{"lua"}, command: interpreted("lua")})
+	registerLanguage([]string{"PERL", "PL"}, &languageSpec{extensions: []string{".pl"}, tools: []string{"perl"}, command: interpreted("perl")})
+	// TypeScript runs without build step, WithInterpreter() picks the runner
+	registerLanguage([]string{"TYPESCRIPT", "TS"}, &languageSpec{extensions: []string{".ts", ".mts", ".cts"}, tools: []string{"tsx"}, command: interpreted("tsx")})
+	registerLanguage([]string{"DENO"}, &languageSpec{extensions: []string{".ts", ".tsx", ".js", ".jsx", ".mjs"}, tools: []string{"deno"}, subcommands: []string{"run"}, command: interpreted("deno", "run")})
+	registerLanguage([]string{"SHELL"}, &languageSpec{extensions: []string{".sh", ""}, tools: []string{"bash", "sh"}, command: shellCommand})
+	registerLanguage([]string{"BASH"}, &languageSpec{extensions: []string{".sh", ".bash", ""}, tools: []string{"bash", "sh"}, command: shellCommand})
+	registerLanguage([]string{"SH"}, &languageSpec{extensions: []string{".sh", ""}, tools: []string{"sh"}, command: shellCommand})
+	registerLanguage([]string{"R", "RSCRIPT"}, &languageSpec{extensions: []string{".r"}, tools: []string{"Rscript"}, command: interpreted("Rscript")})
+	registerLanguage([]string{"JULIA", "JL"}, &languageSpec{extensions: []string{".jl"}, tools: []string{"julia"}, command: interpreted("julia")})
+	registerLanguage([]string{"KOTLIN", "KT"}, &languageSpec{extensions: []string{".jar", ".kts"}, tools: []string{"kotlin", "kotlinc"}, command: kotlinCommand})
+	registerLanguage([]string{"SCALA"}, &languageSpec{extensions: []string{".jar", ".sc", ".scala"}, tools: []string{"scala-cli", "scala"}, subcommands: []string{"run"}, command: scalaCommand})
+	registerLanguage([]string{"SWIFT"}, &languageSpec{extensions: []string{".swift", ".out", ".exe", ""}, tools: []string{"swift"}, subcommands: []string{"run"}, command: swiftCommand})
+	registerLanguage([]string{"DOTNET"}, &languageSpec{extensions: []string{".dll", ".csproj", ".fsproj", ".vbproj"}, tools: []string{"dotnet"}, subcommands: []string{"run"}, command: dotnetCommand})
+	registerLanguage([]string{"HASKELL", "HS"}, &languageSpec{extensions: []string{".hs", ".lhs", ".exe", ".out", ""}, tools: []string{"runghc", "stack", "runhaskell"}, subcommands: []string{"runghc"}, command: haskellCommand})
+	registerLanguage([]string{"ELIXIR", "EX"}, &languageSpec{extensions: []string{".exs", ".ex"}, tools: []string{"elixir"}, command: interpreted("elixir")})
+	registerLanguage([]string{"ERLANG", "ERL"}, &languageSpec{extensions: []string{".escript", ".erl", ""}, tools: []string{"escript"}, command: interpreted("escript")})
+	// WebAssembly modules are sandboxed by the WASI runtime, stdin/stdout only
+	registerLanguage([]string{"WASM", "WASI"}, &languageSpec{extensions: []string{".wasm", ".wat"}, tools: []string{"wasmtime", "wasmer", "wazero"}, subcommands: []string{"run"}, command: wasmCommand})
+}
+
+// Go sources run with go run, anything else is a compiled executable
+func goCommand(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	if strings.ToLower(filepath.Ext(file)) == ".go" {
+		return []string{"go", "run", file}, nil
+	}
+	return []string{file}, nil
+}
+
+// Executable scripts with a shebang run directly unless an interpreter is set
+func shellCommand(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	shell := "sh"
+	if language != "SH" {
+		shell = resolveInterpreter("bash", "sh")
+	}
+	_, forced := im.interpreter[language]
+	if !forced && runtime.GOOS != "windows" && info.Mode()&0111 != 0 && hasShebang(file) {
+		if !filepath.IsAbs(file) && !strings.HasPrefix(file, "./") {
+			file = "./" + file
+		}
+		return []string{file}, nil
+	}
+	return []string{shell, file}, nil
+}
+
+// Kotlin scripts run with the kotlin launcher, or kotlinc when it is missing
+func kotlinCommand(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	if strings.ToLower(filepath.Ext(file)) == ".jar" {
+		return []string{"java", "-jar", file}, nil
+	}
+	if launcher := resolveInterpreter("kotlin", "kotlinc"); launcher == "kotlinc" {
+		return []string{"kotlinc", "-script", file}, nil
+	}
+	return []string{"kotlin", file}, nil
+}
+
+// Scala sources run with scala-cli, or the scala launcher when it is missing
+func scalaCommand(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	if strings.ToLower(filepath.Ext(file)) == ".jar" {
+		return []string{"java", "-jar", file}, nil
+	}
+	if launcher := resolveInterpreter("scala-cli", "scala"); launcher == "scala-cli" {
+		return []string{"scala-cli", "run", file}, nil
+	}
+	return []string{"scala", file}, nil
+}
+
+// Swift sources run as scripts, Package.swift runs its package
+func swiftCommand(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	if filepath.Base(file) == "Package.swift" {
+		return []string{"swift", "run", "--package-path", filepath.Dir(file)}, nil
+	}
+	if strings.ToLower(filepath.Ext(file)) == ".swift" {
+		return []string{"swift", file}, nil
+	}
+	path, err := executablePath(file, info)
+	if err != nil {
+		return nil, err
+	}
+	return []string{path}, nil
+}
+
+// Haskell sources run with runghc (through stack when only stack is installed)
+func haskellCommand(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	if ext := strings.ToLower(filepath.Ext(file)); ext == ".hs" || ext == ".lhs" {
+		if runner := resolveInterpreter("runghc", "stack", "runhaskell"); runner != "stack" {
+			return []string{runner, file}, nil
+		}
+		return []string{"stack", "runghc", file}, nil
+	}
+	path, err := executablePath(file, info)
+	if err != nil {
+		return nil, err
+	}
+	return []string{path}, nil
+}
+
+// WebAssembly modules run with the first WASI runtime installed
+func wasmCommand(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	return []string{resolveInterpreter("wasmtime", "wasmer", "wazero"), "run", file}, nil
+}
+
+// Framework-dependent apps need their runtimeconfig, projects are built first
+func dotnetCommand(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	if strings.ToLower(filepath.Ext(file)) != ".dll" {
+		return []string{"dotnet", "run", "--project", file}, nil
+	}
+	config := strings.TrimSuffix(file, filepath.Ext(file)) + ".runtimeconfig.json"
+	if _, err := os.Stat(config); err != nil {
+		return nil, fmt.Errorf("Not a runnable .NET app: %s not found (libraries can't be run, publish the app project)", filepath.Base(config))
+	}
+	return []string{"dotnet", file}, nil
+}
+
+// Java sources run as single-file programs, classes from the classpath
+func javaCommand(im *InputManager, language, file string, info os.FileInfo) ([]string, error) {
+	classpath := im.classpath
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".jar":
+		return []string{"java", "-jar", file}, nil
+	case ".class":
+		className, entry := javaClassName(file, im.classpath)
+		if len(classpath) == 0 {
+			classpath = []string{entry}
+		}
+		return []string{"java", "-cp", strings.Join(classpath, string(os.PathListSeparator)), className}, nil
+	}
+	if len(classpath) > 0 {
+		return []string{"java", "-cp", strings.Join(classpath, string(os.PathListSeparator)), file}, nil
+	}
+	return []string{"java", file}, nil
+}
+
+// Add JVM options to a command launching the JVM, as each launcher expects them
+func jvmCommand(cmd []string, options []string) []string {
+	if len(options) == 0 || len(cmd) < 2 {
+		return cmd
+	}
+	result := []string{cmd[0]}
+	switch strings.TrimSuffix(filepath.Base(cmd[0]), ".exe") {
+	case "java":
+		result = append(result, options...)
+		return append(result, cmd[1:]...)
+	case "scala-cli":
+		result = append(result, cmd[1:len(cmd)-1]...)
+		for _, option := range options {
+			result = append(result, "--java-opt", option)
+		}
+		return append(result, cmd[len(cmd)-1])
+	case "kotlin", "kotlinc", "scala":
+		for _, option := range options {
+			result = append(result, "-J"+option)
+		}
+		return append(result, cmd[1:]...)
+	}
+	return cmd
+}
+
+// Check a compiled executable and get the path to run it with
+func executablePath(file string, info os.FileInfo) (string, error) {
+	if runtime.GOOS != "windows" && info.Mode()&0111 == 0 {
+		return "", fmt.Errorf("File is not executable: %s", file)
+	}
+	if !filepath.IsAbs(file) && !strings.HasPrefix(file, "./") && !strings.HasPrefix(file, ".\\") {
+		file = "./" + file
+	}
+	return file, nil
+}
+
+// Get the name of the class compiled in file and the classpath entry holding it
+//
+// The class is looked up in the classpath entries containing the file
+// (com/example/Main.class in build/ is com.example.Main), without them it
+// is in the default package of its directory.
+func javaClassName(file string, classpath []string) (string, string) {
+	absFile, _ := filepath.Abs(file)
+	for _, entry := range classpath {
+		absEntry, _ := filepath.Abs(entry)
+		if rel, err := filepath.Rel(absEntry, absFile); err == nil && !strings.HasPrefix(rel, "..") {
+			return strings.ReplaceAll(strings.TrimSuffix(filepath.ToSlash(rel), ".class"), "/", "."), entry
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(file), ".class"), filepath.Dir(file)
+}
+
+// Tell whether dotnet failed because the framework of the app is missing
+func missingDotnetFramework(stderr string) bool {
+	return strings.Contains(stderr, "You must install or update .NET") ||
+		(strings.Contains(stderr, "The framework '") && strings.Contains(stderr, "was not found"))
+}
+
+// Tell whether a file starts with a shebang line (#!)
+func hasShebang(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 2)
+	n, _ := io.ReadFull(f, head)
+	return n == 2 && string(head) == "#!"
+}
+
+// Get the first interpreter of names found in PATH, the first name when none is
+func resolveInterpreter(names ...string) string {
+	for _, name := range names {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return names[0]
+}
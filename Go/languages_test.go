@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRuntimeArgs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.ts")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	im := NewInputManager(WithInterpreter("deno", "sh"), WithRuntimeArgs("deno", "--allow-read", "--allow-net=api.example.com"))
+	cmd, err := im.getCommand("deno", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sh", "run", "--allow-read", "--allow-net=api.example.com", file}; !reflect.DeepEqual(cmd, want) {
+		t.Errorf("expected %q, got %q", want, cmd)
+	}
+
+	// Other languages keep their command
+	cmd, err = NewInputManager(WithInterpreter("deno", "sh"), WithRuntimeArgs("julia", "--project")).getCommand("deno", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sh", "run", file}; !reflect.DeepEqual(cmd, want) {
+		t.Errorf("expected %q, got %q", want, cmd)
+	}
+}
+
+func TestRuntimeArgsPlacement(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.ts", "model.jl", "app.csproj"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		language string
+		file     string
+		args     []string
+		want     []string
+	}{
+		{"deno", "main.ts", []string{"--allow-read"}, []string{"deno", "run", "--allow-read", "main.ts"}},
+		{"julia", "model.jl", []string{"--project=/srv"}, []string{"julia", "--project=/srv", "model.jl"}},
+		{"dotnet", "app.csproj", []string{"-c", "Release"}, []string{"dotnet", "run", "-c", "Release", "--project", "app.csproj"}},
+	}
+	for _, c := range cases {
+		file := filepath.Join(dir, c.file)
+		// The container transport leaves the runtimes to the image
+		im := NewInputManager(WithTransport(NewContainerTransport("image")), WithRuntimeArgs(c.language, c.args...))
+		cmd, err := im.getCommand(c.language, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := append([]string{}, c.want...)
+		want[len(want)-1] = file
+		if !reflect.DeepEqual(cmd, want) {
+			t.Errorf("%s: expected %q, got %q", c.language, want, cmd)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"time"
+)
+
+// HookInfo identifies the request a hook is called for
+//
+// Fields:
+//
+//	Key: Key of the request
+//	Language: Target language as passed to Request()
+//	File: Target file as passed to Request()
+//	CorrelationID: See WithCorrelationID()
+type HookInfo struct {
+	Key           string
+	Language      string
+	File          string
+	CorrelationID string
+}
+
+// Hooks are called as a request goes, e.g. for monitoring or a UI
+//
+// Nil hooks are skipped. OnStderr is called from the goroutine reading
+// stderr, the others from the one calling Request().
+//
+// Fields:
+//
+//	OnStart: The target was started, with its process ID (0 without a local process)
+//	OnOutput: An output was received, with its data as JSON
+//	OnStderr: The target wrote to stderr (ProcessTransport only)
+//	OnExit: The target ended, with its exit code (-1 when unknown) and why it failed (nil on success)
+//	OnSlow: The request took longer than WithSlowThreshold(), with its duration
+type Hooks struct {
+	OnStart  func(info HookInfo, pid int)
+	OnOutput func(info HookInfo, data json.RawMessage)
+	OnStderr func(info HookInfo, chunk []byte)
+	OnExit   func(info HookInfo, code int, err error)
+	OnSlow   func(info HookInfo, duration time.Duration)
+}
+
+// WithHooks calls hooks as the requests of the InputManager go
+//
+// Parameters:
+//
+//	hooks: Functions to call
+func WithHooks(hooks Hooks) Option {
+	return func(im *InputManager) {
+		im.hooks = &hooks
+	}
+}
+
+// Get the process started by a transport, nil when it didn't start one
+func transportProcess(transport Transport) *exec.Cmd {
+	if spawner, ok := transport.(interface{ process() (*exec.Cmd, string) }); ok {
+		cmd, _ := spawner.process()
+		return cmd
+	}
+	return nil
+}
+
+func (im *InputManager) hookStart(transport Transport) {
+	if im.hooks == nil || im.hooks.OnStart == nil {
+		return
+	}
+	pid := 0
+	if cmd := transportProcess(transport); cmd != nil && cmd.Process != nil {
+		pid = cmd.Process.Pid
+	}
+	im.hooks.OnStart(im.info, pid)
+}
+
+func (im *InputManager) hookOutput(data interface{}) {
+	if im.hooks == nil || im.hooks.OnOutput == nil {
+		return
+	}
+	dataBytes, _ := json.Marshal(data)
+	im.hooks.OnOutput(im.info, json.RawMessage(dataBytes))
+}
+
+func (im *InputManager) hookExit(transport Transport, err error) {
+	if im.hooks == nil || im.hooks.OnExit == nil {
+		return
+	}
+	im.hooks.OnExit(im.info, exitCode(transport, err), err)
+}
+
+// Stderr writer copying each chunk to WithStderr() and OnStderr
+func (im *InputManager) stderrHook() func(chunk []byte) {
+	var onStderr func(info HookInfo, chunk []byte)
+	if im.hooks != nil {
+		onStderr = im.hooks.OnStderr
+	}
+	if onStderr == nil && im.stderr == nil {
+		return nil
+	}
+	info, w := im.info, im.stderr
+	return func(chunk []byte) {
+		if w != nil {
+			w.Write(chunk)
+		}
+		if onStderr != nil {
+			onStderr(info, append([]byte{}, chunk...))
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SizeLimitError reports a request or response larger than allowed
+//
+// Fields:
+//
+//	Direction: "request" or "response"
+//	Limit: Largest size allowed, in bytes
+//	Size: Size reached when the limit was exceeded, in bytes
+type SizeLimitError struct {
+	Direction string
+	Limit     int64
+	Size      int64
+}
+
+func (e *SizeLimitError) Error() string {
+	if e.Direction == "request" {
+		return fmt.Sprintf("Request too large: %d bytes (limit: %d)", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("Response too large: more than %d bytes", e.Limit)
+}
+
+// WithMaxRequestSize refuses requests larger than size
+//
+// The request (data, fields and envelope) is measured before the target
+// is started, a larger one fails with *SizeLimitError.
+//
+// Parameters:
+//
+//	size: Largest request in bytes
+func WithMaxRequestSize(size int64) Option {
+	return func(im *InputManager) {
+		im.maxRequest = size
+	}
+}
+
+// WithMaxResponseSize stops targets sending more than size
+//
+// Everything the target writes counts (outputs, files, side-channel
+// messages), compressed data counts once decompressed, and its stderr is
+// cut at size. Once the limit is exceeded
+// the target is stopped and the request fails with *SizeLimitError, so a
+// target can't exhaust the memory of the calling process.
+//
+// Parameters:
+//
+//	size: Largest response in bytes
+func WithMaxResponseSize(size int64) Option {
+	return func(im *InputManager) {
+		im.maxResponse = size
+	}
+}
+
+// Buffer dropping what is written past its limit
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(b.buf.Len()); room < int64(len(p)) {
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// Output line whose data is gzip compressed
+func compressedOutputLine(t *testing.T, key string, data []byte) []byte {
+	compressed, err := gzipCompressor{}.Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(fmt.Sprintf(`{"key":%q,"request_status":true,"data":%q,"compression":"gzip","optionalOutput":false,"isUnique":true,"errors":[],"warnings":[]}`, key, base64.StdEncoding.EncodeToString(compressed)))
+}
+
+func TestDecompressedResponseLimit(t *testing.T) {
+	// A few KB on the wire, 4 MB once decompressed
+	data := append(append([]byte(`"`), bytes.Repeat([]byte("a"), 4<<20)...), '"')
+	transport := &scriptedTransport{lines: func(requestKey string) [][]byte {
+		return [][]byte{compressedOutputLine(t, requestKey, data)}
+	}}
+	im := NewInputManager(WithTransport(transport), WithCompression(CompressionGzip, 0), WithMaxResponseSize(64<<10))
+	im.Request(true, false, "1", "", "")
+
+	var limitErr *SizeLimitError
+	if !errors.As(im.Err(), &limitErr) || limitErr.Limit != 64<<10 {
+		t.Fatalf("expected a response SizeLimitError, got %v", im.Err())
+	}
+	if im.Response.RequestStatus || len(im.Response.Errors) != 1 {
+		t.Errorf("expected the request to fail once, got %+v", im.Response.Errors)
+	}
+}
+
+func TestCompressedResponseWithinLimit(t *testing.T) {
+	transport := &scriptedTransport{lines: func(requestKey string) [][]byte {
+		return [][]byte{compressedOutputLine(t, requestKey, []byte(`[1,2,3]`))}
+	}}
+	im := NewInputManager(WithTransport(transport), WithCompression(CompressionGzip, 0), WithMaxResponseSize(64<<10))
+	im.Request(true, false, "1", "", "")
+
+	if !im.Response.RequestStatus || im.Err() != nil {
+		t.Fatalf("request failed: %v %+v", im.Err(), im.Response.Errors)
+	}
+}
+
+func TestUnofferedCompressionRejected(t *testing.T) {
+	transport := &scriptedTransport{lines: func(requestKey string) [][]byte {
+		return [][]byte{compressedOutputLine(t, requestKey, []byte(`[1,2,3]`))}
+	}}
+	im := NewInputManager(WithTransport(transport))
+	im.Request(true, false, "1", "", "")
+
+	if im.Response.RequestStatus {
+		t.Errorf("compressed data accepted without being offered: %+v", im.Response)
+	}
+}
+
+func TestTCPTransportMaxReceive(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write(bytes.Repeat([]byte("x"), 1<<20))
+	}()
+
+	transport := NewTCPTransport(listener.Addr().String(), nil)
+	transport.MaxReceive = 4096
+	if err := transport.Open(Target{}); err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	var limitErr *SizeLimitError
+	if _, err := transport.Receive(); !errors.As(err, &limitErr) {
+		t.Fatalf("expected a SizeLimitError for an endless line, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Log levels
+const (
+	LogDebug = "debug"
+	LogInfo  = "info"
+	LogWarn  = "warn"
+	LogError = "error"
+)
+
+// LogEntry is a log line written by the target with Log()
+//
+// Fields:
+//
+//	Time: Timestamp (RFC 3339)
+//	Level: Log level (LogDebug, LogInfo, LogWarn, LogError)
+//	Message: Log message
+//	Fields: Structured context
+//	CorrelationID: Correlation ID of the request being handled (see WithCorrelationID())
+type LogEntry struct {
+	Time          string                 `json:"time"`
+	Level         string                 `json:"level"`
+	Message       string                 `json:"msg"`
+	Fields        map[string]interface{} `json:"fields,omitempty"`
+	CorrelationID string                 `json:"correlation_id,omitempty"`
+}
+
+// Marker of log lines among the other stderr output
+const logMarker = "mangle_log"
+
+// WithLogs collects the lines the target writes with Log() into Response.Logs
+//
+// Only transports exposing the target stderr support it (ProcessTransport,
+// ContainerTransport).
+func WithLogs() Option {
+	return func(im *InputManager) {
+		im.collectLogs = true
+	}
+}
+
+// Extract the Log() lines of a stderr output
+func parseLogs(stderr string) []LogEntry {
+	entries := []LogEntry{}
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var record struct {
+			Marker bool `json:"mangle_log"`
+			LogEntry
+		}
+		if json.Unmarshal([]byte(line), &record) == nil && record.Marker {
+			entries = append(entries, record.LogEntry)
+		}
+	}
+	return entries
+}
+
+// Log writes a structured log line to stderr
+//
+// stdout carries the protocol, so logs never go there. The calling
+// process may collect them with WithLogs().
+//
+// Parameters:
+//
+//	level: Log level (LogDebug, LogInfo, LogWarn, LogError)
+//	message: Log message
+//	fields: Context as alternating keys and values (e.g. "rows", 12)
+func Log(level, message string, fields ...interface{}) {
+	record := map[string]interface{}{
+		logMarker: true,
+		"time":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level":   level,
+		"msg":     message,
+	}
+	if len(fields) > 0 {
+		context := make(map[string]interface{})
+		for i := 0; i < len(fields); i += 2 {
+			name := fmt.Sprint(fields[i])
+			if i+1 < len(fields) {
+				context[name] = fields[i+1]
+			} else {
+				context[name] = nil
+			}
+		}
+		record["fields"] = context
+	}
+	if owner := globalOutputManager; owner != nil && owner.correlation != "" {
+		record["correlation_id"] = owner.correlation
+	}
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		recordBytes, _ = json.Marshal(map[string]interface{}{
+			logMarker: true,
+			"time":    record["time"],
+			"level":   level,
+			"msg":     message,
+		})
+	}
+	fmt.Fprintln(os.Stderr, string(recordBytes))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Logger of InputManagers without their own, see SetLogger()
+var (
+	loggerMu      sync.RWMutex
+	defaultLogger *slog.Logger
+)
+
+// SetLogger makes every InputManager report what it does to logger
+//
+// Command resolution, process starts and ignored lines are logged at
+// debug level, dropped messages at warn level, failed requests at error
+// level. Every record carries the key of its request, and its
+// correlation ID when it has one (see WithCorrelationID()).
+//
+// Parameters:
+//
+//	logger: Destination of the logs, nil makes InputManagers silent again
+func SetLogger(logger *slog.Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	defaultLogger = logger
+}
+
+// WithLogger makes an InputManager report what it does to logger, replacing the one of SetLogger()
+//
+// Parameters:
+//
+//	logger: Destination of the logs
+func WithLogger(logger *slog.Logger) Option {
+	return func(im *InputManager) {
+		im.logger = logger
+	}
+}
+
+// Handler of InputManagers without a logger
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// Get the logger of the InputManager, with the key of the current request
+func (im *InputManager) log() *slog.Logger {
+	logger := im.logger
+	if logger == nil {
+		loggerMu.RLock()
+		logger = defaultLogger
+		loggerMu.RUnlock()
+	}
+	if logger == nil {
+		return discardLogger
+	}
+	if im.info.CorrelationID != "" {
+		return logger.With("key", im.key, "correlation_id", im.info.CorrelationID)
+	}
+	return logger.With("key", im.key)
+}
+
+// Log how a request ended
+func (im *InputManager) logResult(language, file string, start time.Time) {
+	if im.Response.RequestStatusSet && !im.Response.RequestStatus {
+		im.log().Error("request failed", "language", language, "file", file, "duration", time.Since(start), "errors", im.Response.Errors)
+		return
+	}
+	im.log().Debug("request completed", "language", language, "file", file, "duration", time.Since(start), "warnings", len(im.Response.Warnings))
+}
+
+// Cut text to at most size bytes for a log record
+func truncateText(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	return text[:size] + "..."
+}
@@ -2,16 +2,21 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // InputManagerResponse represents the response structure
@@ -23,6 +28,24 @@ type InputManagerResponse struct {
 	IsUnique         bool     `json:"isUnique"`
 	Warnings         []string `json:"warnings"`
 	Errors           []string `json:"errors"`
+	DataType         string   `json:"data_type,omitempty"` // Message type of protobuf data
+	Files            []string `json:"files,omitempty"`     // Names of files sent by the target
+
+	ValidationErrors []ValidationError `json:"validation_errors,omitempty"` // Schema violations
+	ErrorDetails     []Problem         `json:"error_details,omitempty"`     // Errors reported with a code by the target
+	WarningDetails   []Problem         `json:"warning_details,omitempty"`   // Warnings reported with a code by the target
+	Peer             *PeerInfo         `json:"peer,omitempty"`              // Protocol support of the target
+	Logs             []LogEntry        `json:"logs,omitempty"`              // Log() lines of the target (see WithLogs())
+
+	Channels map[string][]json.RawMessage `json:"channels,omitempty"` // Outputs by output channel (see OutputTo())
+	Done     bool                         `json:"done,omitempty"`     // Final status received (see ChannelDone)
+	Stdout   string                       `json:"stdout,omitempty"`   // Text printed by the target (see WithStdoutCapture())
+
+	StartTime     time.Time     `json:"start_time"`               // When Request() was called
+	Duration      time.Duration `json:"duration"`                 // Total time of the request
+	Timing        Timing        `json:"timing"`                   // Time spent in each phase
+	Usage         *Usage        `json:"usage,omitempty"`          // Resources used by the target process (nil without one)
+	CorrelationID string        `json:"correlation_id,omitempty"` // See WithCorrelationID()
 }
 
 // InputManager handles sending requests to other processes
@@ -42,16 +65,291 @@ type InputManager struct {
 	rawRequest  map[string]interface{}
 	request     string
 	responseObj []map[string]interface{}
+	forged      bool
+	transport   Transport
+	handlers    map[string]func(message map[string]interface{})
+	accept      []string
+	compression string
+	threshold   int
+	attachments []string
+	files       map[string][]byte
+	reqSchema   *Schema
+	respSchema  *Schema
+	meta        map[string]string
+	marshal     MarshalFunc
+	unmarshal   UnmarshalFunc
+	chunkSize   int
+	chunks      *chunkAssembler
+	streamed    strings.Builder
+	negotiate   bool
+	method      string
+	stdin       io.Reader
+	stderr      io.Writer
+	collectLogs bool
+	callbacks   map[string]Handler
+	capture     bool
+	interpreter map[string]string
+	runtimeArgs map[string][]string
+	jvmOptions  []string
+	classpath   []string
+	compileDir  string
+	pythonEnv   string
+	conda       bool
+	nodeVersion string
+	nodeRunner  string
+	policy      *Policy
+	sandbox     *Sandbox
+	user        string
+	strictRoot  string
+	environ     []string
+	tempHome    bool
+	secrets     map[string][]byte
+	maxRequest  int64
+	maxResponse int64
+	audit       AuditFunc
+	checksums   map[string]string
+	idleRead    time.Duration
+	idleWrite   time.Duration
+	logger      *slog.Logger
+	tracer      Tracer
+	traceCtx    context.Context
+	debug       bool
+	debugPath   string
+	hooks       *Hooks
+	info        HookInfo
+	correlation string
+	recordPath  string
+	wire        *wireTrace
+	slow        time.Duration
+	signKey     []byte
+	encKey      []byte
+	timeout     time.Duration
+	deadline    time.Time
+	active      Transport
+	offered     string
+	received    int64
+	stream      chan<- json.RawMessage
+	err         error
 	Response    InputManagerResponse
 }
 
+// Option configures an InputManager, see NewInputManager()
+type Option func(*InputManager)
+
+// WithTransport sets the transport used to reach the target
+//
+// Parameters:
+//
+//	transport: Custom Transport implementation (default: ProcessTransport)
+func WithTransport(transport Transport) Option {
+	return func(im *InputManager) {
+		im.transport = transport
+	}
+}
+
+// WithChannelHandler registers a handler for messages on a protocol channel
+//
+// Messages on channels other than ChannelData are not outputs: they are
+// passed to the matching handler, or ignored when no handler is registered.
+//
+// Parameters:
+//
+//	channel: Channel name (e.g. "log", "progress")
+//	handler: Function called with each decoded message of this request
+func WithChannelHandler(channel string, handler func(message map[string]interface{})) Option {
+	return func(im *InputManager) {
+		if im.handlers == nil {
+			im.handlers = make(map[string]func(message map[string]interface{}))
+		}
+		im.handlers[channel] = handler
+	}
+}
+
+// WithCodec asks the target to encode its outputs with one of the given codecs
+//
+// The codecs are offered in order of preference, JSON is always the final
+// fallback so children that don't support them keep working.
+//
+// Parameters:
+//
+//	names: Codec names (e.g. CodecMsgpack), see RegisterCodec()
+func WithCodec(names ...string) Option {
+	return func(im *InputManager) {
+		im.accept = append(im.accept, names...)
+	}
+}
+
+// WithCompression compresses data larger than threshold in both directions
+//
+// The request data is compressed, so the target must support the
+// compressor (the Go OutputManager does). The target is told which
+// compressor it may use for its outputs.
+//
+// Parameters:
+//
+//	name: Compressor name (e.g. CompressionGzip), see RegisterCompressor()
+//	threshold: Minimum data size in bytes (0 = DefaultCompressionThreshold)
+func WithCompression(name string, threshold int) Option {
+	return func(im *InputManager) {
+		if threshold <= 0 {
+			threshold = DefaultCompressionThreshold
+		}
+		im.compression = name
+		im.threshold = threshold
+	}
+}
+
+// WithSchema validates the request data and every output against JSON Schemas
+//
+// Invalid request data is not sent, invalid outputs fail the request. The
+// violations are listed in Response.ValidationErrors.
+//
+// Parameters:
+//
+//	request: Schema of the request data (nil to skip)
+//	response: Schema of each output (nil to skip)
+func WithSchema(request, response *Schema) Option {
+	return func(im *InputManager) {
+		im.reqSchema = request
+		im.respSchema = response
+	}
+}
+
+// WithStdin forwards r to the target stdin after the request
+//
+// The request stays a framed prefix of stdin, the target reads the rest
+// with Stdin() (e.g. pass os.Stdin for interactive programs). The target
+// stdin is closed once r ends. In a target, os.Stdin forwards the rest of
+// its own stdin (see Stdin()).
+//
+// Parameters:
+//
+//	r: Input of the target program
+func WithStdin(r io.Reader) Option {
+	return func(im *InputManager) {
+		im.stdin = r
+	}
+}
+
+// WithStderr copies the target stderr to w while it runs
+//
+// Response.Errors still gets the stderr of a failed target. Writes to w
+// hold up the target once its stderr pipe is full, slow writers should
+// buffer. Only the default ProcessTransport has a stderr.
+//
+// Parameters:
+//
+//	w: Destination of the stderr (log file, websocket, ...)
+func WithStderr(w io.Writer) Option {
+	return func(im *InputManager) {
+		im.stderr = w
+	}
+}
+
+// WithMeta attaches a metadata entry to every request
+//
+// Metadata travels in the envelope next to the data (trace ID, tenant,
+// locale, ...), the target reads it with GetMeta().
+//
+// Parameters:
+//
+//	key: Metadata name
+//	value: Metadata value
+func WithMeta(key, value string) Option {
+	return func(im *InputManager) {
+		if im.meta == nil {
+			im.meta = make(map[string]string)
+		}
+		im.meta[key] = value
+	}
+}
+
+// WithInterpreter sets the interpreter running the files of a language
+//
+// Overrides the default interpreter, e.g. WithInterpreter("lua", "luajit")
+// or WithInterpreter("python", "/opt/venv/bin/python"). Compiled
+// executables are not affected.
+//
+// Parameters:
+//
+//	language: Language as passed to Request()
+//	interpreter: Command name or path of the interpreter
+func WithInterpreter(language, interpreter string) Option {
+	return func(im *InputManager) {
+		if im.interpreter == nil {
+			im.interpreter = make(map[string]string)
+		}
+		im.interpreter[strings.ToUpper(language)] = interpreter
+	}
+}
+
+// WithRuntimeArgs passes arguments to the interpreter of a language
+//
+// The arguments follow the interpreter, or its subcommand (deno run, go
+// run, ...), e.g. the permissions of Deno targets or the environment of
+// Julia targets:
+//
+//	WithRuntimeArgs("deno", "--allow-read", "--allow-net=api.example.com")
+//	WithRuntimeArgs("julia", "--project=/srv/models")
+//
+// Compiled executables are not affected.
+//
+// Parameters:
+//
+//	language: Language as passed to Request()
+//	args: Interpreter arguments
+func WithRuntimeArgs(language string, args ...string) Option {
+	return func(im *InputManager) {
+		if im.runtimeArgs == nil {
+			im.runtimeArgs = make(map[string][]string)
+		}
+		im.runtimeArgs[strings.ToUpper(language)] = args
+	}
+}
+
+// WithJVMOptions passes options to the JVM running JVM targets
+//
+// Applies to Java targets (jars, sources and classes) and to Kotlin and
+// Scala targets, e.g.
+// WithJVMOptions("-Xmx2g", "-Dconfig.file=prod.conf").
+//
+// Parameters:
+//
+//	options: JVM options
+func WithJVMOptions(options ...string) Option {
+	return func(im *InputManager) {
+		im.jvmOptions = append(im.jvmOptions, options...)
+	}
+}
+
+// WithClasspath sets the classpath of Java targets
+//
+// Java targets can then be a compiled class (its main class, found from
+// the classpath entry holding it) or a single-file source using the
+// classpath. Jars (java -jar) use their own manifest instead.
+//
+// Parameters:
+//
+//	paths: Directories and jars of the classpath
+func WithClasspath(paths ...string) Option {
+	return func(im *InputManager) {
+		im.classpath = append(im.classpath, paths...)
+	}
+}
+
 // NewInputManager creates a new InputManager instance
-func NewInputManager() *InputManager {
-	return &InputManager{
+//
+// Parameters:
+//
+//	opts: Optional settings (WithTransport, ...)
+func NewInputManager(opts ...Option) *InputManager {
+	im := &InputManager{
 		key:         "",
 		rawRequest:  make(map[string]interface{}),
 		request:     "",
 		responseObj: []map[string]interface{}{},
+		marshal:     json.Marshal,
+		unmarshal:   json.Unmarshal,
 		Response: InputManagerResponse{
 			RequestStatusSet: false,
 			RequestStatus:    false,
@@ -62,6 +360,10 @@ func NewInputManager() *InputManager {
 			Errors:           []string{},
 		},
 	}
+	for _, opt := range opts {
+		opt(im)
+	}
+	return im
 }
 
 // Bundle converts any data to a JSON string for use with Request()
@@ -74,7 +376,7 @@ func NewInputManager() *InputManager {
 //
 //	string: JSON string representation of the data
 func (im *InputManager) Bundle(data interface{}) string {
-	jsonBytes, _ := json.Marshal(data)
+	jsonBytes, _ := im.marshal(data)
 	return string(jsonBytes)
 }
 
@@ -89,53 +391,36 @@ func genKey() string {
 //
 // Parameters:
 //
-//	language: Programming language/runtime
+//	language: Programming language/runtime (see RegisterLanguage()), "" to detect it
 //	file: Path to file to execute
 //
 // Returns:
 //
 //	[]string: Command array for subprocess
-//	error: Invalid file extension, file not found, or permission error
+//	error: Invalid file extension, file not found, permission error, *PolicyError, *SecurityError or *IntegrityError
 func (im *InputManager) getCommand(language, file string) ([]string, error) {
+	if language == "" {
+		detected, err := DetectLanguage(file)
+		if err != nil {
+			return nil, err
+		}
+		language = detected
+	}
 	langUpper := strings.ToUpper(language)
 	fileExt := strings.ToLower(filepath.Ext(file))
+	spec, known := lookupLanguage(langUpper)
 
 	// Extension validation - FIRST before file existence check
-	extensionMap := map[string][]string{
-		"PYTHON":     {".py"},
-		"PY":         {".py"},
-		"JAVASCRIPT": {".js"},
-		"JS":         {".js"},
-		"NODE":       {".js"},
-		"NODEJS":     {".js"},
-		"RUBY":       {".rb"},
-		"RB":         {".rb"},
-		"C":          {".c", ".out", ".exe", ""},
-		"CS":         {".exe", ".dll", ""},
-		"CPP":        {".cpp", ".cc", ".cxx", ".out", ".exe", ""},
-		"C#":         {".exe", ".dll", ""},
-		"C++":        {".cpp", ".cc", ".cxx", ".out", ".exe", ""},
-		"CSHARP":     {".exe", ".dll", ""},
-		"CPLUSPLUS":  {".cpp", ".cc", ".cxx", ".out", ".exe", ""},
-		"EXE":        {".cpp", ".cc", ".cxx", ".out", ".exe", ""},
-		"JAR":        {".jar"},
-		"JAVA":       {".jar"},
-		"RUST":       {".rs", ".exe", ".out", ""},
-		"RS":         {".rs", ".exe", ".out", ""},
-		"GO":         {".go", ".exe", ".out", ""},
-		"GOLANG":     {".go", ".exe", ".out", ""},
-	}
-
-	if validExts, ok := extensionMap[langUpper]; ok {
+	if known && spec.extensions != nil {
 		found := false
-		for _, ext := range validExts {
+		for _, ext := range spec.extensions {
 			if fileExt == ext {
 				found = true
 				break
 			}
 		}
 		if !found {
-			expected := strings.Join(validExts, ", ")
+			expected := strings.Join(spec.extensions, ", ")
 			return nil, fmt.Errorf("Invalid file '%s' for language '%s'. Expected: e.g. 'file%s'", file, language, expected)
 		}
 	}
@@ -153,64 +438,130 @@ func (im *InputManager) getCommand(language, file string) ([]string, error) {
 		return nil, fmt.Errorf("Path is not a file: %s", file)
 	}
 
-	// Permission checks
-	compiledLangs := []string{"C", "CS", "CPP", "C#", "C++", "CSHARP", "CPLUSPLUS", "EXE", "RUST", "RS", "GO", "GOLANG"}
-	isCompiled := false
-	for _, lang := range compiledLangs {
-		if lang == langUpper {
-			isCompiled = true
-			break
+	if !known {
+		return nil, fmt.Errorf("Unsupported language: %s", language)
+	}
+
+	policy := im.activePolicy()
+	if policy != nil {
+		if err := policy.checkTarget(langUpper, file); err != nil {
+			return nil, err
 		}
 	}
+	if im.strictRoot != "" {
+		if file, err = strictTarget(im.strictRoot, spec, file, info); err != nil {
+			return nil, err
+		}
+	}
+	if err := im.verifyChecksum(file); err != nil {
+		return nil, err
+	}
 
-	// On Windows, skip executable check as it's unreliable
-	if isCompiled && runtime.GOOS != "windows" {
-		if info.Mode()&0111 == 0 {
-			return nil, fmt.Errorf("File is not executable: %s", file)
+	// Sources compiled on demand run as cached binaries (see WithCompile())
+	if spec.compiled && im.compileDir != "" {
+		binary, err := compileSource(language, file, im.compileDir, policy)
+		if err != nil {
+			return nil, err
+		}
+		if binary != "" {
+			if policy != nil {
+				if err := policy.checkBinary(binary, im.compileDir); err != nil {
+					return nil, err
+				}
+			}
+			return []string{binary}, nil
 		}
 	}
 
-	// Auto-add ./ for compiled executables if not present and not absolute path
-	if isCompiled && !filepath.IsAbs(file) && !strings.HasPrefix(file, "./") && !strings.HasPrefix(file, ".\\") {
-		file = "./" + file
+	// Permission checks and ./ prefix for compiled executables
+	if spec.compiled {
+		if file, err = executablePath(file, info); err != nil {
+			return nil, err
+		}
 	}
 
 	// Build command
-	langMap := map[string][]string{
-		"PYTHON":     {"python", file},
-		"PY":         {"python", file},
-		"JAVASCRIPT": {"node", file},
-		"JS":         {"node", file},
-		"NODE":       {"node", file},
-		"NODEJS":     {"node", file},
-		"RUBY":       {"ruby", file},
-		"RB":         {"ruby", file},
-		"C":          {file},
-		"CS":         {file},
-		"CPP":        {file},
-		"C#":         {file},
-		"C++":        {file},
-		"CSHARP":     {file},
-		"CPLUSPLUS":  {file},
-		"EXE":        {file},
-		"JAR":        {"java", "-jar", file},
-		"JAVA":       {"java", "-jar", file},
-		"RUST":       {file},
-		"RS":         {file},
-		"GOLANG":     {"go", "run", file},
-	}
-
-	if fileExt == ".go" {
-		langMap["GO"] = []string{"go", "run", file}
-	} else {
-		langMap["GO"] = []string{file}
+	cmd, err := spec.command(im, langUpper, file, info)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cmd) > 1 {
+		interpreter, ok := im.interpreter[langUpper]
+		if !ok && !im.hostCommand() {
+			// The runtime is resolved where the transport runs the target
+			interpreter, ok = cmd[0], true
+		}
+		if !ok && cmd[0] == "python" && im.pythonEnv != "" {
+			if interpreter, err = im.pythonEnvInterpreter(); err != nil {
+				return nil, err
+			}
+			ok = true
+		}
+		if !ok && cmd[0] == "node" && im.nodeVersion != "" {
+			if interpreter, err = findNodeVersion(langUpper, im.nodeVersion); err != nil {
+				return nil, err
+			}
+			ok = true
+		}
+		if !ok {
+			if interpreter, err = lookupInterpreter(language, cmd[0]); err != nil {
+				return nil, err
+			}
+		}
+		node := cmd[0] == "node"
+		cmd[0] = interpreter
+		if args, ok := im.runtimeArgs[langUpper]; ok {
+			at := spec.runtimeArgsAt(cmd)
+			cmd = append(append(append([]string{}, cmd[:at]...), args...), cmd[at:]...)
+		}
+		if node && im.nodeRunner != "" {
+			if cmd, err = im.packageRunnerCommand(language, cmd); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	if cmd, ok := langMap[langUpper]; ok {
-		return cmd, nil
+	if policy != nil {
+		check := policy.checkCommand
+		if !im.hostCommand() {
+			check = policy.checkCommandName
+		}
+		if err := check(cmd, file); err != nil {
+			return nil, err
+		}
 	}
+	return jvmCommand(cmd, im.jvmOptions), nil
+}
+
+// Tell whether the target command runs on this host, so its runtimes are looked up in PATH
+//
+// Other transports (containers, ...) start the command in their own
+// environment, the host doesn't need the runtime.
+func (im *InputManager) hostCommand() bool {
+	_, local := im.transport.(*ProcessTransport)
+	return im.transport == nil || local
+}
 
-	return nil, fmt.Errorf("Unsupported language: %s", language)
+// Get the environment variables activating the runtimes of the target
+//
+// See WithVirtualenv(), WithCondaEnv(), WithNodeVersion(), WithSigningKey()
+// and WithEncryptionKey()
+func (im *InputManager) targetEnv() []string {
+	path, env := im.pythonEnvVars()
+	if im.signKey != nil {
+		env = append(env, SigningKeyEnv+"="+hex.EncodeToString(im.signKey))
+	}
+	if im.encKey != nil {
+		env = append(env, EncryptionKeyEnv+"="+hex.EncodeToString(im.encKey))
+	}
+	path = append(path, im.nodeEnvPath()...)
+	// Host runtime directories mean nothing where other transports run the target
+	if len(path) == 0 || !im.hostCommand() {
+		return env
+	}
+	path = append(path, os.Getenv("PATH"))
+	return append(env, "PATH="+strings.Join(path, string(os.PathListSeparator)))
 }
 
 // Request sends a request to another process
@@ -230,7 +581,66 @@ func (im *InputManager) getCommand(language, file string) ([]string, error) {
 //   - IsUnique (bool): Echo of parameter
 //   - Warnings ([]string): Warning messages
 //   - Errors ([]string): Error messages
+//   - ErrorDetails ([]Problem): Errors of the target with their code
 func (im *InputManager) Request(isUnique, optionalOutput bool, data, language, file string) {
+	fields := map[string]interface{}{"data": nil}
+	if data != "" {
+		var parsed interface{}
+		if err := unmarshalNumbers([]byte(data), &parsed); err == nil {
+			fields["data"] = parsed
+		}
+	}
+	im.exchange(isUnique, optionalOutput, fields, language, file)
+}
+
+// RequestFields sends a request carrying several named data fields
+//
+// The target reads each field with GetData(name), e.g. "config",
+// "payload" and "context" instead of one blob destructured by convention.
+//
+// Parameters:
+//
+//	isUnique: Expect single output (true) or multiple (false)
+//	optionalOutput: Output is optional (true) or required (false)
+//	fields: Field names mapped to JSON strings (e.g. from Bundle())
+//	language: Target language/runtime
+//	file: Path to target file
+func (im *InputManager) RequestFields(isUnique, optionalOutput bool, fields map[string]string, language, file string) {
+	named := make(map[string]interface{})
+	for name, data := range fields {
+		var parsed interface{}
+		if err := unmarshalNumbers([]byte(data), &parsed); err == nil {
+			named[name] = parsed
+		} else {
+			named[name] = nil
+		}
+	}
+	im.exchange(isUnique, optionalOutput, map[string]interface{}{"data": nil, "fields": named}, language, file)
+}
+
+// Run a request whose envelope carries the given data fields
+//
+// Parameters:
+//
+//	isUnique: Expect single output (true) or multiple (false)
+//	optionalOutput: Output is optional (true) or required (false)
+//	fields: Envelope fields describing the data ("data", "encoding", ...)
+//	language: Target language/runtime
+//	file: Path to target file
+func (im *InputManager) exchange(isUnique, optionalOutput bool, fields map[string]interface{}, language, file string) {
+	start := time.Now()
+	defer im.logResult(language, file, start)
+	defer im.statusEnd(language, file, start)
+	clock := startPhases(&im.Response.Timing, start)
+	defer func() {
+		clock.next(nil)
+		im.Response.StartTime = start
+		im.Response.Duration = time.Since(start)
+		im.Response.CorrelationID = im.info.CorrelationID
+		im.checkSlow()
+	}()
+	var trace *requestTrace
+	defer func() { trace.end(im) }()
 	defer func() {
 		if r := recover(); r != nil {
 			im.Response.RequestStatus = false
@@ -241,14 +651,27 @@ func (im *InputManager) Request(isUnique, optionalOutput bool, data, language, f
 	}()
 
 	im.key = genKey()
-	command, err := im.getCommand(language, file)
+	im.err = nil
+	im.info = HookInfo{Key: im.key, Language: language, File: file, CorrelationID: im.correlationID()}
+	im.statusStart(language, file, start)
+	trace = im.startTrace(language, file)
+
+	// Custom transports may not need a file at all, replayed ones aren't run
+	var command []string
+	var err error
+	_, replay := im.transport.(*ReplayTransport)
+	if !replay && (im.transport == nil || language != "" || file != "") {
+		command, err = im.getCommand(language, file)
+	}
 	if err != nil {
+		im.log().Debug("command resolution failed", "language", language, "file", file, "error", err)
 		im.Response.RequestStatus = false
 		im.Response.RequestStatusSet = true
 		im.Response.OptionalOutput = optionalOutput
 		im.Response.IsUnique = isUnique
 		im.Response.Warnings = []string{"Warning: targeted file not found or can't be executed, consider checking file informations and language dependencies."}
 		im.Response.Errors = []string{fmt.Sprintf("Error: %s", err.Error())}
+		im.err = err
 		return
 	}
 
@@ -259,105 +682,398 @@ func (im *InputManager) Request(isUnique, optionalOutput bool, data, language, f
 		Errors:         []string{},
 	}
 
+	// Raw bytes (binary, protobuf) can't be checked against a JSON Schema
+	if _, encoded := fields["encoding"]; !encoded && im.reqSchema != nil {
+		// Named fields are checked as one object
+		value := fields["data"]
+		if named, ok := fields["fields"]; ok {
+			value = named
+		}
+		if errs := im.reqSchema.ValidateValue(value); len(errs) > 0 {
+			im.Response.RequestStatus = false
+			im.Response.RequestStatusSet = true
+			im.Response.ValidationErrors = errs
+			for _, e := range errs {
+				im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: invalid request data: %s", e.Error()))
+			}
+			return
+		}
+	}
+
+	// Features the target is known not to support are left out
+	peer := lookupPeer(language, file)
+	accept := im.accept
+	compression, threshold := im.compression, im.threshold
+	if im.negotiate {
+		accept = append(append([]string{}, accept...), codecPreference...)
+		if compression == "" {
+			compression, threshold = CompressionGzip, DefaultCompressionThreshold
+		}
+	}
+
 	requestMap := map[string]interface{}{
 		"key":            im.key,
+		"version":        ProtocolVersion,
 		"optionalOutput": optionalOutput,
 		"isUnique":       isUnique,
 		"data":           nil,
+		"transport":      transportName(im.transport),
+		"parent_pid":     os.Getpid(),
 	}
-
-	if data != "" {
-		var parsed interface{}
-		if err := json.Unmarshal([]byte(data), &parsed); err == nil {
-			requestMap["data"] = parsed
+	if len(accept) > 0 {
+		requestMap["accept"] = append(append([]string{}, accept...), CodecJSON)
+	}
+	for name, value := range fields {
+		requestMap[name] = value
+	}
+	requestMap["accept_files"] = true
+	requestMap["accept_problems"] = true
+	requestMap["max_message_size"] = DefaultChunkSize
+	if im.chunkSize > 0 {
+		requestMap["max_message_size"] = im.chunkSize
+	}
+	if len(im.meta) > 0 {
+		requestMap["meta"] = im.meta
+	}
+	if im.info.CorrelationID != "" {
+		requestMap["correlation_id"] = im.info.CorrelationID
+	}
+	if traceParent := trace.traceParent(); traceParent != "" {
+		requestMap["traceparent"] = traceParent
+	}
+	if im.method != "" {
+		requestMap["method"] = im.method
+	}
+	if len(im.callbacks) > 0 {
+		requestMap["accept_callbacks"] = true
+	}
+	if im.capture {
+		requestMap["capture_stdout"] = true
+	}
+	deadline := im.requestDeadline()
+	if !deadline.IsZero() {
+		requestMap["deadline"] = deadline.UTC().Format(time.RFC3339Nano)
+	}
+	if len(im.attachments) > 0 {
+		names := []string{}
+		for _, path := range im.attachments {
+			names = append(names, filepath.Base(path))
+		}
+		requestMap["files"] = names
+	}
+	if _, encoded := fields["encoding"]; !encoded && im.negotiate && peer != nil {
+		if err := encodeMessageData(requestMap, bestCodec(peer)); err != nil {
+			im.Response.RequestStatus = false
+			im.Response.RequestStatusSet = true
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: %s", err.Error()))
+			return
+		}
+	}
+	im.offered = compression
+	if compression != "" {
+		requestMap["accept_compression"] = []string{compression}
+		requestMap["compression_threshold"] = threshold
+		// Negotiated compression waits for the handshake, explicit one doesn't
+		if (peer != nil && !peer.SupportsCompressor(compression)) || (peer == nil && im.compression == "") {
+			compression = ""
 		}
+		if err := compressMessageData(requestMap, compression, threshold); err != nil {
+			im.Response.RequestStatus = false
+			im.Response.RequestStatusSet = true
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: %s", err.Error()))
+			return
+		}
+	}
+	if err := encryptMessageData(requestMap, im.encKey); err != nil {
+		im.Response.RequestStatus = false
+		im.Response.RequestStatusSet = true
+		im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: %s", err.Error()))
+		return
 	}
+	im.rawRequest = requestMap
 
 	requestBytes, _ := json.Marshal(requestMap)
 	im.request = string(requestBytes)
-
-	cmd := exec.Command(command[0], command[1:]...)
-	stdin, _ := cmd.StdinPipe()
-	stdout, _ := cmd.StdoutPipe()
-	stderr, _ := cmd.StderrPipe()
-
-	if err := cmd.Start(); err != nil {
+	if im.maxRequest > 0 && int64(len(requestBytes)) > im.maxRequest {
+		im.err = &SizeLimitError{Direction: "request", Limit: im.maxRequest, Size: int64(len(requestBytes))}
 		im.Response.RequestStatus = false
 		im.Response.RequestStatusSet = true
-		im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Failed to start process: %s", err.Error()))
+		im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: %s", im.err.Error()))
 		return
 	}
 
-	io.WriteString(stdin, im.request)
-	stdin.Close()
-
-	outputBytes, _ := io.ReadAll(stdout)
-	stderrBytes, _ := io.ReadAll(stderr)
-
-	cmd.Wait()
+	// The default transport traces the exact bytes itself
+	wire := im.wireFunc()
+	transport := im.transport
+	if transport == nil {
+		transport = &ProcessTransport{Sandbox: im.sandbox, User: im.user, Environ: im.environ, TempHome: im.tempHome, MaxReceive: im.maxResponse, OnStderr: im.stderrHook(), OnWire: wire}
+		wire = nil
+	}
+	// Network transports bound their reads by the response limit too
+	switch t := transport.(type) {
+	case *TCPTransport:
+		if t.MaxReceive == 0 {
+			t.MaxReceive = im.maxResponse
+		}
+	case *HTTPTransport:
+		if t.MaxReceive == 0 {
+			t.MaxReceive = im.maxResponse
+		}
+	}
 
-	exitCode := cmd.ProcessState.ExitCode()
-	if exitCode != 0 {
+	if _, local := transport.(*ProcessTransport); len(im.secrets) > 0 && !local {
 		im.Response.RequestStatus = false
 		im.Response.RequestStatusSet = true
-		im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Process exited with code %d", exitCode))
-		if len(stderrBytes) > 0 {
-			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("stderr: %s", string(stderrBytes)))
-		}
-		im.Response.Warnings = append(im.Response.Warnings, "Warning: these kind of errors result from an error in the targeted script.")
+		im.Response.Errors = append(im.Response.Errors, "Error: the transport can't pass secrets")
+		return
+	}
+	// Recorded once the target ended, with the error that stopped it
+	var endErr error
+	if audit := im.activeAudit(); audit != nil {
+		start := time.Now()
+		defer func() {
+			im.recordAudit(audit, transport, language, file, start, endErr)
+		}()
+	}
+	recording := im.startRecording(language, file, command)
+	defer func() { recording.save(transport, endErr) }()
+	dump := im.openDump()
+	defer dump.close()
+	dump.note("start %q (transport %s)", command, transportName(im.transport))
+	trace.enter("mangle.start")
+	clock.next(&im.Response.Timing.Spawn)
+	im.log().Debug("starting target", "language", language, "file", file, "command", command, "transport", transportName(im.transport))
+	if err := transport.Open(Target{Language: language, File: file, Command: command, Env: im.targetEnv(), Secrets: im.secrets}); err != nil {
+		endErr = err
+		dump.note("start failed: %s", err.Error())
+		im.Response.RequestStatus = false
+		im.Response.RequestStatusSet = true
+		im.Response.Errors = append(im.Response.Errors, err.Error())
 		return
 	}
 
-	output := string(outputBytes)
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-
-	im.responseObj = []map[string]interface{}{}
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
-
-		var jsonData map[string]interface{}
-		if err := json.Unmarshal([]byte(line), &jsonData); err != nil {
-			// Ignore lines that aren't valid JSON (e.g., debug prints)
-			continue
+	im.hookStart(transport)
+	im.statusProcess(transport)
+	trace.enter("mangle.write")
+	clock.next(&im.Response.Timing.Write)
+	chunkSize := im.chunkSize
+	if peer != nil && !peer.Supports(FeatureChunks) {
+		chunkSize = 0
+	}
+	writeWatch := watchIdle(im.idleWrite, transport, false)
+	send := writeWatch.send(signedSender(im.signKey, recording.send(dump.send(tracedSend(wire, transport.Send)))))
+	if err := sendChunked(send, im.key, im.key, requestBytes, chunkSize); err != nil {
+		transport.Close()
+		if writeWatch.stop() {
+			im.err, err = ErrIdleTimeout, ErrIdleTimeout
 		}
-
-		// Validate response has matching key or null key (for init errors)
-		// This ensures we only process responses meant for this request
-		if keyVal, ok := jsonData["key"]; ok {
-			if keyVal == nil || keyVal == im.key {
-				im.responseObj = append(im.responseObj, jsonData)
+		im.Response.RequestStatus = false
+		im.Response.RequestStatusSet = true
+		im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Failed to send request: %s", err.Error()))
+		return
+	}
+	for _, path := range im.attachments {
+		if err := sendFileChunks(send, im.key, filepath.Base(path), path); err != nil {
+			transport.Close()
+			if writeWatch.stop() {
+				im.err, err = ErrIdleTimeout, ErrIdleTimeout
 			}
+			im.Response.RequestStatus = false
+			im.Response.RequestStatusSet = true
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Failed to send file: %s", err.Error()))
+			return
 		}
 	}
-
-	if len(im.responseObj) > 0 {
-		failure := false
-		for _, resp := range im.responseObj {
-			if status, ok := resp["request_status"].(bool); ok && !status {
-				failure = true
+	if im.stdin != nil {
+		streamSender, ok := transport.(StreamSender)
+		if !ok {
+			transport.Close()
+			im.Response.RequestStatus = false
+			im.Response.RequestStatusSet = true
+			im.Response.Errors = append(im.Response.Errors, "Error: the transport can't forward stdin")
+			return
+		}
+		// Forwarded while the outputs are read, for interactive targets
+		go func() {
+			streamSender.SendStream(writeWatch.reader(forwardedStdin(im.stdin)))
+			if sc, ok := transport.(SendCloser); ok {
+				sc.CloseSend()
 			}
-
-			if errors, ok := resp["errors"].([]interface{}); ok {
-				for _, err := range errors {
-					if errStr, ok := err.(string); ok {
-						im.Response.Errors = append(im.Response.Errors, errStr)
-					}
-				}
+		}()
+	} else if sc, ok := transport.(SendCloser); ok && len(im.callbacks) == 0 {
+		// Callback replies need stdin until the target exits
+		sc.CloseSend()
+	}
+	trace.enter("mangle.wait")
+	clock.next(&im.Response.Timing.Exec)
+	im.active = transport
+	deadlineExceeded := watchDeadline(deadline, transport)
+	defer deadlineExceeded()
+	readWatch := watchIdle(im.idleRead, transport, true)
+
+	// Lines are handled as they arrive so outputs can be streamed
+	im.responseObj = []map[string]interface{}{}
+	im.forged = false
+	im.files = make(map[string][]byte)
+	im.chunks = newChunkAssembler()
+	im.streamed.Reset()
+	assembler := newFileAssembler()
+	var receiveErr error
+	im.received = 0
+	for {
+		line, err := transport.Receive()
+		if err != nil {
+			if err != io.EOF {
+				receiveErr = err
 			}
+			break
+		}
+		readWatch.arm()
+		if wire != nil {
+			wire(false, line)
+		}
+		dump.received(line)
+		recording.received(line)
+		if im.received += int64(len(line)) + 1; im.maxResponse > 0 && im.received > im.maxResponse {
+			receiveErr = &SizeLimitError{Direction: "response", Limit: im.maxResponse, Size: im.received}
+			break
+		}
+		if line, err = verifyMessage(im.signKey, line); err != nil {
+			im.log().Warn("message with an invalid signature dropped")
+			im.forged = true
+			im.Response.Errors = append(im.Response.Errors, "Error: message with an invalid signature dropped")
+			continue
+		}
+		im.handleLine(line, assembler)
+		// Capabilities refused in the handshake, data expanding past the limit
+		_, denied := im.err.(*PolicyError)
+		_, tooLarge := im.err.(*SizeLimitError)
+		if denied || tooLarge {
+			receiveErr = im.err
+			break
 		}
+	}
 
-		im.Response.RequestStatus = !failure
-		im.Response.RequestStatusSet = true
-		im.Response.IsUnique = im.responseObj[0]["isUnique"].(bool)
+	silent := readWatch.stop()
+	blocked := writeWatch.stop()
 
-		dataList := []interface{}{}
-		for _, resp := range im.responseObj {
-			dataList = append(dataList, resp["data"])
+	// The target could keep writing forever, it is stopped first
+	var limitErr *SizeLimitError
+	var policyErr *PolicyError
+	stopped := errors.As(receiveErr, &limitErr) || errors.As(receiveErr, &policyErr)
+	if stopped {
+		if killer, ok := transport.(Killer); ok {
+			killer.Kill()
 		}
-
-		if im.Response.IsUnique {
+	}
+	closeErr := transport.Close()
+	im.Response.Usage = processUsage(transport)
+	im.hookExit(transport, closeErr)
+	im.log().Debug("target ended", "received", im.received, "error", closeErr)
+	if dump != nil {
+		dump.note("end: received %d bytes, error: %v", im.received, closeErr)
+		if source, ok := transport.(interface{ Stderr() string }); ok && source.Stderr() != "" {
+			dump.note("stderr: %q", source.Stderr())
+		}
+	}
+	endErr = closeErr
+	if receiveErr != nil {
+		endErr = receiveErr
+	}
+	if stopped {
+		im.err = receiveErr
+		im.Response.RequestStatus = false
+		im.Response.RequestStatusSet = true
+		im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: %s", receiveErr.Error()))
+		return
+	}
+	if silent || blocked {
+		im.err = ErrIdleTimeout
+		im.Response.RequestStatus = false
+		im.Response.RequestStatusSet = true
+		if silent {
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: no output from the target for %s, it was stopped.", im.idleRead))
+		} else {
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: the target didn't read its input for %s, it was stopped.", im.idleWrite))
+		}
+		return
+	}
+	if deadlineExceeded() {
+		im.Response.RequestStatus = false
+		im.Response.RequestStatusSet = true
+		im.Response.Errors = append(im.Response.Errors, "Error: deadline exceeded, the target was stopped.")
+		return
+	}
+	if im.collectLogs {
+		if source, ok := transport.(interface{ Stderr() string }); ok {
+			im.Response.Logs = parseLogs(source.Stderr())
+		}
+	}
+	if closeErr == nil && receiveErr != nil {
+		closeErr = receiveErr
+	}
+	if err := closeErr; err != nil {
+		im.Response.RequestStatus = false
+		im.Response.RequestStatusSet = true
+		var exitErr *ExitError
+		if errors.As(err, &exitErr) {
+			im.Response.Errors = append(im.Response.Errors, exitErr.Error())
+			if len(exitErr.Stderr) > 0 {
+				im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("stderr: %s", exitErr.Stderr))
+			}
+			if missingDotnetFramework(exitErr.Stderr) {
+				im.Response.Errors = append(im.Response.Errors, "Error: the .NET runtime required by the target is not installed (see `dotnet --list-runtimes`).")
+			}
+			im.Response.Warnings = append(im.Response.Warnings, "Warning: these kind of errors result from an error in the targeted script.")
+		} else {
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: %s", err.Error()))
+		}
+		return
+	}
+
+	trace.enter("mangle.parse")
+	clock.next(&im.Response.Timing.Parse)
+	// Targets answering without a handshake speak the original protocol
+	if im.Response.Peer == nil && len(im.responseObj) > 0 {
+		im.Response.Peer = &PeerInfo{Version: 1}
+	}
+	if im.Response.Peer != nil {
+		storePeer(language, file, im.Response.Peer)
+	}
+
+	if len(im.responseObj) > 0 {
+		failure := false
+		for _, resp := range im.responseObj {
+			if status, ok := resp["request_status"].(bool); ok && !status {
+				failure = true
+			}
+
+			addProblems(resp["errors"], "Error: ", &im.Response.Errors, &im.Response.ErrorDetails)
+			addProblems(resp["warnings"], "Warning: ", &im.Response.Warnings, &im.Response.WarningDetails)
+
+			if violations, ok := resp["validation_errors"].([]interface{}); ok {
+				for _, violation := range violations {
+					if v, ok := violation.(map[string]interface{}); ok {
+						path, _ := v["path"].(string)
+						message, _ := v["message"].(string)
+						im.Response.ValidationErrors = append(im.Response.ValidationErrors, ValidationError{Path: path, Message: message})
+					}
+				}
+			}
+		}
+
+		im.Response.RequestStatus = !failure && len(im.Response.ValidationErrors) == 0
+		im.Response.RequestStatusSet = true
+		im.Response.IsUnique = im.responseObj[0]["isUnique"].(bool)
+		im.Response.DataType, _ = im.responseObj[0]["data_type"].(string)
+
+		dataList := []interface{}{}
+		for _, resp := range im.responseObj {
+			dataList = append(dataList, resp["data"])
+		}
+
+		// Outputs streamed by ResponseStream() are not buffered into Data
+		if im.stream == nil && im.Response.IsUnique {
 			if len(dataList) == 1 {
 				// Store as JSON string to preserve type
 				dataBytes, _ := json.Marshal(dataList[0])
@@ -367,7 +1083,7 @@ func (im *InputManager) Request(isUnique, optionalOutput bool, data, language, f
 				im.Response.Data = ""
 				im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: Expected 1 output (isUnique=True) but received %d.", len(dataList)))
 			}
-		} else {
+		} else if im.stream == nil {
 			dataBytes, _ := json.Marshal(dataList)
 			im.Response.Data = string(dataBytes)
 		}
@@ -379,6 +1095,216 @@ func (im *InputManager) Request(isUnique, optionalOutput bool, data, language, f
 		im.Response.RequestStatusSet = true
 		im.Response.Errors = append(im.Response.Errors, "Error: OutputManager might not be used or not correctly.")
 	}
+	// Forged messages fail the request whatever the outputs say (see WithSigningKey())
+	if im.forged {
+		im.Response.RequestStatus = false
+		im.Response.RequestStatusSet = true
+	}
+
+	// Targets announcing FeatureDone send it from Cleanup(), without it the
+	// outputs received may be partial
+	if im.Response.Peer != nil && im.Response.Peer.Supports(FeatureDone) && !im.Response.Done {
+		im.Response.Warnings = append(im.Response.Warnings, "Warning: the target ended without final status (Cleanup() not called), outputs may be partial.")
+	}
+}
+
+// Decrypt and decode the data of a message sent by the target
+//
+// Only the compression offered with the request is accepted, and the data
+// can't expand past what is left of WithMaxResponseSize(). Once it would,
+// im.err is set so the target gets stopped.
+func (im *InputManager) decodeResponseData(message map[string]interface{}) error {
+	if name, _ := message["compression"].(string); name != "" && name != im.offered {
+		delete(message, "compression")
+		message["data"] = nil
+		return fmt.Errorf("Compression %s wasn't offered", name)
+	}
+	if err := decryptMessageData(message, im.encKey); err != nil {
+		return err
+	}
+	var limit int64
+	if im.maxResponse > 0 {
+		limit = im.maxResponse - im.received
+		if limit < 1 {
+			limit = 1
+		}
+	}
+	err := decodeMessageData(message, limit)
+	if limitErr, ok := err.(*SizeLimitError); ok {
+		// Reported against the whole response
+		limitErr.Limit, limitErr.Size = im.maxResponse, im.received+limitErr.Size
+		im.err = limitErr
+	}
+	return err
+}
+
+// Handle one line received from the target
+//
+// Side channel messages go to their handler, outputs are validated and
+// collected (and streamed when ResponseStream() is used).
+func (im *InputManager) handleLine(line []byte, assembler *fileAssembler) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+
+	var jsonData map[string]interface{}
+	if err := unmarshalNumbers(line, &jsonData); err != nil {
+		// Ignore lines that aren't valid JSON (e.g., debug prints)
+		im.log().Debug("line that isn't JSON ignored", "line", truncateText(string(line), 200))
+		return
+	}
+
+	// Validate response has matching key or null key (for init errors)
+	// This ensures we only process responses meant for this request
+	keyVal, ok := jsonData["key"]
+	if !ok || (keyVal != nil && keyVal != im.key) {
+		return
+	}
+
+	// Oversized messages are handled once all their chunks arrived
+	if messageChannel(jsonData) == ChannelChunk {
+		whole, err := im.chunks.add(jsonData)
+		if err != nil {
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: %s", err.Error()))
+		} else if whole != nil {
+			im.handleLine(whole, assembler)
+		}
+		return
+	}
+
+	// Side channels are routed to their handler, not counted as outputs
+	if channel := messageChannel(jsonData); channel == ChannelHandshake {
+		im.Response.Peer = parsePeerInfo(jsonData)
+		if policy := im.activePolicy(); policy != nil {
+			if err := policy.checkCapabilities(im.Response.Peer.Capabilities); err != nil {
+				im.err = err
+			}
+		}
+		return
+	} else if channel == ChannelStream {
+		// Text written to OutputStream(), delivered live when streaming
+		text, _ := jsonData["data"].(string)
+		if im.stream != nil {
+			textBytes, _ := json.Marshal(text)
+			im.stream <- json.RawMessage(textBytes)
+		} else {
+			im.streamed.WriteString(text)
+		}
+		return
+	} else if channel == ChannelCallback {
+		im.answerCallback(im.active, jsonData)
+		return
+	} else if channel == ChannelDone {
+		im.Response.Done = true
+		im.Response.Stdout, _ = jsonData["stdout"].(string)
+		return
+	} else if channel == ChannelNamed {
+		if err := im.addNamedOutput(jsonData); err != nil && err != im.err {
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: %s", err.Error()))
+		}
+		return
+	} else if channel == ChannelWarning {
+		addProblems([]interface{}{jsonData["warning"]}, "Warning: ", &im.Response.Warnings, &im.Response.WarningDetails)
+		return
+	} else if channel == ChannelFile {
+		name, err := assembler.add(jsonData)
+		if err != nil {
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: %s", err.Error()))
+		} else if name != "" {
+			im.files[name] = assembler.files[name]
+			im.Response.Files = append(im.Response.Files, name)
+		}
+		return
+	} else if channel != ChannelData {
+		if handler, ok := im.handlers[channel]; ok {
+			handler(jsonData)
+		}
+		return
+	}
+	err := im.decodeResponseData(jsonData)
+	if _, tooLarge := err.(*SizeLimitError); tooLarge {
+		return
+	}
+	if err != nil {
+		// Data that can't be trusted or read fails the output, once
+		jsonData["request_status"] = false
+		jsonData["data"] = nil
+		errs, _ := jsonData["errors"].([]interface{})
+		jsonData["errors"] = append(errs, fmt.Sprintf("Error: %s", err.Error()))
+	}
+	// The streamed text becomes the data of the output closing the stream
+	streamed, _ := jsonData["streamed"].(bool)
+	if streamed {
+		delete(jsonData, "streamed")
+		if im.stream == nil {
+			jsonData["data"] = im.streamed.String()
+		}
+		im.streamed.Reset()
+	}
+	index := len(im.responseObj)
+	im.responseObj = append(im.responseObj, jsonData)
+	im.hookOutput(jsonData["data"])
+
+	// Failed outputs already explain themselves
+	if status, ok := jsonData["request_status"].(bool); ok && !status {
+		return
+	}
+	if streamed && im.stream != nil {
+		// Already delivered chunk by chunk
+		return
+	}
+	if im.respSchema != nil {
+		errs := im.respSchema.ValidateValue(jsonData["data"])
+		for _, e := range errs {
+			im.Response.ValidationErrors = append(im.Response.ValidationErrors, e)
+			im.Response.Errors = append(im.Response.Errors, fmt.Sprintf("Error: invalid output %d: %s", index, e.Error()))
+		}
+		if len(errs) > 0 {
+			return
+		}
+	}
+	if im.stream != nil {
+		dataBytes, _ := json.Marshal(jsonData["data"])
+		im.stream <- json.RawMessage(dataBytes)
+		// Streamed data isn't kept
+		jsonData["data"] = nil
+	}
+}
+
+// ResponseStream sends a request and streams each output as it arrives
+//
+// The target may output any number of times (isUnique=false). The channel
+// closes when the target exits, Response then holds the final status,
+// errors and warnings (Data stays empty). The channel must be drained.
+//
+// Parameters:
+//
+//	optionalOutput: Output is optional (true) or required (false)
+//	data: Data to send as JSON string
+//	language: Target language/runtime
+//	file: Path to target file
+//
+// Returns:
+//
+//	<-chan json.RawMessage: Outputs of the target, in order
+func (im *InputManager) ResponseStream(optionalOutput bool, data, language, file string) <-chan json.RawMessage {
+	stream := make(chan json.RawMessage, 16)
+	im.stream = stream
+	go func() {
+		defer close(stream)
+		defer func() { im.stream = nil }()
+		im.Request(false, optionalOutput, data, language, file)
+	}()
+	return stream
+}
+
+// Err returns the error that kept the last request from reaching its target
+//
+// Returns:
+//
+//	error: e.g. *RuntimeNotFoundError, nil when the target was started
+func (im *InputManager) Err() error {
+	return im.err
 }
 
 // GetResponse returns the full response object
@@ -405,102 +1331,469 @@ func (im *InputManager) GetData() string {
 
 // OutputManager handles receiving requests from other processes
 //
-// This is a global singleton - all functions are package-level.
-// Must call Init() before using.
+// Init() creates the process-wide instance on stdin/stdout, used by the
+// package-level functions (GetData(), Output(), ...). NewOutputManager()
+// creates independent instances on any reader/writer (tests, several
+// logical connections).
 //
-// Functions:
-//     Init(): Initialize and read request from stdin
-//     GetData(): Get the request data as JSON string
-//     Output(data): Send response back via stdout
-//     Cleanup(): Clean up resources
-
-type outputManagerData struct {
+// Methods:
+//
+//	GetData(): Get the request data
+//	Output(data): Send response back to the calling process
+//	Cleanup(): Clean up resources
+type OutputManager struct {
 	originalStdout   *os.File
+	out              io.Writer
+	stdin            *bufio.Reader
 	requestJSON      string
 	key              string
-	data         string
+	data             string
 	optionalOutput   bool
 	isUnique         bool
+	codec            string
+	compression      string
+	threshold        int
+	dataType         string
+	method           string
+	version          int
+	transport        string
+	parentPID        int
+	deadline         time.Time
+	meta             map[string]string
+	traceParent      string
+	correlation      string
+	fields           map[string]string
+	acceptFiles      bool
+	acceptCallbacks  bool
+	callbackSeq      int
+	maxMessageSize   int
+	chunkSeq         int
+	signKey          []byte
+	encKey           []byte
+	writeMu          sync.Mutex
+	files            map[string][]byte
 	requestStatus    bool
 	requestStatusSet bool
 	uniqueState      bool
 	uniqueStateSet   bool
 	initError        bool
-	errors           []string
-	warnings         []string
+	closed           bool
+	versioned        bool
+	capture          *stdoutCapture
+	captureRequested bool
+	printed          string
+	buffered         bool
+	pending          [][]byte
+	errors           []Problem
+	warnings         []Problem
+	acceptProblems   bool
 }
 
-var globalOutputManager *outputManagerData
+var (
+	globalOutputManager *OutputManager
+	// Shared by successive Init() calls so no buffered request is lost
+	stdinReader *bufio.Reader
+)
+
+var (
+	// ErrNoRequest is returned by Init() when stdin is closed before a request
+	ErrNoRequest = errors.New("No request received")
+	// ErrAlreadyInitialized is returned by Init() before Cleanup() of the previous request
+	ErrAlreadyInitialized = errors.New("OutputManager is already initialized")
+)
 
 // Init initializes the OutputManager and reads request from stdin
 //
-// Must be called before using Output() or GetData().
+// Must be called before using Output() or GetData(), unless the target
+// was started by ProcessTransport (see AutoInitEnv).
 // Suppresses stdout to prevent pollution of JSON protocol.
-func Init() {
-	globalOutputManager = &outputManagerData{
-		errors:   []string{},
-		warnings: []string{},
+// Can be called again after Cleanup() to handle the next request
+// of a persistent worker.
+//
+// Returns:
+//
+//	*OutputManager: The instance used by the package-level functions
+//	error: ErrNoRequest, ErrAlreadyInitialized, malformed request or data
+func Init() (*OutputManager, error) {
+	if globalOutputManager != nil && !globalOutputManager.closed {
+		return globalOutputManager, ErrAlreadyInitialized
 	}
 
 	// Suppress stdout by setting to nil (Go doesn't write to nil file)
-	globalOutputManager.originalStdout = os.Stdout
+	originalStdout := os.Stdout
+	if globalOutputManager != nil && globalOutputManager.originalStdout != nil {
+		originalStdout = globalOutputManager.originalStdout
+	}
 	os.Stdout = nil
 
-	// Read the entire stdin (the JSON request from InputManager)
-	scanner := bufio.NewScanner(os.Stdin)
-	var input strings.Builder
-	for scanner.Scan() {
-		input.WriteString(scanner.Text())
+	if stdinReader == nil {
+		stdinReader = bufio.NewReader(os.Stdin)
+		releaseAutoInitEnv()
+	}
+	om, err := NewOutputManager(stdinReader, originalStdout)
+	om.originalStdout = originalStdout
+	if om.captureRequested {
+		om.CaptureStdout()
+	}
+	globalOutputManager = om
+	return om, err
+}
+
+// NewOutputManager reads a request from in and answers it on out
+//
+// Unlike Init(), stdout is left untouched.
+//
+// Parameters:
+//
+//	in: Reader the request is read from
+//	out: Writer the responses are written to
+//
+// Returns:
+//
+//	*OutputManager: Instance ready for GetData() and Output(), even on error
+//	                (outputs then report the failure to the calling process)
+//	error: ErrNoRequest, malformed request or data
+func NewOutputManager(in io.Reader, out io.Writer) (*OutputManager, error) {
+	om := &OutputManager{
+		out:      out,
+		errors:   []Problem{},
+		warnings: []Problem{},
+		signKey:  outputSigningKey(),
+		encKey:   outputEncryptionKey(),
+	}
+
+	// Read the request line (the JSON request from InputManager)
+	om.stdin = bufio.NewReader(in)
+	line, readErr := readMessage(om.stdin, om.signKey)
+	om.requestJSON = line
+	if line == "" {
+		if readErr == nil || readErr == io.EOF {
+			readErr = ErrNoRequest
+		}
+		om.files = make(map[string][]byte)
+		return om, readErr
 	}
-	globalOutputManager.requestJSON = input.String()
 
 	var requestData map[string]interface{}
-	json.Unmarshal([]byte(globalOutputManager.requestJSON), &requestData)
+	if err := unmarshalNumbers([]byte(om.requestJSON), &requestData); err != nil {
+		om.files = make(map[string][]byte)
+		return om, fmt.Errorf("Malformed request: %s", err.Error())
+	} else if requestData == nil {
+		om.files = make(map[string][]byte)
+		return om, errors.New("Malformed request: not a JSON object")
+	}
+
+	// Files sent with the request follow it as chunk lines
+	filesErr := readRequestFiles(om, requestData["files"])
+	om.acceptFiles, _ = requestData["accept_files"].(bool)
+	om.acceptCallbacks, _ = requestData["accept_callbacks"].(bool)
+	om.acceptProblems, _ = requestData["accept_problems"].(bool)
+	om.captureRequested, _ = requestData["capture_stdout"].(bool)
+
+	decodeErr := decryptMessageData(requestData, om.encKey)
+	if decodeErr == nil {
+		decodeErr = decodeMessageData(requestData, 0)
+	}
+	om.codec = negotiateCodec(requestData["accept"])
+	om.compression = negotiateCompressor(requestData["accept_compression"])
+	om.threshold = DefaultCompressionThreshold
+	if threshold, ok := numberValue(requestData["compression_threshold"]); ok && threshold > 0 {
+		om.threshold = int(threshold)
+	}
+	// Callers that don't announce a size can't reassemble chunks
+	if size, ok := numberValue(requestData["max_message_size"]); ok && size > 0 {
+		om.maxMessageSize = int(size)
+	}
 
 	if key, ok := requestData["key"].(string); ok {
-		globalOutputManager.key = key
+		om.key = key
 	}
 
 	if data, ok := requestData["data"]; ok {
 		dataBytes, _ := json.Marshal(data)
-		globalOutputManager.data = string(dataBytes)
+		om.data = string(dataBytes)
 	}
 
 	if opt, ok := requestData["optionalOutput"].(bool); ok {
-		globalOutputManager.optionalOutput = opt
+		om.optionalOutput = opt
+	}
+
+	if dataType, ok := requestData["data_type"].(string); ok {
+		om.dataType = dataType
+	}
+
+	if method, ok := requestData["method"].(string); ok {
+		om.method = method
+	}
+
+	if deadline, ok := requestData["deadline"].(string); ok {
+		om.deadline, _ = time.Parse(time.RFC3339Nano, deadline)
+	}
+
+	om.fields = make(map[string]string)
+	if fields, ok := requestData["fields"].(map[string]interface{}); ok {
+		for name, value := range fields {
+			valueBytes, _ := json.Marshal(value)
+			om.fields[name] = string(valueBytes)
+		}
+	}
+
+	om.traceParent, _ = requestData["traceparent"].(string)
+	om.correlation, _ = requestData["correlation_id"].(string)
+
+	om.meta = make(map[string]string)
+	if meta, ok := requestData["meta"].(map[string]interface{}); ok {
+		for name, value := range meta {
+			if str, ok := value.(string); ok {
+				om.meta[name] = str
+			}
+		}
 	}
 
 	if uniq, ok := requestData["isUnique"].(bool); ok {
-		globalOutputManager.isUnique = uniq
+		om.isUnique = uniq
 	}
 
 	// Reset state for new request
-	globalOutputManager.errors = []string{}
-	globalOutputManager.warnings = []string{}
-	globalOutputManager.initError = false
-	globalOutputManager.requestStatusSet = false
-	globalOutputManager.uniqueStateSet = false
+	om.errors = []Problem{}
+	om.warnings = []Problem{}
+	om.initError = false
+	om.requestStatusSet = false
+	om.uniqueStateSet = false
+	if decodeErr != nil {
+		om.errors = append(om.errors, Problem{Code: CodeInvalidRequest, Message: decodeErr.Error()})
+	}
+	if filesErr != nil {
+		om.errors = append(om.errors, Problem{Code: CodeInvalidRequest, Message: filesErr.Error()})
+	}
+
+	// Only callers speaking a versioned protocol expect a handshake
+	_, om.versioned = requestData["version"]
+	if version, ok := numberValue(requestData["version"]); ok {
+		om.version = int(version)
+	}
+	om.transport, _ = requestData["transport"].(string)
+	if pid, ok := numberValue(requestData["parent_pid"]); ok {
+		om.parentPID = int(pid)
+	}
+	if om.versioned && om.key != "" {
+		om.emitMessage(handshakeMessage(om.key))
+	}
+	if decodeErr != nil {
+		return om, decodeErr
+	}
+	return om, filesErr
+}
+
+// Read the file chunks announced by the request
+func readRequestFiles(om *OutputManager, announced interface{}) error {
+	om.files = make(map[string][]byte)
+	names, _ := announced.([]interface{})
+	assembler := newFileAssembler()
+	for len(om.files) < len(names) {
+		line, err := om.stdin.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			verified, verifyErr := verifyMessage(om.signKey, []byte(strings.TrimSpace(line)))
+			if verifyErr != nil {
+				return verifyErr
+			}
+			var chunk map[string]interface{}
+			if unmarshalNumbers(verified, &chunk) == nil && messageChannel(chunk) == ChannelFile {
+				name, addErr := assembler.add(chunk)
+				if addErr != nil {
+					return addErr
+				}
+				if name != "" {
+					om.files[name] = assembler.files[name]
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Expected %d file(s), received %d", len(names), len(om.files))
+		}
+	}
+	return nil
+}
+
+// Get the request data, or a named field of it, as a JSON string
+func (om *OutputManager) requestData(name []string) string {
+	if om == nil {
+		return ""
+	}
+	if len(name) > 0 {
+		return om.fields[name[0]]
+	}
+	return om.data
 }
 
 // GetData returns the request data with proper type conversion
 //
+// Parameters:
+//
+//	name: Optional field name, to get one of the fields sent with RequestFields()
+//
 // Returns:
 //
 //	any: The data with appropriate Go type (int for whole numbers, float64 for decimals, etc.)
-func GetData() any {
+//	     nil when the field doesn't exist
+//
+// Note:
+//
+//	Numbers nested in lists and maps are float64, use GetDataExact() to
+//	keep integers above 2^53 intact.
+func (om *OutputManager) GetData(name ...string) any {
 	var result any
-	if globalOutputManager != nil {
-		json.Unmarshal([]byte(globalOutputManager.data), &result)
-		// Convert float64 to int if it's a whole number
-		if f, ok := result.(float64); ok {
-			if f == float64(int(f)) {
-				return int(f)
-			}
+	if data := om.requestData(name); data != "" {
+		unmarshalNumbers([]byte(data), &result)
+		// Whole numbers become int (int64/uint64 when too large), nested ones float64
+		if n, ok := result.(json.Number); ok {
+			return convertNumber(n)
 		}
+		result = nil
+		outputUnmarshal([]byte(data), &result)
+	}
+	return result
+}
+
+// GetDataExact returns the request data with every number as json.Number
+//
+// Unlike GetData(), no number is rounded: read them with Int64(),
+// Float64() or String() (e.g. 64-bit IDs, big integers).
+//
+// Parameters:
+//
+//	name: Optional field name, to get one of the fields sent with RequestFields()
+//
+// Returns:
+//
+//	any: The data, numbers included at any depth as json.Number
+func (om *OutputManager) GetDataExact(name ...string) any {
+	var result any
+	if data := om.requestData(name); data != "" {
+		unmarshalNumbers([]byte(data), &result)
 	}
 	return result
 }
 
+// GetDataInto decodes the request data into target
+//
+// Parameters:
+//
+//	target: Pointer to the value to fill (struct, slice, map, ...)
+//	name: Optional field name, to get one of the fields sent with RequestFields()
+//
+// Returns:
+//
+//	error: Not initialized, missing field or decoding error
+func (om *OutputManager) GetDataInto(target any, name ...string) error {
+	if om == nil || om.data == "" {
+		return errors.New("OutputManager isn't initialized")
+	}
+	data := om.requestData(name)
+	if data == "" {
+		return fmt.Errorf("Field not found: %s", name[0])
+	}
+	if err := outputUnmarshal([]byte(data), target); err != nil {
+		return fmt.Errorf("Invalid request data: %s", err.Error())
+	}
+	return nil
+}
+
+// GetDataAs decodes the request data into a value of type T
+//
+// Generic shortcut for GetDataInto(), e.g.:
+//
+//	order, err := GetDataAs[Order]()
+//
+// Parameters:
+//
+//	name: Optional field name, to get one of the fields sent with RequestFields()
+//
+// Returns:
+//
+//	T: Decoded data, zero value on error
+//	error: Not initialized, missing field or decoding error
+func GetDataAs[T any](name ...string) (T, error) {
+	var value T
+	err := autoOutputManager().GetDataInto(&value, name...)
+	return value, err
+}
+
+// GetFieldNames returns the names of the fields sent with RequestFields()
+//
+// Returns:
+//
+//	[]string: Field names, sorted (empty for a plain Request())
+func (om *OutputManager) GetFieldNames() []string {
+	names := []string{}
+	if om != nil {
+		for name := range om.fields {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetMeta returns the metadata attached to the request with WithMeta()
+//
+// Returns:
+//
+//	map[string]string: Metadata entries (empty when there are none)
+func (om *OutputManager) GetMeta() map[string]string {
+	meta := make(map[string]string)
+	if om != nil {
+		for name, value := range om.meta {
+			meta[name] = value
+		}
+	}
+	return meta
+}
+
+// Stdin returns the input following the request on stdin
+//
+// The calling process fills it with WithStdin(), it is empty otherwise.
+//
+// Returns:
+//
+//	io.Reader: Remaining stdin of the process
+func (om *OutputManager) Stdin() io.Reader {
+	if om == nil || om.stdin == nil {
+		return strings.NewReader("")
+	}
+	return om.stdin
+}
+
+// IsUnique tells whether the calling process expects a single output
+//
+// Returns:
+//
+//	bool: true if only one Output() is allowed (isUnique=true)
+func (om *OutputManager) IsUnique() bool {
+	return om != nil && om.isUnique
+}
+
+// OptionalOutputAllowed tells whether the calling process accepts no output
+//
+// Returns:
+//
+//	bool: true if the request may end without any Output()
+func (om *OutputManager) OptionalOutputAllowed() bool {
+	return om != nil && om.optionalOutput
+}
+
+// Key returns the key matching responses to the request
+//
+// Returns:
+//
+//	string: Request key, empty when no request was read
+func (om *OutputManager) Key() string {
+	if om == nil {
+		return ""
+	}
+	return om.key
+}
+
 // Bundle converts any data to a JSON string for use with Output()
 //
 // Parameters:
@@ -511,7 +1804,7 @@ func GetData() any {
 //
 //	string: JSON string representation of the data
 func Bundle(data interface{}) string {
-	jsonBytes, _ := json.Marshal(data)
+	jsonBytes, _ := outputMarshal(data)
 	return string(jsonBytes)
 }
 
@@ -525,98 +1818,248 @@ func Bundle(data interface{}) string {
 //
 //	Can be called multiple times if isUnique=false in request.
 //	Will error if called multiple times when isUnique=true.
-func Output(data string) {
+func (om *OutputManager) Output(data string) {
+	// JSON data is sent as is, other codecs need it decoded
+	if om != nil && (om.codec == "" || om.codec == CodecJSON) && data != "null" && json.Valid([]byte(data)) {
+		om.writeOutput(json.RawMessage(data), "", nil)
+		return
+	}
+	var parsed interface{}
+	unmarshalNumbers([]byte(data), &parsed)
+	om.writeOutput(parsed, "", nil)
+}
+
+// Write a protocol message to the calling process
+func (om *OutputManager) emitMessage(message map[string]interface{}) {
+	messageBytes, _ := json.Marshal(message)
+	om.writeMessage(messageBytes)
+}
+
+// Write one output response
+//
+// Parameters:
+//
+//	parsed: Decoded data to send
+//	codecName: Codec encoding the data ("" for the negotiated codec)
+//	fields: Extra envelope fields describing the data
+func (om *OutputManager) writeOutput(parsed interface{}, codecName string, fields map[string]interface{}) {
 	// Check if OutputManager was initialized
-	if globalOutputManager == nil || globalOutputManager.data == "" {
-		if globalOutputManager != nil && !globalOutputManager.initError {
+	if om == nil || om.data == "" {
+		if om != nil && !om.initError {
 			// Restore original stdout to actually write the response
-			os.Stdout = globalOutputManager.originalStdout
+			om.restoreStdout()
 
-			globalOutputManager.requestStatus = false
-			globalOutputManager.errors = append(globalOutputManager.errors, "Error: OutputManager isn't initialized.")
+			om.requestStatus = false
+			om.errors = append(om.errors, Problem{Code: CodeNotInitialized, Message: "OutputManager isn't initialized."})
 
 			// Build and write JSON response
 			response := map[string]interface{}{
 				"key":            nil,
 				"request_status": false,
 				"data":           nil,
-				"optionalOutput": globalOutputManager.optionalOutput,
+				"optionalOutput": om.optionalOutput,
 				"isUnique":       nil,
-				"errors":         globalOutputManager.errors,
-				"warnings":       globalOutputManager.warnings,
+				"errors":         om.problemList(om.errors, "Error: "),
+				"warnings":       om.problemList(om.warnings, "Warning: "),
 			}
 
 			responseBytes, _ := json.Marshal(response)
-			fmt.Fprintln(globalOutputManager.originalStdout, string(responseBytes))
+			om.writeMessage(responseBytes)
 
-			globalOutputManager.initError = true
+			om.initError = true
 		}
 		return
 	}
 
 	// Check if we can output based on isUnique setting
 	// uniqueStateSet tracks if we've already output once
-	if !globalOutputManager.uniqueStateSet || !globalOutputManager.isUnique {
-		globalOutputManager.requestStatus = true
+	if !om.uniqueStateSet || !om.isUnique {
+		om.requestStatus = true
 
 		// Restore original stdout to actually write the response
-		os.Stdout = globalOutputManager.originalStdout
-
-		var parsed interface{}
-		json.Unmarshal([]byte(data), &parsed)
+		om.restoreStdout()
 
 		// Build and write JSON response
 		response := map[string]interface{}{
-			"key":            globalOutputManager.key,
+			"key":            om.key,
 			"request_status": true,
 			"data":           parsed,
-			"optionalOutput": globalOutputManager.optionalOutput,
-			"isUnique":       globalOutputManager.isUnique,
+			"optionalOutput": om.optionalOutput,
+			"isUnique":       om.isUnique,
 			"errors":         []string{},
-			"warnings":       []string{},
+			"warnings":       om.problemList(om.warnings, "Warning: "),
+		}
+		// Pending warnings (see Warn()) are sent once
+		om.warnings = []Problem{}
+		for name, value := range fields {
+			response[name] = value
+		}
+		if codecName == "" {
+			codecName = om.codec
 		}
+		encodeMessageData(response, codecName)
+		compressMessageData(response, om.compression, om.threshold)
+		encryptMessageData(response, om.encKey)
 
 		responseBytes, _ := json.Marshal(response)
-		fmt.Fprintln(globalOutputManager.originalStdout, string(responseBytes))
+		om.writeResponse(responseBytes)
 
 	} else {
 		// Multiple outputs when isUnique=true is an error
-		globalOutputManager.requestStatus = false
-		uniqueStateValue := globalOutputManager.uniqueState
-		globalOutputManager.errors = append(globalOutputManager.errors, fmt.Sprintf("Error: outputs out of bound (isUnique: %v).", uniqueStateValue))
+		om.requestStatus = false
+		uniqueStateValue := om.uniqueState
+		om.errors = append(om.errors, Problem{Code: CodeOutOfBound, Message: fmt.Sprintf("outputs out of bound (isUnique: %v).", uniqueStateValue)})
 
 		// Restore original stdout
-		os.Stdout = globalOutputManager.originalStdout
-
-		var parsed interface{}
-		json.Unmarshal([]byte(data), &parsed)
+		om.restoreStdout()
 
 		response := map[string]interface{}{
-			"key":            globalOutputManager.key,
+			"key":            om.key,
 			"request_status": false,
 			"data":           parsed,
-			"optionalOutput": globalOutputManager.optionalOutput,
-			"isUnique":       globalOutputManager.isUnique,
-			"errors":         globalOutputManager.errors,
-			"warnings":       globalOutputManager.warnings,
+			"optionalOutput": om.optionalOutput,
+			"isUnique":       om.isUnique,
+			"errors":         om.problemList(om.errors, "Error: "),
+			"warnings":       om.problemList(om.warnings, "Warning: "),
+		}
+		for name, value := range fields {
+			response[name] = value
 		}
+		if codecName == "" {
+			codecName = om.codec
+		}
+		encodeMessageData(response, codecName)
+		compressMessageData(response, om.compression, om.threshold)
+		encryptMessageData(response, om.encKey)
 
 		responseBytes, _ := json.Marshal(response)
-		fmt.Fprintln(globalOutputManager.originalStdout, string(responseBytes))
+		om.writeResponse(responseBytes)
 	}
 
 	// Mark that we've output once
-	globalOutputManager.uniqueState = globalOutputManager.isUnique
-	globalOutputManager.uniqueStateSet = true
+	om.uniqueState = om.isUnique
+	om.uniqueStateSet = true
 
 	// Re-suppress stdout after writing response
-	os.Stdout = nil
+	om.suppressStdout()
+}
+
+// Write a request_status=false response carrying errors
+//
+// The failure counts as the output of the request, outputs held back by
+// BufferOutput() are dropped.
+func (om *OutputManager) writeFailure(errs []Problem, fields map[string]interface{}) {
+	om.discardPending()
+	om.requestStatus = false
+	om.errors = append(om.errors, errs...)
+	response := map[string]interface{}{
+		"key":            om.key,
+		"request_status": false,
+		"data":           nil,
+		"optionalOutput": om.optionalOutput,
+		"isUnique":       om.isUnique,
+		"errors":         om.problemList(om.errors, "Error: "),
+		"warnings":       om.problemList(om.warnings, "Warning: "),
+	}
+	for name, value := range fields {
+		response[name] = value
+	}
+	om.emitMessage(response)
+
+	om.uniqueState = om.isUnique
+	om.uniqueStateSet = true
+}
+
+// Restore the stdout suppressed by Init()
+func (om *OutputManager) restoreStdout() {
+	if om.originalStdout != nil {
+		os.Stdout = om.originalStdout
+	}
+}
+
+// Suppress stdout again after a write (Init() instances only)
+func (om *OutputManager) suppressStdout() {
+	if om.capture != nil {
+		os.Stdout = om.capture.w
+	} else if om.originalStdout != nil {
+		os.Stdout = nil
+	}
 }
 
 // Cleanup cleans up OutputManager resources
-func Cleanup() {
-	if globalOutputManager != nil {
-		globalOutputManager.errors = []string{}
-		globalOutputManager.warnings = []string{}
+//
+// Ends the request properly even on early returns (defer Cleanup()):
+// outputs held back by BufferOutput() are written, a failure is sent when
+// a required output is missing, the final status is sent on ChannelDone
+// and stdout is restored. Calling it again does nothing.
+func (om *OutputManager) Cleanup() {
+	if om == nil || om.closed {
+		return
 	}
+	if om.data != "" && !om.uniqueStateSet && !om.optionalOutput {
+		om.writeFailure([]Problem{{Code: CodeNoOutput, Message: "the target ended without output."}}, nil)
+	}
+	om.Flush()
+	om.printed = om.stopCapture()
+	om.writeDone()
+	om.restoreStdout()
+	om.errors = []Problem{}
+	om.warnings = []Problem{}
+	// Init() may read the next request
+	om.closed = true
+}
+
+// GetData calls GetData() on the OutputManager created by Init()
+func GetData(name ...string) any {
+	return autoOutputManager().GetData(name...)
+}
+
+// GetDataExact calls GetDataExact() on the OutputManager created by Init()
+func GetDataExact(name ...string) any {
+	return autoOutputManager().GetDataExact(name...)
+}
+
+// GetDataInto calls GetDataInto() on the OutputManager created by Init()
+func GetDataInto(target any, name ...string) error {
+	return autoOutputManager().GetDataInto(target, name...)
+}
+
+// GetFieldNames calls GetFieldNames() on the OutputManager created by Init()
+func GetFieldNames() []string {
+	return autoOutputManager().GetFieldNames()
+}
+
+// GetMeta calls GetMeta() on the OutputManager created by Init()
+func GetMeta() map[string]string {
+	return autoOutputManager().GetMeta()
+}
+
+// Stdin calls Stdin() on the OutputManager created by Init()
+func Stdin() io.Reader {
+	return autoOutputManager().Stdin()
+}
+
+// IsUnique calls IsUnique() on the OutputManager created by Init()
+func IsUnique() bool {
+	return autoOutputManager().IsUnique()
+}
+
+// OptionalOutputAllowed calls OptionalOutputAllowed() on the OutputManager created by Init()
+func OptionalOutputAllowed() bool {
+	return autoOutputManager().OptionalOutputAllowed()
+}
+
+// Key calls Key() on the OutputManager created by Init()
+func Key() string {
+	return autoOutputManager().Key()
+}
+
+// Output calls Output() on the OutputManager created by Init()
+func Output(data string) {
+	autoOutputManager().Output(data)
+}
+
+// Cleanup calls Cleanup() on the OutputManager created by Init()
+func Cleanup() {
+	globalOutputManager.Cleanup()
 }
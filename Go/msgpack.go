@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CodecMsgpack encodes data as MessagePack
+const CodecMsgpack = "msgpack"
+
+func init() {
+	RegisterCodec(msgpackCodec{})
+}
+
+// Extension type of numbers float64 can't hold exactly, as their JSON text
+const msgpackExtNumber = 1
+
+// MessagePack codec for generic values
+//
+// Whole float64 values (as produced by encoding/json) are encoded as
+// integers, which keeps numeric arrays compact. Integers above
+// math.MaxInt64 use uint64, larger integers and decimals float64 would
+// round use the msgpackExtNumber extension type.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return CodecMsgpack
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpackAppend(nil, v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte) (interface{}, error) {
+	d := &msgpackDecoder{data: data}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, errors.New("msgpack: trailing bytes")
+	}
+	return v, nil
+}
+
+func msgpackAppend(b []byte, v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if x {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int:
+		return msgpackAppendInt(b, int64(x)), nil
+	case int64:
+		return msgpackAppendInt(b, x), nil
+	case int32:
+		return msgpackAppendInt(b, int64(x)), nil
+	case uint64:
+		if x > math.MaxInt64 {
+			return binary.BigEndian.AppendUint64(append(b, 0xcf), x), nil
+		}
+		return msgpackAppendInt(b, int64(x)), nil
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1<<63 {
+			return msgpackAppendInt(b, int64(x)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(x)), nil
+	case float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(x)), nil
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return msgpackAppendInt(b, i), nil
+		}
+		if u, ok := parseUint64(string(x)); ok {
+			return binary.BigEndian.AppendUint64(append(b, 0xcf), u), nil
+		}
+		if f, exact := exactFloat(x); exact {
+			return msgpackAppend(b, f)
+		}
+		if _, _, ok := decimalParts(string(x)); !ok {
+			return nil, fmt.Errorf("msgpack: invalid number %s", x)
+		}
+		return msgpackAppendExt(b, msgpackExtNumber, []byte(x)), nil
+	case string:
+		n := len(x)
+		switch {
+		case n < 32:
+			b = append(b, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			b = append(b, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+		}
+		return append(b, x...), nil
+	case []byte:
+		n := len(x)
+		switch {
+		case n <= math.MaxUint8:
+			b = append(b, 0xc4, byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+		}
+		return append(b, x...), nil
+	case []interface{}:
+		n := len(x)
+		switch {
+		case n < 16:
+			b = append(b, 0x90|byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+		}
+		var err error
+		for _, item := range x {
+			if b, err = msgpackAppend(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		n := len(x)
+		switch {
+		case n < 16:
+			b = append(b, 0x80|byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+		}
+		keys := make([]string, 0, n)
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, key := range keys {
+			b, _ = msgpackAppend(b, key)
+			if b, err = msgpackAppend(b, x[key]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		// Other Go values: go through their JSON form
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(jsonBytes, &generic); err != nil {
+			return nil, err
+		}
+		return msgpackAppend(b, generic)
+	}
+}
+
+func msgpackAppendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func msgpackAppendExt(b []byte, extType int8, data []byte) []byte {
+	n := len(data)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc7, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc8), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc9), uint32(n))
+	}
+	return append(append(b, byte(extType)), data...)
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errors.New("msgpack: unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) readUint(n int) (uint64, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	tag, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	c := tag[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readUint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(int(n))
+		return append([]byte{}, b...), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readUint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(int(n))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (c - 0xd4))
+	case 0xca:
+		n, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.readUint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.readUint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 0xd0:
+		n, err := d.readUint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.readUint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.readUint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.readUint(8)
+		return int64(n), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readUint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.readUint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(n))
+	case 0xde, 0xdf:
+		n, err := d.readUint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(n))
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+}
+
+// Decode the type and data of an extension, only msgpackExtNumber is known
+func (d *msgpackDecoder) decodeExt(n int) (interface{}, error) {
+	extType, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(extType[0]) != msgpackExtNumber {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", int8(extType[0]))
+	}
+	if _, _, ok := decimalParts(string(data)); !ok {
+		return nil, fmt.Errorf("msgpack: invalid number %q", data)
+	}
+	return json.Number(data), nil
+}
+
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	b, err := d.read(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) decodeArray(n int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errors.New("msgpack: unexpected end of data")
+	}
+	list := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		item, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errors.New("msgpack: unexpected end of data")
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := key.(string); ok {
+			m[s] = value
+		} else {
+			m[fmt.Sprint(key)] = value
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+// Document holding every value type a codec must carry
+const codecDocument = `{"int":42,"negative":-300000,"float":1.5,"string":"héllo \"wörld\"\n","empty":"","null":null,"true":true,"false":false,"list":[1,"a",null,[]],"object":{"nested":{"deep":[{}]}},"long":"` +
+	`0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}`
+
+// Encode and decode codecDocument with a codec, it must come back unchanged
+func testCodecRoundTrip(t *testing.T, codec Codec) {
+	var value interface{}
+	json.Unmarshal([]byte(codecDocument), &value)
+	encoded, err := codec.Marshal(value)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	decoded, err := codec.Unmarshal(encoded)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	got, _ := json.Marshal(decoded)
+	want, _ := json.Marshal(value)
+	if string(got) != string(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if _, err := codec.Unmarshal(encoded[:len(encoded)-1]); err == nil {
+		t.Error("truncated data decoded without error")
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	testCodecRoundTrip(t, msgpackCodec{})
+}
+
+// Numbers float64 can't hold, and ordinary ones that must stay compact
+var exactNumbers = []string{
+	"0",
+	"42",
+	"-7",
+	"1.5",
+	"0.1",
+	"1e21",
+	"-9223372036854775808",
+	"9223372036854775807",
+	"9223372036854775808",
+	"18446744073709551615",
+	"18446744073709551616",
+	"123456789012345678901234567890",
+	"-123456789012345678901234567890",
+	"3.14159265358979323846",
+	"-0.000000000000000000000000000001234567890123456789",
+}
+
+// Encode and decode each number with a codec, its value must not change
+func testNumberRoundTrip(t *testing.T, codec Codec) {
+	for _, text := range exactNumbers {
+		var value interface{}
+		if err := unmarshalNumbers([]byte(`[`+text+`]`), &value); err != nil {
+			t.Fatalf("%s: %v", text, err)
+		}
+		encoded, err := codec.Marshal(value)
+		if err != nil {
+			t.Errorf("%s: Marshal: %v", text, err)
+			continue
+		}
+		decoded, err := codec.Unmarshal(encoded)
+		if err != nil {
+			t.Errorf("%s: Unmarshal: %v", text, err)
+			continue
+		}
+		decodedJSON, _ := json.Marshal(decoded)
+		var got []json.Number
+		if err := unmarshalNumbers(decodedJSON, &got); err != nil || len(got) != 1 {
+			t.Errorf("%s: decoded to %s", text, decodedJSON)
+			continue
+		}
+		if !sameNumber(string(got[0]), text) {
+			t.Errorf("%s: decoded to %s", text, got[0])
+		}
+	}
+}
+
+// Tell whether two JSON number literals have the same value
+func sameNumber(a, b string) bool {
+	x, okA := new(big.Rat).SetString(a)
+	y, okB := new(big.Rat).SetString(b)
+	return okA && okB && x.Cmp(y) == 0
+}
+
+func TestMsgpackNumberRoundTrip(t *testing.T) {
+	testNumberRoundTrip(t, msgpackCodec{})
+}
+
+func TestMsgpackUint64(t *testing.T) {
+	encoded, err := msgpackCodec{}.Marshal(json.Number("18446744073709551615"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded[0] != 0xcf {
+		t.Errorf("expected uint 64 (0xcf), got 0x%02x", encoded[0])
+	}
+}
+
+func TestMsgpackInvalidNumber(t *testing.T) {
+	if _, err := (msgpackCodec{}).Marshal(json.Number("12abc")); err == nil {
+		t.Error("expected an error for an invalid number")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Mux shares one Transport between several interleaved conversations
+//
+// Messages are routed to conversations by their key, so many requests
+// (and their logs, progress or callback channels) can be in flight over a
+// single persistent connection. The target must end each conversation
+// with a message on ChannelDone.
+//
+// Usage:
+//
+//	mux := NewMux(NewTCPTransport(address, nil))
+//	mux.Open(Target{})
+//	defer mux.Close()
+//	im := NewInputManager(WithTransport(mux.Transport()))
+type Mux struct {
+	transport     Transport
+	sendMu        sync.Mutex
+	mu            sync.Mutex
+	conversations map[string]*muxRoute
+	err           error
+	closed        bool
+}
+
+// Messages routed to one conversation, done is closed when it ends
+//
+// messages is never closed: readLoop sends without holding the Mux lock,
+// so it gives up on done instead.
+type muxRoute struct {
+	messages chan []byte
+	done     chan struct{}
+}
+
+// NewMux creates a new Mux over a transport
+//
+// Parameters:
+//
+//	transport: Shared connection to the target
+func NewMux(transport Transport) *Mux {
+	return &Mux{
+		transport:     transport,
+		conversations: make(map[string]*muxRoute),
+	}
+}
+
+// Open opens the shared transport and starts routing its messages
+func (m *Mux) Open(target Target) error {
+	if err := m.transport.Open(target); err != nil {
+		return err
+	}
+	go m.readLoop()
+	return nil
+}
+
+// Transport returns a Transport for one conversation over the shared connection
+func (m *Mux) Transport() Transport {
+	return &muxConversation{mux: m}
+}
+
+// Close closes the shared transport, ending all conversations
+func (m *Mux) Close() error {
+	return m.transport.Close()
+}
+
+// Route incoming messages to their conversation until the transport ends
+func (m *Mux) readLoop() {
+	for {
+		line, err := m.transport.Receive()
+		if err != nil {
+			m.mu.Lock()
+			if err != io.EOF {
+				m.err = err
+			}
+			m.closed = true
+			for key, route := range m.conversations {
+				close(route.done)
+				delete(m.conversations, key)
+			}
+			m.mu.Unlock()
+			return
+		}
+
+		var header struct {
+			Key *string `json:"key"`
+		}
+		if json.Unmarshal(line, &header) != nil {
+			continue
+		}
+
+		// Routes are picked under the lock, a slow conversation must not
+		// block register()/unregister() while the message waits for it
+		routes := []*muxRoute{}
+		m.mu.Lock()
+		if header.Key == nil {
+			// Null key (init errors) concerns every conversation
+			for _, route := range m.conversations {
+				routes = append(routes, route)
+			}
+		} else if route, ok := m.conversations[*header.Key]; ok {
+			routes = append(routes, route)
+		}
+		m.mu.Unlock()
+		for _, route := range routes {
+			select {
+			case route.messages <- line:
+			case <-route.done:
+			}
+		}
+	}
+}
+
+// Register a conversation before its request is sent
+func (m *Mux) register(key string) (*muxRoute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		if m.err != nil {
+			return nil, m.err
+		}
+		return nil, errors.New("Connection closed")
+	}
+	// A conversation still holding the key is ended
+	if stale, ok := m.conversations[key]; ok {
+		close(stale.done)
+	}
+	route := &muxRoute{messages: make(chan []byte, 256), done: make(chan struct{})}
+	m.conversations[key] = route
+	return route, nil
+}
+
+// Remove a conversation, unless its key was taken by a newer one
+func (m *Mux) unregister(key string, route *muxRoute) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conversations[key] == route {
+		close(route.done)
+		delete(m.conversations, key)
+	}
+}
+
+// Send a message over the shared connection
+func (m *Mux) send(message []byte) error {
+	m.sendMu.Lock()
+	defer m.sendMu.Unlock()
+	return m.transport.Send(message)
+}
+
+// One conversation over a Mux
+type muxConversation struct {
+	mux   *Mux
+	key   string
+	route *muxRoute
+}
+
+// Open starts a new request, the route of the previous one is dropped
+func (c *muxConversation) Open(target Target) error {
+	c.reset()
+	return nil
+}
+
+func (c *muxConversation) Send(message []byte) error {
+	if c.route == nil {
+		var header struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(message, &header); err != nil {
+			return err
+		}
+		route, err := c.mux.register(header.Key)
+		if err != nil {
+			return err
+		}
+		c.key = header.Key
+		c.route = route
+	}
+	return c.mux.send(message)
+}
+
+func (c *muxConversation) Receive() ([]byte, error) {
+	if c.route == nil {
+		return nil, io.EOF
+	}
+	var line []byte
+	select {
+	case line = <-c.route.messages:
+	case <-c.route.done:
+		// Messages routed before the end are still delivered
+		select {
+		case line = <-c.route.messages:
+		default:
+			return nil, io.EOF
+		}
+	}
+
+	var message map[string]interface{}
+	if json.Unmarshal(line, &message) == nil && messageChannel(message) == ChannelDone {
+		c.mux.unregister(c.key, c.route)
+	}
+	return line, nil
+}
+
+func (c *muxConversation) Close() error {
+	c.reset()
+	return nil
+}
+
+// Unregister the route of the current request, if any
+func (c *muxConversation) reset() {
+	if c.route != nil {
+		c.mux.unregister(c.key, c.route)
+	}
+	c.key, c.route = "", nil
+}
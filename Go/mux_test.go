@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// Transport receiving the lines written to a channel
+type pipeTransport struct {
+	lines chan []byte
+}
+
+func (t *pipeTransport) Open(target Target) error {
+	return nil
+}
+
+func (t *pipeTransport) Send(message []byte) error {
+	return nil
+}
+
+func (t *pipeTransport) Receive() ([]byte, error) {
+	line, ok := <-t.lines
+	if !ok {
+		return nil, io.EOF
+	}
+	return line, nil
+}
+
+func (t *pipeTransport) Close() error {
+	return nil
+}
+
+func TestMuxInterleavedConversations(t *testing.T) {
+	pipe := &pipeTransport{lines: make(chan []byte, 8)}
+	mux := NewMux(pipe)
+	mux.Open(Target{})
+	a, b := mux.Transport(), mux.Transport()
+	a.Send([]byte(`{"key":"a"}`))
+	b.Send([]byte(`{"key":"b"}`))
+
+	pipe.lines <- []byte(`{"key":"b","data":"b1"}`)
+	pipe.lines <- []byte(`{"key":"a","data":"a1"}`)
+	pipe.lines <- []byte(`{"key":"other","data":"x"}`)
+	pipe.lines <- []byte(`{"key":"a","channel":"done"}`)
+	pipe.lines <- []byte(`{"key":"b","channel":"done"}`)
+
+	for _, c := range []struct {
+		transport Transport
+		want      []string
+	}{
+		{a, []string{`{"key":"a","data":"a1"}`, `{"key":"a","channel":"done"}`}},
+		{b, []string{`{"key":"b","data":"b1"}`, `{"key":"b","channel":"done"}`}},
+	} {
+		for _, want := range c.want {
+			line, err := c.transport.Receive()
+			if err != nil || string(line) != want {
+				t.Fatalf("expected %s, got %s (%v)", want, line, err)
+			}
+		}
+		// The conversation ended on ChannelDone
+		if _, err := c.transport.Receive(); err != io.EOF {
+			t.Errorf("expected io.EOF after the done message, got %v", err)
+		}
+	}
+	close(pipe.lines)
+}
+
+func TestMuxSlowConversation(t *testing.T) {
+	pipe := &pipeTransport{lines: make(chan []byte)}
+	mux := NewMux(pipe)
+	mux.Open(Target{})
+	slow, fast := mux.Transport(), mux.Transport()
+	slow.Send([]byte(`{"key":"slow"}`))
+	fast.Send([]byte(`{"key":"fast"}`))
+
+	// More messages than the slow conversation buffers, nobody reads them
+	go func() {
+		for i := 0; i < 300; i++ {
+			pipe.lines <- []byte(`{"key":"slow"}`)
+		}
+		pipe.lines <- []byte(`{"key":"fast","data":"1"}`)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		slow.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing a conversation blocked behind its unread messages")
+	}
+
+	received := make(chan string, 1)
+	go func() {
+		line, err := fast.Receive()
+		received <- fmt.Sprint(string(line), err)
+	}()
+	select {
+	case got := <-received:
+		if got != `{"key":"fast","data":"1"}<nil>` {
+			t.Errorf("unexpected message %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow conversation blocked the others")
+	}
+	close(pipe.lines)
+}
+
+func TestMuxSequentialRequests(t *testing.T) {
+	pipe := &pipeTransport{lines: make(chan []byte, 8)}
+	mux := NewMux(pipe)
+	mux.Open(Target{})
+	conversation := mux.Transport()
+
+	// The first request never gets its done message
+	conversation.Open(Target{})
+	conversation.Send([]byte(`{"key":"first"}`))
+	conversation.Open(Target{})
+	conversation.Send([]byte(`{"key":"second"}`))
+
+	pipe.lines <- []byte(`{"key":"first","data":"late"}`)
+	pipe.lines <- []byte(`{"key":"second","data":"2"}`)
+	pipe.lines <- []byte(`{"key":"second","channel":"done"}`)
+	for _, want := range []string{`{"key":"second","data":"2"}`, `{"key":"second","channel":"done"}`} {
+		line, err := conversation.Receive()
+		if err != nil || string(line) != want {
+			t.Fatalf("expected %s, got %s (%v)", want, line, err)
+		}
+	}
+	conversation.Close()
+
+	mux.mu.Lock()
+	left := len(mux.conversations)
+	mux.mu.Unlock()
+	if left != 0 {
+		t.Errorf("expected no route left after both requests, got %d", left)
+	}
+	close(pipe.lines)
+}
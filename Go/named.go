@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// OutputTo sends an output on a named output channel
+//
+// Named outputs ("metrics", "artifacts", ...) are kept apart from the
+// regular outputs: they don't count against isUnique and the calling
+// process gets them with GetChannel(). Calling processes speaking the
+// original protocol get them as regular outputs.
+//
+// Parameters:
+//
+//	channel: Name of the output channel
+//	data: Data to send as JSON string
+func (om *OutputManager) OutputTo(channel, data string) {
+	var parsed interface{}
+	unmarshalNumbers([]byte(data), &parsed)
+	if om == nil || om.data == "" || !om.versioned {
+		om.writeOutput(parsed, "", nil)
+		return
+	}
+	message := map[string]interface{}{
+		"key":     om.key,
+		"channel": ChannelNamed,
+		"name":    channel,
+		"data":    parsed,
+	}
+	encodeMessageData(message, om.codec)
+	compressMessageData(message, om.compression, om.threshold)
+	encryptMessageData(message, om.encKey)
+	om.emitMessage(message)
+}
+
+// Collect an output received on a named output channel
+func (im *InputManager) addNamedOutput(message map[string]interface{}) error {
+	if err := im.decodeResponseData(message); err != nil {
+		return err
+	}
+	name, _ := message["name"].(string)
+	dataBytes, _ := json.Marshal(message["data"])
+	if im.Response.Channels == nil {
+		im.Response.Channels = map[string][]json.RawMessage{}
+	}
+	im.Response.Channels[name] = append(im.Response.Channels[name], json.RawMessage(dataBytes))
+	return nil
+}
+
+// GetChannel returns the outputs received on a named output channel
+//
+// Parameters:
+//
+//	name: Name of the output channel (see OutputTo())
+//
+// Returns:
+//
+//	string: JSON list of the outputs, in order ("[]" when none was received)
+func (im *InputManager) GetChannel(name string) string {
+	outputs := im.Response.Channels[name]
+	if outputs == nil {
+		outputs = []json.RawMessage{}
+	}
+	outputsBytes, _ := json.Marshal(outputs)
+	return string(outputsBytes)
+}
+
+// ChannelNames returns the names of the output channels used by the target
+func (im *InputManager) ChannelNames() []string {
+	names := []string{}
+	for name := range im.Response.Channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OutputTo calls OutputTo() on the OutputManager created by Init()
+func OutputTo(channel, data string) {
+	autoOutputManager().OutputTo(channel, data)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// Nested invocations
+//
+// A target can call other targets with its own InputManager (Go -> Go ->
+// Python pipelines): ProcessTransport gives each target its own pipes, so
+// the stdio of the process stays owned by the OutputManager created by
+// Init(). Only that OutputManager reads stdin and writes stdout, these
+// helpers hand them over explicitly.
+
+// Get the reader forwarded by WithStdin()
+//
+// os.Stdin belongs to the OutputManager created by Init(), which may have
+// buffered past the request: its Stdin() is forwarded instead so no byte
+// is lost.
+func forwardedStdin(r io.Reader) io.Reader {
+	if file, ok := r.(*os.File); !ok || file != os.Stdin {
+		return r
+	}
+	if owner := globalOutputManager; owner != nil && !owner.closed {
+		return owner.Stdin()
+	}
+	return r
+}
+
+// Stop targets started by this process from initializing themselves
+//
+// AutoInitEnv is meant for the process started by ProcessTransport, not
+// for the processes it starts itself (ProcessTransport sets it again for
+// its own targets).
+func releaseAutoInitEnv() {
+	os.Unsetenv(AutoInitEnv)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLSOptions describes the TLS settings of a network transport
+//
+// Fields:
+//
+//	CAFile: PEM bundle used to verify the peer (default: system roots)
+//	CertFile: PEM certificate presented to the peer (mutual TLS)
+//	KeyFile: PEM private key matching CertFile
+//	ServerName: Expected server name (default: host of the address)
+//	PinnedSHA256: Hex SHA-256 of accepted peer public keys (SubjectPublicKeyInfo)
+//	ClientAuth: Server side only, require client certificates signed by CAFile
+//	InsecureSkipVerify: Skip chain verification, only allowed together with PinnedSHA256
+type TLSOptions struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	PinnedSHA256       []string
+	ClientAuth         bool
+	InsecureSkipVerify bool
+}
+
+// NewTLSConfig builds a *tls.Config from TLSOptions
+//
+// The result can be used by TCPTransport, HTTPTransport, or by the listener
+// serving the other end of the connection.
+//
+// Parameters:
+//
+//	opts: TLS settings
+//
+// Returns:
+//
+//	*tls.Config: Configuration enforcing TLS 1.2+, optional client certificates and pins
+//	error: Unreadable certificate files or inconsistent options
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: opts.ServerName,
+	}
+
+	if opts.InsecureSkipVerify {
+		if len(opts.PinnedSHA256) == 0 {
+			return nil, errors.New("InsecureSkipVerify requires at least one pinned key")
+		}
+		config.InsecureSkipVerify = true
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA file: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in CA file: %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+		config.ClientCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load certificate: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.ClientAuth {
+		if config.ClientCAs == nil {
+			return nil, errors.New("ClientAuth requires a CAFile")
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if len(opts.PinnedSHA256) > 0 {
+		pins := make(map[string]bool, len(opts.PinnedSHA256))
+		for _, pin := range opts.PinnedSHA256 {
+			pins[strings.ToLower(strings.ReplaceAll(pin, ":", ""))] = true
+		}
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("Certificate pinning failed: peer sent no certificate")
+			}
+			sum := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			if !pins[hex.EncodeToString(sum[:])] {
+				return errors.New("Certificate pinning failed: peer key is not pinned")
+			}
+			return nil
+		}
+	}
+
+	return config, nil
+}
+
+// TCPTransport sends requests to a target listening on a TCP address
+//
+// The target reads one JSON request line and answers with JSON lines,
+// then closes the connection. Set TLS to encrypt the connection.
+//
+// Fields:
+//
+//	Address: host:port of the target
+//	TLS: TLS configuration (nil for plain TCP), see NewTLSConfig()
+//	DialTimeout: Maximum time to establish the connection (0 = no limit)
+//	MaxReceive: Maximum size of a received line in bytes (0 = no limit)
+type TCPTransport struct {
+	Address     string
+	TLS         *tls.Config
+	DialTimeout time.Duration
+	MaxReceive  int64
+	conn        net.Conn
+	reader      *bufio.Reader
+}
+
+// NewTCPTransport creates a new TCPTransport instance
+//
+// Parameters:
+//
+//	address: host:port of the target
+//	tlsConfig: TLS configuration, or nil for plain TCP
+func NewTCPTransport(address string, tlsConfig *tls.Config) *TCPTransport {
+	return &TCPTransport{Address: address, TLS: tlsConfig}
+}
+
+// Open connects to the target
+func (t *TCPTransport) Open(target Target) error {
+	dialer := &net.Dialer{Timeout: t.DialTimeout}
+	var conn net.Conn
+	var err error
+	if t.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", t.Address, t.TLS)
+	} else {
+		conn, err = dialer.Dial("tcp", t.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to connect: %s", err.Error())
+	}
+	t.conn = conn
+	t.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// Send writes a message followed by a newline
+func (t *TCPTransport) Send(message []byte) error {
+	_, err := t.conn.Write(append(append([]byte{}, message...), '\n'))
+	return err
+}
+
+// CloseSend half-closes the connection so the target sees the end of the request
+func (t *TCPTransport) CloseSend() error {
+	if cw, ok := t.conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// Receive reads the next line sent by the target
+//
+// Returns:
+//
+//	[]byte: Line without its end
+//	error: io.EOF once the target closed the connection, *SizeLimitError for a line larger than MaxReceive
+func (t *TCPTransport) Receive() ([]byte, error) {
+	line, err := readLimitedLine(t.reader, t.MaxReceive)
+	if len(line) > 0 {
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+	return nil, err
+}
+
+// Close closes the connection
+func (t *TCPTransport) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.Close()
+}
+
+// HTTPTransport sends requests to a target behind an HTTP(S) endpoint
+//
+// The request is POSTed as the body, the response body holds JSON lines.
+//
+// Fields:
+//
+//	URL: Endpoint of the target (http:// or https://)
+//	TLS: TLS configuration for https endpoints, see NewTLSConfig()
+//	Client: Custom client (overrides TLS when set)
+//	MaxReceive: Maximum size of a received line in bytes (0 = no limit)
+type HTTPTransport struct {
+	URL        string
+	TLS        *tls.Config
+	Client     *http.Client
+	MaxReceive int64
+	body       io.ReadCloser
+	reader     *bufio.Reader
+}
+
+// NewHTTPTransport creates a new HTTPTransport instance
+//
+// Parameters:
+//
+//	url: Endpoint of the target
+//	tlsConfig: TLS configuration, or nil for the default settings
+func NewHTTPTransport(url string, tlsConfig *tls.Config) *HTTPTransport {
+	return &HTTPTransport{URL: url, TLS: tlsConfig}
+}
+
+// Open prepares the HTTP client
+func (t *HTTPTransport) Open(target Target) error {
+	if t.Client == nil {
+		t.Client = &http.Client{Transport: &http.Transport{TLSClientConfig: t.TLS}}
+	}
+	return nil
+}
+
+// Send POSTs the message to the endpoint
+func (t *HTTPTransport) Send(message []byte) error {
+	resp, err := t.Client.Post(t.URL, "application/json", bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return fmt.Errorf("HTTP status %s", resp.Status)
+	}
+	t.body = resp.Body
+	t.reader = bufio.NewReader(resp.Body)
+	return nil
+}
+
+// Receive reads the next line of the response body
+//
+// Returns:
+//
+//	[]byte: Line without its end
+//	error: io.EOF at the end of the body, *SizeLimitError for a line larger than MaxReceive
+func (t *HTTPTransport) Receive() ([]byte, error) {
+	if t.reader == nil {
+		return nil, io.EOF
+	}
+	line, err := readLimitedLine(t.reader, t.MaxReceive)
+	if len(line) > 0 {
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+	return nil, err
+}
+
+// Close closes the response body
+func (t *HTTPTransport) Close() error {
+	if t.body == nil {
+		return nil
+	}
+	return t.body.Close()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WithNodeVersion runs JavaScript targets with a given Node version
+//
+// The version is looked up in the installations of nvm, fnm and volta
+// (NVM_DIR, FNM_DIR and VOLTA_HOME are honored), the highest installed
+// version matching it runs the target with its directory first in PATH.
+// WithInterpreter() takes precedence over it.
+//
+// Parameters:
+//
+//	version: Version or version prefix (e.g. "20", "v18.19"), or path to a node binary
+func WithNodeVersion(version string) Option {
+	return func(im *InputManager) {
+		im.nodeVersion = version
+	}
+}
+
+// WithPackageRunner runs JavaScript targets through a package manager
+//
+// The target runs with "npm exec", "pnpm exec" or "yarn node" from the
+// package holding it (the closest directory with a package.json), so the
+// dependencies and binaries of its node_modules are found whatever the
+// current directory is.
+//
+// Parameters:
+//
+//	manager: "npm", "pnpm" or "yarn"
+func WithPackageRunner(manager string) Option {
+	return func(im *InputManager) {
+		im.nodeRunner = strings.ToLower(manager)
+	}
+}
+
+// Directories holding the node versions installed by each version manager
+func nodeInstallDirs() map[string]string {
+	home, _ := os.UserHomeDir()
+	env := func(name, fallback string) string {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+		return fallback
+	}
+	dirs := map[string]string{
+		"nvm":   filepath.Join(env("NVM_DIR", filepath.Join(home, ".nvm")), "versions", "node"),
+		"fnm":   filepath.Join(env("FNM_DIR", filepath.Join(home, ".local", "share", "fnm")), "node-versions"),
+		"volta": filepath.Join(env("VOLTA_HOME", filepath.Join(home, ".volta")), "tools", "image", "node"),
+	}
+	if runtime.GOOS == "windows" {
+		// nvm-windows keeps the versions right in its home
+		dirs["nvm"] = env("NVM_HOME", filepath.Join(home, "AppData", "Roaming", "nvm"))
+	}
+	return dirs
+}
+
+// Get the node binary of a version directory installed by a version manager
+func nodeBinary(manager, dir string) string {
+	if manager == "fnm" {
+		dir = filepath.Join(dir, "installation")
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, "node.exe")
+	}
+	return filepath.Join(dir, "bin", "node")
+}
+
+// Parse a version like "v18.19.0" into its numbers
+func parseNodeVersion(version string) []int {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	numbers := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+// Find the node binary of the highest installed version matching version
+func findNodeVersion(language, version string) (string, error) {
+	if strings.ContainsAny(version, `/\`) {
+		if _, err := os.Stat(version); err != nil {
+			return "", &RuntimeNotFoundError{Language: language, Candidates: []string{version}}
+		}
+		return filepath.Abs(version)
+	}
+	wanted := parseNodeVersion(version)
+	if wanted == nil {
+		return "", fmt.Errorf("Invalid Node version: %s", version)
+	}
+
+	var best []int
+	binary := ""
+	tried := []string{}
+	dirs := nodeInstallDirs()
+	managers := make([]string, 0, len(dirs))
+	for manager := range dirs {
+		managers = append(managers, manager)
+	}
+	sort.Strings(managers)
+	for _, manager := range managers {
+		tried = append(tried, fmt.Sprintf("%s node %s", manager, version))
+		entries, _ := os.ReadDir(dirs[manager])
+		for _, entry := range entries {
+			installed := parseNodeVersion(entry.Name())
+			if installed == nil || len(installed) < len(wanted) || !entry.IsDir() {
+				continue
+			}
+			matches := true
+			for i := range wanted {
+				matches = matches && installed[i] == wanted[i]
+			}
+			candidate := nodeBinary(manager, filepath.Join(dirs[manager], entry.Name()))
+			if _, err := os.Stat(candidate); err != nil || !matches || !newerVersion(installed, best) {
+				continue
+			}
+			best, binary = installed, candidate
+		}
+	}
+	if binary == "" {
+		return "", &RuntimeNotFoundError{Language: language, Candidates: tried}
+	}
+	return binary, nil
+}
+
+// Tell whether version a is higher than version b
+func newerVersion(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return len(a) > len(b)
+}
+
+// Get the closest directory holding a package.json, dir of file when none
+func packageDir(file string) string {
+	start := filepath.Dir(file)
+	for dir := start; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+			return dir
+		}
+		if filepath.Dir(dir) == dir {
+			return start
+		}
+	}
+}
+
+// Wrap a node command into the package runner of the InputManager
+func (im *InputManager) packageRunnerCommand(language string, cmd []string) ([]string, error) {
+	if im.nodeRunner != "npm" && im.nodeRunner != "pnpm" && im.nodeRunner != "yarn" {
+		return nil, fmt.Errorf("Unsupported package runner: %s", im.nodeRunner)
+	}
+	file, err := filepath.Abs(cmd[len(cmd)-1])
+	if err != nil {
+		return nil, err
+	}
+	cmd = append(append([]string{}, cmd[:len(cmd)-1]...), file)
+	dir := packageDir(file)
+
+	runner := im.nodeRunner
+	// The package manager of the chosen Node version comes first
+	if im.nodeVersion != "" && filepath.IsAbs(cmd[0]) {
+		local := filepath.Join(filepath.Dir(cmd[0]), runner)
+		if _, err := os.Stat(local); err == nil {
+			runner = local
+		}
+	}
+	if runner == im.nodeRunner && im.hostCommand() {
+		if runner, err = lookupInterpreter(language, runner); err != nil {
+			return nil, err
+		}
+	}
+
+	switch im.nodeRunner {
+	case "npm":
+		return append([]string{runner, "--prefix", dir, "exec", "--"}, cmd...), nil
+	case "pnpm":
+		return append([]string{runner, "--dir", dir, "exec"}, cmd...), nil
+	}
+	// yarn node runs the node found first in PATH (see WithNodeVersion())
+	return append([]string{runner, "--cwd", dir, "node"}, cmd[1:]...), nil
+}
+
+// Get the PATH entry of the chosen Node version, nil without one
+func (im *InputManager) nodeEnvPath() []string {
+	if im.nodeVersion == "" {
+		return nil
+	}
+	binary, err := findNodeVersion("JAVASCRIPT", im.nodeVersion)
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Dir(binary)}
+}
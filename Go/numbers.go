@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decode JSON keeping numbers as json.Number
+//
+// encoding/json decodes numbers to float64 by default, which silently
+// rounds integers above 2^53 (database IDs, nanosecond timestamps, ...).
+// Protocol messages are decoded with this instead so numbers are written
+// back exactly as they were received.
+func unmarshalNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// Get a decoded number as float64 (float64 or json.Number)
+func numberValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Convert a json.Number to the closest Go type
+//
+// Integers become int when they fit (int64 on 32-bit platforms, uint64
+// above math.MaxInt64), decimals become float64. Integers too large for
+// any of them stay json.Number so no digit is lost.
+func convertNumber(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		if i >= math.MinInt && i <= math.MaxInt {
+			return int(i)
+		}
+		return i
+	}
+	if u, ok := parseUint64(string(n)); ok {
+		return u
+	}
+	if isIntegerLiteral(string(n)) {
+		return n
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n
+}
+
+// Parse a plain decimal integer literal into a uint64
+func parseUint64(s string) (uint64, bool) {
+	if !isIntegerLiteral(s) || s[0] == '-' {
+		return 0, false
+	}
+	var u uint64
+	for _, c := range s {
+		d := uint64(c - '0')
+		if u > (math.MaxUint64-d)/10 {
+			return 0, false
+		}
+		u = u*10 + d
+	}
+	return u, true
+}
+
+func isIntegerLiteral(s string) bool {
+	if len(s) > 0 && s[0] == '-' {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Largest base-10 exponent checked by exactFloat(), float64 can't hold more
+const maxExactExponent = 400
+
+// Get a json.Number as float64, telling whether no digit is lost
+//
+// A decimal is exact when the shortest form of its float64 has the same
+// value: 0.1 and 1e21 are, 3.14159265358979323846 and 2^64 aren't.
+func exactFloat(n json.Number) (float64, bool) {
+	f, err := n.Float64()
+	if err != nil {
+		return 0, false
+	}
+	mantissa, exponent, ok := decimalParts(string(n))
+	if !ok || exponent > maxExactExponent || exponent < -maxExactExponent {
+		return f, false
+	}
+	shortest, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	return f, decimalRat(mantissa, exponent).Cmp(shortest) == 0
+}
+
+// Split a JSON number literal into mantissa and exponent (mantissa * 10^exponent)
+func decimalParts(s string) (*big.Int, int, bool) {
+	mantissa, exponent := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return nil, 0, false
+		}
+		mantissa, exponent = s[:i], e
+	}
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		exponent -= len(mantissa) - i - 1
+		mantissa = mantissa[:i] + mantissa[i+1:]
+	}
+	if !isIntegerLiteral(strings.TrimPrefix(mantissa, "+")) {
+		return nil, 0, false
+	}
+	m, ok := new(big.Int).SetString(mantissa, 10)
+	return m, exponent, ok
+}
+
+// Get mantissa * 10^exponent as an exact fraction
+func decimalRat(mantissa *big.Int, exponent int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exponent))), nil)
+	if exponent < 0 {
+		return new(big.Rat).SetFrac(mantissa, scale)
+	}
+	return new(big.Rat).SetInt(new(big.Int).Mul(mantissa, scale))
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
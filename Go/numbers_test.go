@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestConvertNumber(t *testing.T) {
+	cases := []struct {
+		text string
+		want interface{}
+	}{
+		{"42", 42},
+		{"-7", -7},
+		{"9007199254740993", 9007199254740993},
+		{"18446744073709551615", uint64(math.MaxUint64)},
+		{"123456789012345678901234567890", json.Number("123456789012345678901234567890")},
+		{"1.5", 1.5},
+	}
+	for _, c := range cases {
+		if got := convertNumber(json.Number(c.text)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expected %#v, got %#v", c.text, c.want, got)
+		}
+	}
+}
+
+func TestUnmarshalNumbersExact(t *testing.T) {
+	message := `{"id":9007199254740993,"big":123456789012345678901234567890,"ts":1700000000123456789}`
+	var decoded map[string]interface{}
+	if err := unmarshalNumbers([]byte(message), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if encoded, _ := json.Marshal(decoded); string(encoded) != `{"big":123456789012345678901234567890,"id":9007199254740993,"ts":1700000000123456789}` {
+		t.Errorf("numbers changed: %s", encoded)
+	}
+	if err := unmarshalNumbers([]byte(`{} {}`), &decoded); err == nil {
+		t.Error("trailing data decoded without error")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// Policy restricts what Request() may run
+//
+// Services running files picked from user input set one so only the
+// expected targets can ever be started. The checks are made before the
+// command is run, a target breaking them fails with *PolicyError.
+//
+// Fields:
+//
+//	Languages: Allowed languages, aliases included (nil allows any)
+//	Directories: Target files must be inside one of them, symlinks resolved (nil allows any)
+//	Interpreters: Allowed interpreters and runners, names looked up in PATH or paths (nil allows any)
+//	Capabilities: Largest capabilities a target may declare, it is stopped otherwise (nil allows any, see DeclareCapabilities())
+type Policy struct {
+	Languages    []string
+	Directories  []string
+	Interpreters []string
+	Capabilities *Capabilities
+}
+
+// PolicyError reports a target refused by the Policy
+//
+// Fields:
+//
+//	Reason: What the target broke
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("Blocked by policy: %s", e.Reason)
+}
+
+// Policy applied to InputManagers without their own
+var (
+	policyMu      sync.RWMutex
+	defaultPolicy *Policy
+)
+
+// SetPolicy sets the Policy of every InputManager
+//
+// Parameters:
+//
+//	policy: Policy to enforce, nil removes it
+func SetPolicy(policy *Policy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	defaultPolicy = policy
+}
+
+// WithPolicy sets the Policy of an InputManager, replacing the one of SetPolicy()
+//
+// Parameters:
+//
+//	policy: Policy to enforce
+func WithPolicy(policy *Policy) Option {
+	return func(im *InputManager) {
+		im.policy = policy
+	}
+}
+
+// Get the Policy enforced for the InputManager, nil when none
+func (im *InputManager) activePolicy() *Policy {
+	if im.policy != nil {
+		return im.policy
+	}
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return defaultPolicy
+}
+
+// Check the language and file of a target
+func (p *Policy) checkTarget(language, file string) error {
+	if p.Languages != nil {
+		spec, _ := lookupLanguage(language)
+		allowed := false
+		for _, name := range p.Languages {
+			if other, ok := lookupLanguage(name); ok && spec != nil && other.name == spec.name {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &PolicyError{Reason: fmt.Sprintf("language %s is not allowed", language)}
+		}
+	}
+
+	if p.Directories != nil {
+		path, err := resolvedPath(file)
+		if err != nil {
+			return &PolicyError{Reason: fmt.Sprintf("can't resolve %s", file)}
+		}
+		allowed := false
+		for _, dir := range p.Directories {
+			root, err := resolvedPath(dir)
+			if err != nil {
+				continue
+			}
+			if insideDir(root, path) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &PolicyError{Reason: fmt.Sprintf("%s is outside the allowed directories", file)}
+		}
+	}
+	return nil
+}
+
+// Check the program a command starts, the target itself is always allowed
+func (p *Policy) checkCommand(cmd []string, file string) error {
+	if p.Interpreters == nil || len(cmd) == 0 {
+		return nil
+	}
+	program, err := exec.LookPath(cmd[0])
+	if err != nil {
+		return &PolicyError{Reason: fmt.Sprintf("interpreter %s not found", cmd[0])}
+	}
+	program, _ = filepath.Abs(program)
+	if target, _ := filepath.Abs(file); program == target {
+		return nil
+	}
+	for _, interpreter := range p.Interpreters {
+		if allowed, err := exec.LookPath(interpreter); err == nil {
+			if allowed, _ = filepath.Abs(allowed); allowed == program {
+				return nil
+			}
+		}
+	}
+	return &PolicyError{Reason: fmt.Sprintf("interpreter %s is not allowed", cmd[0])}
+}
+
+// Check the program of a command run off this host, by name since it
+// can't be looked up in PATH
+func (p *Policy) checkCommandName(cmd []string, file string) error {
+	if p.Interpreters == nil || len(cmd) == 0 || filepath.Clean(cmd[0]) == filepath.Clean(file) {
+		return nil
+	}
+	for _, interpreter := range p.Interpreters {
+		if interpreter == cmd[0] || filepath.Base(interpreter) == cmd[0] {
+			return nil
+		}
+	}
+	return &PolicyError{Reason: fmt.Sprintf("interpreter %s is not allowed", cmd[0])}
+}
+
+// Check a binary compiled from the target (see WithCompile()) is the
+// regular file of the compile cache, not a link leading elsewhere
+func (p *Policy) checkBinary(binary, cacheDir string) error {
+	info, err := os.Lstat(binary)
+	if err != nil || !info.Mode().IsRegular() {
+		return &PolicyError{Reason: fmt.Sprintf("compiled binary %s is not a regular file", binary)}
+	}
+	root, err := resolvedPath(cacheDir)
+	if err != nil {
+		return &PolicyError{Reason: fmt.Sprintf("can't resolve %s", cacheDir)}
+	}
+	path, err := resolvedPath(binary)
+	if err != nil || !insideDir(root, path) {
+		return &PolicyError{Reason: fmt.Sprintf("compiled binary %s is outside the compile cache", binary)}
+	}
+	return p.checkCommand([]string{path}, path)
+}
+
+// Get the absolute path of a file with its symlinks resolved
+func resolvedPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	allowed, other := t.TempDir(), t.TempDir()
+	for _, dir := range []string{allowed, other} {
+		if err := os.WriteFile(filepath.Join(dir, "target.sh"), []byte("echo\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target := filepath.Join(allowed, "target.sh")
+
+	cases := []struct {
+		name    string
+		policy  Policy
+		file    string
+		blocked bool
+	}{
+		{"allowed", Policy{Languages: []string{"sh"}, Directories: []string{allowed}, Interpreters: []string{"sh"}}, target, false},
+		{"language", Policy{Languages: []string{"python"}}, target, true},
+		{"directory", Policy{Directories: []string{allowed}}, filepath.Join(other, "target.sh"), true},
+		{"escape", Policy{Directories: []string{allowed}}, filepath.Join(allowed, "..", filepath.Base(other), "target.sh"), true},
+		{"interpreter", Policy{Interpreters: []string{"mangle-missing-runtime"}}, target, true},
+	}
+	for _, c := range cases {
+		policy := c.policy
+		im := NewInputManager(WithInterpreter("sh", "sh"), WithPolicy(&policy))
+		_, err := im.getCommand("sh", c.file)
+		var policyErr *PolicyError
+		if blocked := errors.As(err, &policyErr); blocked != c.blocked || (!blocked && err != nil) {
+			t.Errorf("%s: expected blocked=%v, got %v", c.name, c.blocked, err)
+		}
+	}
+}
+
+func TestCompileChecksPolicy(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "target.c")
+	if err := os.WriteFile(source, []byte("int main(void) { return 0; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(dir, "cache")
+
+	// The compiler isn't an allowed interpreter
+	im := NewInputManager(WithCompile(cache), WithPolicy(&Policy{Interpreters: []string{"sh"}}))
+	_, err := im.getCommand("c", source)
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected a PolicyError, got %v", err)
+	}
+	if entries, _ := os.ReadDir(cache); len(entries) > 0 {
+		t.Errorf("the source was compiled: %v", entries)
+	}
+
+	// Cached binaries are checked too
+	im = NewInputManager(WithCompile(cache), WithPolicy(&Policy{Interpreters: []string{"cc"}}))
+	cmd, err := im.getCommand("c", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(cmd[0])
+	if err := os.Symlink(source, cmd[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := im.getCommand("c", source); !errors.As(err, &policyErr) {
+		t.Errorf("expected a PolicyError for a linked binary, got %v", err)
+	}
+}
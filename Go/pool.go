@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Buffers the messages are written from, reused so busy targets and
+// calling processes don't allocate one per message
+var messageBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// Largest buffer put back in the pool, bigger ones would stay pinned
+const maxPooledBuffer = 1 << 20
+
+// Get an empty buffer, give it back with putBuffer()
+func getBuffer() *bytes.Buffer {
+	return messageBuffers.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	messageBuffers.Put(buf)
+}
+
+// Write a message and its line end in a single write
+//
+// Pipes and sockets then get one write per message, which also keeps
+// concurrent writers from splitting a line.
+func writeLine(w io.Writer, message []byte) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.Grow(len(message) + 1)
+	buf.Write(message)
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
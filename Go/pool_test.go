@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Writer counting its writes, as a pipe would see them
+type countingWriter struct {
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return len(p), nil
+}
+
+func TestWriteLineSingleWrite(t *testing.T) {
+	w := &countingWriter{}
+	var buf bytes.Buffer
+	writeLine(io.MultiWriter(w, &buf), []byte(`{"key":"k"}`))
+	if w.writes != 1 || buf.String() != "{\"key\":\"k\"}\n" {
+		t.Errorf("expected one write of the line, got %d writes of %q", w.writes, buf.String())
+	}
+}
+
+func TestOutputPassesJSONThrough(t *testing.T) {
+	var out bytes.Buffer
+	om, err := NewOutputManager(strings.NewReader(`{"key":"k","isUnique":true,"optionalOutput":false,"data":null}`+"\n"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	om.Output(`{"b":1,"a":1.50,"id":123456789012345678901234567890}`)
+	if !strings.Contains(out.String(), `"data":{"b":1,"a":1.50,"id":123456789012345678901234567890}`) {
+		t.Errorf("the output data changed: %s", out.String())
+	}
+}
+
+// Request of the benchmarks and its 2 KB output
+var (
+	benchRequest = `{"key":"bench","isUnique":true,"optionalOutput":false,"data":{"name":"bench","values":[1,2,3]}}` + "\n"
+	benchOutput  = func() string {
+		values := make([]string, 256)
+		for i := range values {
+			values[i] = fmt.Sprintf(`"v%04d"`, i)
+		}
+		return "[" + strings.Join(values, ",") + "]"
+	}()
+)
+
+// Writer counting its writes and closable, as the stdin pipe of a process
+type countingPipe struct {
+	countingWriter
+}
+
+func (p *countingPipe) Close() error {
+	return nil
+}
+
+// Transport answering each request with the 2 KB output, without a process
+type benchTransport struct {
+	queue [][]byte
+}
+
+func (t *benchTransport) Open(target Target) error {
+	t.queue = nil
+	return nil
+}
+
+func (t *benchTransport) Send(message []byte) error {
+	var request struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(message, &request); err != nil {
+		return err
+	}
+	t.queue = [][]byte{outputLine(request.Key, benchOutput)}
+	return nil
+}
+
+func (t *benchTransport) Receive() ([]byte, error) {
+	if len(t.queue) == 0 {
+		return nil, io.EOF
+	}
+	line := t.queue[0]
+	t.queue = t.queue[1:]
+	return line, nil
+}
+
+func (t *benchTransport) Close() error {
+	return nil
+}
+
+// Calling side of a request: exchange() sending it and collecting the output
+func BenchmarkRequest(b *testing.B) {
+	im := NewInputManager(WithTransport(&benchTransport{}))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		im.Request(true, false, `{"name":"bench","values":[1,2,3]}`, "", "")
+		if !im.Response.RequestStatus {
+			b.Fatal(im.Response.Errors)
+		}
+	}
+}
+
+// Child answering a request: read it and output 2 KB
+func BenchmarkChildRequest(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		om, err := NewOutputManager(strings.NewReader(benchRequest), io.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+		om.Output(benchOutput)
+	}
+}
+
+// Reading a request line in the child
+func BenchmarkReadMessage(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := readMessage(bufio.NewReader(strings.NewReader(benchRequest)), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Writing a message line from the child, writes/op counts the writes the pipe sees
+func BenchmarkWriteMessage(b *testing.B) {
+	message, _ := json.Marshal(map[string]interface{}{"key": "bench", "data": json.RawMessage(benchOutput)})
+	w := &countingWriter{}
+	om, err := NewOutputManager(strings.NewReader(benchRequest), w)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		om.writeMessage(message)
+	}
+	b.ReportMetric(float64(w.writes)/float64(b.N), "writes/op")
+}
+
+// Writing a request line to the process stdin, writes/op counts the writes the pipe sees
+func BenchmarkProcessTransportSend(b *testing.B) {
+	message := []byte(strings.TrimSpace(benchRequest))
+	pipe := &countingPipe{}
+	t := &ProcessTransport{stdin: pipe}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := t.Send(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(pipe.writes)/float64(b.N), "writes/op")
+}
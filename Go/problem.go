@@ -0,0 +1,140 @@
+package main
+
+import "errors"
+
+// Codes of the problems reported by the Go OutputManager
+//
+// Targets may use their own codes, e.g. CodeMissingDependency when a
+// library they need isn't installed.
+const (
+	// CodeError is the code of errors reported without one (see OutputError())
+	CodeError = "ERROR"
+	// CodeWarning is the code of warnings reported without one (see Warn())
+	CodeWarning = "WARNING"
+	// CodeInvalidRequest reports a request the target couldn't read
+	CodeInvalidRequest = "INVALID_REQUEST"
+	// CodeInvalidData reports request data breaking its schema (see ValidateData())
+	CodeInvalidData = "INVALID_DATA"
+	// CodeUnknownMethod reports a method without handler (see Dispatch())
+	CodeUnknownMethod = "UNKNOWN_METHOD"
+	// CodeNotInitialized reports an output without request
+	CodeNotInitialized = "NOT_INITIALIZED"
+	// CodeOutOfBound reports an output after the single one allowed (isUnique)
+	CodeOutOfBound = "OUT_OF_BOUND"
+	// CodeNoOutput reports a target that ended without its required output
+	CodeNoOutput = "NO_OUTPUT"
+	// CodePanic reports a panic of the target (see RecoverAndReport())
+	CodePanic = "PANIC"
+	// CodeMissingDependency reports a library or tool the target needs but can't find
+	CodeMissingDependency = "MISSING_DEPENDENCY"
+)
+
+// Problem is an error or warning a program can react to
+//
+// Calling processes announce they read problems with "accept_problems",
+// the target then sends them as objects in "errors" and "warnings".
+// Others get the text of each problem (see Response.Errors).
+//
+// Fields:
+//
+//	Code: Stable identifier of the problem (e.g. CodeMissingDependency)
+//	Message: What went wrong, for humans
+//	Detail: More context (stack, hint, ...), optional
+type Problem struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	return p.Message
+}
+
+// Get the problem carried by err, CodeError when it carries none
+func problemOf(err error) Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return *problem
+	}
+	return Problem{Code: CodeError, Message: err.Error()}
+}
+
+// Text of problems for callers reading strings, the detail on its own line
+func problemText(problems []Problem, prefix string) []string {
+	text := []string{}
+	for _, problem := range problems {
+		text = append(text, prefix+problem.Message)
+		if problem.Detail != "" {
+			text = append(text, problem.Detail)
+		}
+	}
+	return text
+}
+
+// Problems of an envelope, as objects when the calling process reads them
+func (om *OutputManager) problemList(problems []Problem, prefix string) interface{} {
+	if om.acceptProblems {
+		return append([]Problem{}, problems...)
+	}
+	return problemText(problems, prefix)
+}
+
+// Read a problem of an envelope
+func parseProblem(value interface{}) (Problem, bool) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return Problem{}, false
+	}
+	problem := Problem{}
+	problem.Code, _ = fields["code"].(string)
+	problem.Message, _ = fields["message"].(string)
+	problem.Detail, _ = fields["detail"].(string)
+	return problem, true
+}
+
+// Add the errors or warnings of an envelope to a response
+func addProblems(values interface{}, prefix string, text *[]string, details *[]Problem) {
+	list, _ := values.([]interface{})
+	for _, value := range list {
+		if str, ok := value.(string); ok {
+			*text = append(*text, str)
+		} else if problem, ok := parseProblem(value); ok {
+			*text = append(*text, problemText([]Problem{problem}, prefix)...)
+			*details = append(*details, problem)
+		}
+	}
+}
+
+// WarnProblem reports a warning with a code without failing the request
+//
+// Parameters:
+//
+//	problem: Warning reported to the calling process (in Response.WarningDetails)
+func (om *OutputManager) WarnProblem(problem Problem) {
+	if om == nil {
+		return
+	}
+	if om.versioned {
+		warnings := []interface{}{problem}
+		if !om.acceptProblems {
+			warnings = nil
+			for _, text := range problemText([]Problem{problem}, "Warning: ") {
+				warnings = append(warnings, text)
+			}
+		}
+		for _, warning := range warnings {
+			om.emitMessage(map[string]interface{}{
+				"key":     om.key,
+				"channel": ChannelWarning,
+				"warning": warning,
+			})
+		}
+		return
+	}
+	om.warnings = append(om.warnings, problem)
+}
+
+// WarnProblem calls WarnProblem() on the OutputManager created by Init()
+func WarnProblem(problem Problem) {
+	autoOutputManager().WarnProblem(problem)
+}
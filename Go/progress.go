@@ -0,0 +1,44 @@
+package main
+
+// WithProgress calls onProgress for each progress report of the target
+//
+// Reports are sent by the target with OutputProgress() while it works,
+// they are not outputs.
+//
+// Parameters:
+//
+//	onProgress: Function called with the percentage (0-100) and message of each report
+func WithProgress(onProgress func(percent float64, message string)) Option {
+	return WithChannelHandler(ChannelProgress, func(report map[string]interface{}) {
+		percent, _ := numberValue(report["percent"])
+		message, _ := report["message"].(string)
+		onProgress(percent, message)
+	})
+}
+
+// OutputProgress reports the progress of a long-running task
+//
+// The report isn't an output: it can be sent any number of times, even
+// with isUnique=true. It is dropped when the calling process speaks the
+// original protocol (it would be taken for an output).
+//
+// Parameters:
+//
+//	percent: Completion percentage (0-100)
+//	message: Short description of the current step
+func (om *OutputManager) OutputProgress(percent float64, message string) {
+	if om == nil || !om.versioned {
+		return
+	}
+	om.emitMessage(map[string]interface{}{
+		"key":     om.key,
+		"channel": ChannelProgress,
+		"percent": percent,
+		"message": message,
+	})
+}
+
+// OutputProgress calls OutputProgress() on the OutputManager created by Init()
+func OutputProgress(percent float64, message string) {
+	autoOutputManager().OutputProgress(percent, message)
+}
@@ -0,0 +1,625 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// CodecProtobuf marks data holding a pre-marshaled protobuf message
+//
+// The message bytes are sent as-is (base64 in the envelope) together with
+// a "data_type" field naming the message type, so both sides can use their
+// existing generated proto code to (un)marshal them. Without generated
+// code, a ProtoDescriptor (un)marshals JSON data instead, see
+// RequestProtoData().
+const CodecProtobuf = "protobuf"
+
+func init() {
+	RegisterCodec(bytesCodec{name: CodecProtobuf})
+}
+
+// Codec passing raw bytes through unchanged
+type bytesCodec struct {
+	name string
+}
+
+func (c bytesCodec) Name() string {
+	return c.name
+}
+
+func (c bytesCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+	return nil, errors.New(c.name + " data must be raw bytes")
+}
+
+func (c bytesCodec) Unmarshal(data []byte) (interface{}, error) {
+	return append([]byte{}, data...), nil
+}
+
+// RequestProto sends a request whose data is a protobuf message
+//
+// Parameters:
+//
+//	isUnique: Expect single output (true) or multiple (false)
+//	optionalOutput: Output is optional (true) or required (false)
+//	message: Marshaled message (e.g. from proto.Marshal)
+//	messageType: Full message name (e.g. "shop.v1.Order")
+//	language: Target language/runtime
+//	file: Path to target file
+func (im *InputManager) RequestProto(isUnique, optionalOutput bool, message []byte, messageType, language, file string) {
+	im.exchange(isUnique, optionalOutput, map[string]interface{}{
+		"data":      base64.StdEncoding.EncodeToString(message),
+		"encoding":  CodecProtobuf,
+		"data_type": messageType,
+	}, language, file)
+}
+
+// GetProto returns the protobuf message sent by the target
+//
+// Returns:
+//
+//	[]byte: Marshaled message, nil if the request failed or the data isn't bytes
+//	string: Message type announced by the target (Response.DataType)
+func (im *InputManager) GetProto() ([]byte, string) {
+	var message []byte
+	if json.Unmarshal([]byte(im.GetData()), &message) != nil {
+		return nil, ""
+	}
+	return message, im.Response.DataType
+}
+
+// GetProto returns the request data sent with InputManager.RequestProto()
+//
+// Returns:
+//
+//	[]byte: Marshaled message, nil if the data isn't bytes
+//	string: Message type of the request
+func (om *OutputManager) GetProto() ([]byte, string) {
+	if om == nil {
+		return nil, ""
+	}
+	var message []byte
+	if json.Unmarshal([]byte(om.data), &message) != nil {
+		return nil, ""
+	}
+	return message, om.dataType
+}
+
+// OutputProto sends a protobuf message back to the calling process
+//
+// Parameters:
+//
+//	message: Marshaled message (e.g. from proto.Marshal)
+//	messageType: Full message name
+func (om *OutputManager) OutputProto(message []byte, messageType string) {
+	om.writeOutput(message, CodecProtobuf, map[string]interface{}{"data_type": messageType})
+}
+
+// GetProto calls GetProto() on the OutputManager created by Init()
+func GetProto() ([]byte, string) {
+	return autoOutputManager().GetProto()
+}
+
+// OutputProto calls OutputProto() on the OutputManager created by Init()
+func OutputProto(message []byte, messageType string) {
+	autoOutputManager().OutputProto(message, messageType)
+}
+
+// ProtoDescriptor describes a protobuf message type, so JSON data can be
+// sent as that message without generated code
+//
+// The descriptor mirrors the .proto file compiled by the other side, only
+// the fields it lists are encoded or decoded (unknown fields are skipped,
+// missing ones are left out). Enums are "int32" fields, and map fields
+// are repeated messages with a "key" (1) and a "value" (2) field, as they
+// are on the wire.
+//
+// Fields:
+//
+//	Name: Full message name (e.g. "shop.v1.Order")
+//	Fields: Fields of the message
+type ProtoDescriptor struct {
+	Name   string
+	Fields []ProtoField
+}
+
+// ProtoField describes a field of a ProtoDescriptor
+//
+// Fields:
+//
+//	Number: Field number in the .proto file
+//	Name: Key of the field in the JSON data
+//	Type: "double", "float", "int32", "int64", "uint32", "uint64", "sint32", "sint64", "fixed32", "fixed64", "sfixed32", "sfixed64", "bool", "string", "bytes" or "message"
+//	Repeated: The field holds a list (numbers are packed, as in proto3)
+//	Message: Descriptor of the field when Type is "message"
+type ProtoField struct {
+	Number   int
+	Name     string
+	Type     string
+	Repeated bool
+	Message  *ProtoDescriptor
+}
+
+// Wire types of protobuf fields
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// Wire type of each field type, "message" excepted
+var protoWireTypes = map[string]int{
+	"int32": protoVarint, "int64": protoVarint, "uint32": protoVarint, "uint64": protoVarint,
+	"sint32": protoVarint, "sint64": protoVarint, "bool": protoVarint,
+	"fixed64": protoFixed64, "sfixed64": protoFixed64, "double": protoFixed64,
+	"fixed32": protoFixed32, "sfixed32": protoFixed32, "float": protoFixed32,
+	"string": protoBytes, "bytes": protoBytes,
+}
+
+// Marshal encodes JSON data as the message
+//
+// Parameters:
+//
+//	data: JSON object holding the fields of the message
+//
+// Returns:
+//
+//	[]byte: Marshaled message
+//	error: Data that doesn't match the descriptor
+func (d *ProtoDescriptor) Marshal(data string) ([]byte, error) {
+	var message map[string]interface{}
+	if err := unmarshalNumbers([]byte(data), &message); err != nil {
+		return nil, fmt.Errorf("%s: data isn't a JSON object", d.Name)
+	}
+	return d.appendMessage(nil, message)
+}
+
+// Unmarshal decodes the message to JSON data
+//
+// Parameters:
+//
+//	message: Marshaled message
+//
+// Returns:
+//
+//	string: JSON object holding the fields of the message (bytes in base64)
+//	error: Malformed message
+func (d *ProtoDescriptor) Unmarshal(message []byte) (string, error) {
+	fields, err := d.decodeMessage(message)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(fields)
+	return string(data), err
+}
+
+func (d *ProtoDescriptor) appendMessage(b []byte, message map[string]interface{}) ([]byte, error) {
+	for _, field := range d.Fields {
+		value, ok := message[field.Name]
+		if !ok || value == nil {
+			continue
+		}
+		if !field.Repeated {
+			var err error
+			if b, err = field.appendValue(b, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s.%s: expected a list", d.Name, field.Name)
+		}
+		if len(list) == 0 {
+			continue
+		}
+		// Numbers are packed in one length-delimited field
+		if wireType, ok := protoWireTypes[field.Type]; ok && wireType != protoBytes {
+			var packed []byte
+			for _, item := range list {
+				var err error
+				if packed, err = field.appendScalar(packed, item); err != nil {
+					return nil, err
+				}
+			}
+			b = protoAppendTag(b, field.Number, protoBytes)
+			b = binary.AppendUvarint(b, uint64(len(packed)))
+			b = append(b, packed...)
+			continue
+		}
+		for _, item := range list {
+			var err error
+			if b, err = field.appendValue(b, item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+// Append one value of the field with its tag
+func (f *ProtoField) appendValue(b []byte, value interface{}) ([]byte, error) {
+	if f.Type == "message" {
+		nested, ok := value.(map[string]interface{})
+		if !ok || f.Message == nil {
+			return nil, fmt.Errorf("%s: expected an object", f.Name)
+		}
+		encoded, err := f.Message.appendMessage(nil, nested)
+		if err != nil {
+			return nil, err
+		}
+		b = protoAppendTag(b, f.Number, protoBytes)
+		b = binary.AppendUvarint(b, uint64(len(encoded)))
+		return append(b, encoded...), nil
+	}
+	wireType, ok := protoWireTypes[f.Type]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown type %s", f.Name, f.Type)
+	}
+	return f.appendScalar(protoAppendTag(b, f.Number, wireType), value)
+}
+
+// Append a scalar value without its tag
+func (f *ProtoField) appendScalar(b []byte, value interface{}) ([]byte, error) {
+	invalid := &protoValueError{field: f, value: value}
+	switch f.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		return append(b, s...), nil
+	case "bytes":
+		s, ok := value.(string)
+		raw, err := base64.StdEncoding.DecodeString(s)
+		if !ok || err != nil {
+			return nil, invalid
+		}
+		b = binary.AppendUvarint(b, uint64(len(raw)))
+		return append(b, raw...), nil
+	case "bool":
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, invalid
+		}
+		if flag {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case "double", "float":
+		n, ok := protoFloat(value)
+		if !ok {
+			return nil, invalid
+		}
+		if f.Type == "float" {
+			return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(n))), nil
+		}
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(n)), nil
+	case "uint32", "uint64", "fixed32", "fixed64":
+		n, ok := protoUint(value)
+		if !ok || (f.Type == "uint32" || f.Type == "fixed32") && n > math.MaxUint32 {
+			return nil, invalid
+		}
+		switch f.Type {
+		case "fixed32":
+			return binary.LittleEndian.AppendUint32(b, uint32(n)), nil
+		case "fixed64":
+			return binary.LittleEndian.AppendUint64(b, n), nil
+		}
+		return binary.AppendUvarint(b, n), nil
+	}
+	n, ok := protoInt(value)
+	if !ok {
+		return nil, invalid
+	}
+	switch f.Type {
+	case "int32", "sint32", "sfixed32":
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, invalid
+		}
+	}
+	switch f.Type {
+	case "int32", "int64":
+		// Negative numbers take 10 bytes, as in every protobuf library
+		return binary.AppendUvarint(b, uint64(n)), nil
+	case "sint32", "sint64":
+		return binary.AppendUvarint(b, uint64(n<<1)^uint64(n>>63)), nil
+	case "sfixed32":
+		return binary.LittleEndian.AppendUint32(b, uint32(int32(n))), nil
+	case "sfixed64":
+		return binary.LittleEndian.AppendUint64(b, uint64(n)), nil
+	}
+	return nil, fmt.Errorf("%s: unknown type %s", f.Name, f.Type)
+}
+
+func (d *ProtoDescriptor) decodeMessage(message []byte) (map[string]interface{}, error) {
+	fields := map[int]*ProtoField{}
+	for i := range d.Fields {
+		fields[d.Fields[i].Number] = &d.Fields[i]
+	}
+	decoded := map[string]interface{}{}
+	truncated := fmt.Errorf("%s: truncated message", d.Name)
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return nil, truncated
+		}
+		message = message[n:]
+		number, wireType := int(tag>>3), int(tag&7)
+
+		// Length of the payload of the field
+		size := 0
+		switch wireType {
+		case protoVarint:
+			if _, n = binary.Uvarint(message); n <= 0 {
+				return nil, truncated
+			}
+			size = n
+		case protoFixed64:
+			size = 8
+		case protoFixed32:
+			size = 4
+		case protoBytes:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || length > uint64(len(message)-n) {
+				return nil, truncated
+			}
+			message, size = message[n:], int(length)
+		default:
+			return nil, fmt.Errorf("%s: unsupported wire type %d", d.Name, wireType)
+		}
+		if size > len(message) {
+			return nil, truncated
+		}
+		payload := message[:size]
+		message = message[size:]
+
+		field, ok := fields[number]
+		if !ok {
+			continue
+		}
+		values := []interface{}{}
+		expected, scalar := protoWireTypes[field.Type]
+		switch {
+		case field.Type == "message" && wireType == protoBytes && field.Message != nil:
+			nested, err := field.Message.decodeMessage(payload)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, nested)
+		case scalar && wireType == expected:
+			value, _, err := field.decodeScalar(payload)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		case scalar && wireType == protoBytes && field.Repeated:
+			// Packed numbers
+			for len(payload) > 0 {
+				value, used, err := field.decodeScalar(payload)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, value)
+				payload = payload[used:]
+			}
+		default:
+			return nil, fmt.Errorf("%s.%s: wire type %d doesn't match %s", d.Name, field.Name, wireType, field.Type)
+		}
+
+		if field.Repeated {
+			list, _ := decoded[field.Name].([]interface{})
+			decoded[field.Name] = append(list, values...)
+		} else {
+			decoded[field.Name] = values[len(values)-1]
+		}
+	}
+	return decoded, nil
+}
+
+// Decode a scalar value at the start of payload, returns the bytes it used
+func (f *ProtoField) decodeScalar(payload []byte) (interface{}, int, error) {
+	truncated := fmt.Errorf("%s: truncated value", f.Name)
+	switch protoWireTypes[f.Type] {
+	case protoBytes:
+		if f.Type == "string" {
+			return string(payload), len(payload), nil
+		}
+		return base64.StdEncoding.EncodeToString(payload), len(payload), nil
+	case protoFixed32:
+		if len(payload) < 4 {
+			return nil, 0, truncated
+		}
+		n := binary.LittleEndian.Uint32(payload)
+		switch f.Type {
+		case "float":
+			return float64(math.Float32frombits(n)), 4, nil
+		case "sfixed32":
+			return int64(int32(n)), 4, nil
+		}
+		return uint64(n), 4, nil
+	case protoFixed64:
+		if len(payload) < 8 {
+			return nil, 0, truncated
+		}
+		n := binary.LittleEndian.Uint64(payload)
+		switch f.Type {
+		case "double":
+			return math.Float64frombits(n), 8, nil
+		case "sfixed64":
+			return int64(n), 8, nil
+		}
+		return n, 8, nil
+	}
+	n, used := binary.Uvarint(payload)
+	if used <= 0 {
+		return nil, 0, truncated
+	}
+	switch f.Type {
+	case "bool":
+		return n != 0, used, nil
+	case "uint32":
+		return uint64(uint32(n)), used, nil
+	case "uint64":
+		return n, used, nil
+	case "int32":
+		return int64(int32(n)), used, nil
+	case "sint32", "sint64":
+		return int64(n>>1) ^ -int64(n&1), used, nil
+	}
+	return int64(n), used, nil
+}
+
+// Value of the JSON data that doesn't fit its field
+type protoValueError struct {
+	field *ProtoField
+	value interface{}
+}
+
+func (e *protoValueError) Error() string {
+	return fmt.Sprintf("%s: %v isn't a valid %s", e.field.Name, e.value, e.field.Type)
+}
+
+func protoAppendTag(b []byte, number, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(number)<<3|uint64(wireType))
+}
+
+// Get an integer of the JSON data (also given as a string, as proto3 JSON does for 64 bits)
+func protoInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Get an unsigned integer of the JSON data
+func protoUint(value interface{}) (uint64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return parseUint64(string(v))
+	case string:
+		return parseUint64(v)
+	}
+	return 0, false
+}
+
+// Get a floating point number of the JSON data
+func protoFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// RequestProtoData sends JSON data as a protobuf message described by descriptor
+//
+// Same as RequestProto() for callers without generated proto code: data is
+// marshaled with descriptor, the target reads it with its own generated
+// code or with OutputManager.GetProtoData().
+//
+// Parameters:
+//
+//	isUnique: Expect single output (true) or multiple (false)
+//	optionalOutput: Output is optional (true) or required (false)
+//	data: JSON object holding the fields of the message
+//	descriptor: Message type of the data
+//	language: Target language/runtime
+//	file: Path to target file
+func (im *InputManager) RequestProtoData(isUnique, optionalOutput bool, data string, descriptor *ProtoDescriptor, language, file string) {
+	message, err := descriptor.Marshal(data)
+	if err != nil {
+		im.err = err
+		im.Response = InputManagerResponse{
+			RequestStatus:    false,
+			RequestStatusSet: true,
+			OptionalOutput:   optionalOutput,
+			IsUnique:         isUnique,
+			Warnings:         []string{},
+			Errors:           []string{fmt.Sprintf("Error: %s", err.Error())},
+		}
+		return
+	}
+	im.RequestProto(isUnique, optionalOutput, message, descriptor.Name, language, file)
+}
+
+// GetProtoData returns the protobuf message sent by the target as JSON data
+//
+// Parameters:
+//
+//	descriptor: Message type of the output
+//
+// Returns:
+//
+//	string: JSON object holding the fields of the message
+//	error: No protobuf output, or a message that doesn't match descriptor
+func (im *InputManager) GetProtoData(descriptor *ProtoDescriptor) (string, error) {
+	message, _ := im.GetProto()
+	if message == nil {
+		return "", errors.New("No protobuf output")
+	}
+	return descriptor.Unmarshal(message)
+}
+
+// GetProtoData returns the request data sent as a protobuf message as JSON data
+//
+// Parameters:
+//
+//	descriptor: Message type of the request data
+//
+// Returns:
+//
+//	string: JSON object holding the fields of the message
+//	error: No protobuf data, or a message that doesn't match descriptor
+func (om *OutputManager) GetProtoData(descriptor *ProtoDescriptor) (string, error) {
+	message, _ := om.GetProto()
+	if message == nil {
+		return "", errors.New("No protobuf data")
+	}
+	return descriptor.Unmarshal(message)
+}
+
+// OutputProtoData sends JSON data back as a protobuf message described by descriptor
+//
+// Data that doesn't match descriptor fails the request instead.
+//
+// Parameters:
+//
+//	data: JSON object holding the fields of the message
+//	descriptor: Message type of the output
+func (om *OutputManager) OutputProtoData(data string, descriptor *ProtoDescriptor) {
+	message, err := descriptor.Marshal(data)
+	if err != nil {
+		om.OutputError(err)
+		return
+	}
+	om.OutputProto(message, descriptor.Name)
+}
+
+// GetProtoData calls GetProtoData() on the OutputManager created by Init()
+func GetProtoData(descriptor *ProtoDescriptor) (string, error) {
+	return autoOutputManager().GetProtoData(descriptor)
+}
+
+// OutputProtoData calls OutputProtoData() on the OutputManager created by Init()
+func OutputProtoData(data string, descriptor *ProtoDescriptor) {
+	autoOutputManager().OutputProtoData(data, descriptor)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Message of the protobuf encoding guide, with a nested copy of itself
+var testDescriptor = &ProtoDescriptor{
+	Name: "test.Test",
+	Fields: []ProtoField{
+		{Number: 1, Name: "a", Type: "int32"},
+		{Number: 2, Name: "b", Type: "string"},
+		{Number: 3, Name: "c", Type: "message", Message: &ProtoDescriptor{Name: "test.Nested", Fields: []ProtoField{{Number: 1, Name: "a", Type: "int32"}}}},
+		{Number: 4, Name: "d", Type: "int32", Repeated: true},
+		{Number: 5, Name: "e", Type: "sint64"},
+		{Number: 6, Name: "f", Type: "bytes"},
+		{Number: 7, Name: "g", Type: "double"},
+		{Number: 8, Name: "h", Type: "bool"},
+	},
+}
+
+func TestProtoDescriptorMarshal(t *testing.T) {
+	message, err := testDescriptor.Marshal(`{"a":150,"b":"testing","c":{"a":150},"d":[3,270,86942],"e":-2,"f":"AQI=","g":1.5,"h":true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := hex.DecodeString("089601" + "120774657374696e67" + "1a03089601" + "2206038e029ea705" + "2803" + "32020102" + "39000000000000f83f" + "4001")
+	if !bytes.Equal(message, want) {
+		t.Fatalf("expected %x, got %x", want, message)
+	}
+
+	data, err := testDescriptor.Unmarshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != `{"a":150,"b":"testing","c":{"a":150},"d":[3,270,86942],"e":-2,"f":"AQI=","g":1.5,"h":true}` {
+		t.Errorf("unexpected data %s", data)
+	}
+}
+
+func TestProtoDescriptorInvalidData(t *testing.T) {
+	for _, data := range []string{`[1]`, `{"a":"x"}`, `{"a":3000000000}`, `{"d":1}`, `{"c":2}`} {
+		if _, err := testDescriptor.Marshal(data); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+	if _, err := testDescriptor.Unmarshal([]byte{0x12, 0x07, 't'}); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+}
+
+func TestRequestProtoData(t *testing.T) {
+	transport := &scriptedTransport{lines: func(requestKey string) [][]byte {
+		return [][]byte{outputLine(requestKey, `"CJYB"`)}
+	}}
+	im := NewInputManager(WithTransport(transport))
+	im.RequestProtoData(true, false, `{"a":1}`, testDescriptor, "", "")
+	data, err := im.GetProtoData(testDescriptor)
+	if err != nil || data != `{"a":150}` {
+		t.Errorf("expected {\"a\":150}, got %s (%v)", data, err)
+	}
+
+	im.RequestProtoData(true, false, `{"a":"x"}`, testDescriptor, "", "")
+	if im.Response.RequestStatus || len(im.Response.Errors) != 1 {
+		t.Errorf("expected invalid data to fail the request, got %+v", im.Response)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+// Protocol channels
+//
+// Every message may carry a "channel" field. Messages without it (or on
+// ChannelData) are regular outputs, other channels carry side information
+// that is routed to the handlers registered with WithChannelHandler().
+const (
+	// ChannelData carries regular outputs (default when no channel is set)
+	ChannelData = "data"
+	// ChannelDone ends a conversation on a shared connection (see Mux)
+	ChannelDone = "done"
+	// ChannelFile carries file chunks (see SendFile())
+	ChannelFile = "file"
+	// ChannelChunk carries pieces of oversized messages (see WithChunking())
+	ChannelChunk = "chunk"
+	// ChannelHandshake announces the protocol support of the target (see PeerInfo)
+	ChannelHandshake = "handshake"
+	// ChannelProgress carries progress reports (see OutputProgress())
+	ChannelProgress = "progress"
+	// ChannelWarning carries warnings of the target (see Warn())
+	ChannelWarning = "warning"
+	// ChannelStream carries text written to OutputStream()
+	ChannelStream = "stream"
+	// ChannelCallback carries calls of the target to the calling process (see CallParent())
+	ChannelCallback = "callback"
+	// ChannelReply carries the results of callbacks back to the target
+	ChannelReply = "reply"
+	// ChannelNamed carries outputs sent on a named output channel (see OutputTo())
+	ChannelNamed = "named"
+	// ChannelHeartbeat tells the calling process the target is still busy (see Heartbeat())
+	ChannelHeartbeat = "heartbeat"
+)
+
+// Get the channel of a message, ChannelData when unset
+func messageChannel(message map[string]interface{}) string {
+	if channel, ok := message["channel"].(string); ok && channel != "" {
+		return channel
+	}
+	return ChannelData
+}
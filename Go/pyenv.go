@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// WithVirtualenv runs Python targets inside a virtualenv
+//
+// The target runs with the interpreter of the virtualenv, so the packages
+// installed in it with pip are found, and with the virtualenv activated
+// (VIRTUAL_ENV set, its scripts first in PATH). WithInterpreter() takes
+// precedence over it.
+//
+// Parameters:
+//
+//	dir: Directory of the virtualenv (e.g. ".venv")
+func WithVirtualenv(dir string) Option {
+	return func(im *InputManager) {
+		im.pythonEnv = dir
+		im.conda = false
+	}
+}
+
+// WithCondaEnv runs Python targets inside a conda environment
+//
+// The environment is looked up with conda (or mamba), the target then runs
+// with its interpreter and the environment activated (CONDA_PREFIX set,
+// its binaries first in PATH). WithInterpreter() takes precedence over it.
+//
+// Parameters:
+//
+//	name: Name of the environment ("base" included) or path to its prefix
+func WithCondaEnv(name string) Option {
+	return func(im *InputManager) {
+		im.pythonEnv = name
+		im.conda = true
+	}
+}
+
+// Prefixes of the conda environments already looked up, by name
+var (
+	condaMu       sync.Mutex
+	condaPrefixes = map[string]string{}
+)
+
+// Get the prefix of a conda environment
+func condaPrefix(name string) (string, error) {
+	if filepath.IsAbs(name) || strings.ContainsAny(name, `/\`) {
+		return name, nil
+	}
+	condaMu.Lock()
+	defer condaMu.Unlock()
+	if prefix, ok := condaPrefixes[name]; ok {
+		return prefix, nil
+	}
+
+	conda, err := lookupInterpreter("PYTHON", "conda")
+	if err != nil {
+		return "", err
+	}
+	output, err := exec.Command(conda, "env", "list", "--json").Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to list conda environments: %s", err.Error())
+	}
+	var list struct {
+		Envs []string `json:"envs"`
+	}
+	if err := json.Unmarshal(output, &list); err != nil {
+		return "", fmt.Errorf("Failed to list conda environments: %s", err.Error())
+	}
+	// The base environment is the first one listed
+	for i, prefix := range list.Envs {
+		if filepath.Base(prefix) == name || (name == "base" && i == 0) {
+			condaPrefixes[name] = prefix
+			return prefix, nil
+		}
+	}
+	return "", fmt.Errorf("Conda environment not found: %s", name)
+}
+
+// Get the prefix of the Python environment of the InputManager
+func (im *InputManager) pythonPrefix() (string, error) {
+	if im.conda {
+		return condaPrefix(im.pythonEnv)
+	}
+	if info, err := os.Stat(im.pythonEnv); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("Virtualenv not found: %s", im.pythonEnv)
+	}
+	return im.pythonEnv, nil
+}
+
+// Get the directory holding the executables of a Python environment
+func pythonBinDir(prefix string, conda bool) string {
+	if runtime.GOOS != "windows" {
+		return filepath.Join(prefix, "bin")
+	}
+	if conda {
+		return prefix
+	}
+	return filepath.Join(prefix, "Scripts")
+}
+
+// Get the interpreter of the Python environment
+func (im *InputManager) pythonEnvInterpreter() (string, error) {
+	prefix, err := im.pythonPrefix()
+	if err != nil {
+		return "", err
+	}
+	name := "python"
+	if runtime.GOOS == "windows" {
+		name = "python.exe"
+	}
+	interpreter, err := filepath.Abs(filepath.Join(pythonBinDir(prefix, im.conda), name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(interpreter); err != nil {
+		return "", &RuntimeNotFoundError{Language: "PYTHON", Candidates: []string{interpreter}}
+	}
+	return interpreter, nil
+}
+
+// Get the PATH entries and variables activating the Python environment
+func (im *InputManager) pythonEnvVars() ([]string, []string) {
+	if im.pythonEnv == "" {
+		return nil, nil
+	}
+	prefix, err := im.pythonPrefix()
+	if err != nil {
+		return nil, nil
+	}
+	prefix, _ = filepath.Abs(prefix)
+	path := []string{pythonBinDir(prefix, im.conda)}
+	if runtime.GOOS == "windows" && im.conda {
+		path = append(path, filepath.Join(prefix, "Scripts"), filepath.Join(prefix, "Library", "bin"))
+	}
+	if im.conda {
+		return path, []string{"CONDA_PREFIX=" + prefix, "CONDA_DEFAULT_ENV=" + im.pythonEnv}
+	}
+	return path, []string{"VIRTUAL_ENV=" + prefix}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Recording is one request saved by WithRecording()
+//
+// Fields:
+//
+//	Time: When the target was started
+//	Key: Key of the request
+//	Language: Target language as passed to Request()
+//	File: Target file as passed to Request()
+//	Command: Command run
+//	Sent: Messages written to the target (request, file chunks)
+//	Received: Raw lines read back, non-JSON lines included
+//	Stderr: What the target wrote to stderr (ProcessTransport only)
+//	ExitCode: Exit code of the target (-1 when unknown)
+//	Error: Why the target failed
+//	Duration: Time from the start to the end of the target
+type Recording struct {
+	Time     time.Time      `json:"time"`
+	Key      string         `json:"key"`
+	Language string         `json:"language"`
+	File     string         `json:"file"`
+	Command  []string       `json:"command"`
+	Sent     []RecordedLine `json:"sent"`
+	Received []RecordedLine `json:"received"`
+	Stderr   string         `json:"stderr,omitempty"`
+	ExitCode int            `json:"exit_code"`
+	Error    string         `json:"error,omitempty"`
+	Duration time.Duration  `json:"duration_ns"`
+}
+
+// RecordedLine is a line of a Recording
+//
+// Fields:
+//
+//	Offset: Time since the start of the target
+//	Line: Line without its end
+type RecordedLine struct {
+	Offset time.Duration `json:"offset_ns"`
+	Line   string        `json:"line"`
+}
+
+// WithRecording saves every request of the InputManager to a file
+//
+// Each request is appended as a Recording on one JSON line once its
+// target ended. Play them back with ReplayTransport to reproduce a bug
+// without the original target or environment. The request payload is
+// saved as is, keep the file private.
+//
+// Parameters:
+//
+//	path: File the recordings are appended to
+func WithRecording(path string) Option {
+	return func(im *InputManager) {
+		im.recordPath = path
+	}
+}
+
+// Recording of the current request, nil when recording is off
+type recorder struct {
+	mu    sync.Mutex
+	path  string
+	start time.Time
+	rec   Recording
+}
+
+// Start recording the current request
+func (im *InputManager) startRecording(language, file string, command []string) *recorder {
+	if im.recordPath == "" {
+		return nil
+	}
+	start := time.Now()
+	return &recorder{path: im.recordPath, start: start, rec: Recording{
+		Time:     start,
+		Key:      im.key,
+		Language: language,
+		File:     file,
+		Command:  command,
+		Sent:     []RecordedLine{},
+		Received: []RecordedLine{},
+	}}
+}
+
+func (r *recorder) line(lines *[]RecordedLine, line []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*lines = append(*lines, RecordedLine{Offset: time.Since(r.start), Line: string(line)})
+}
+
+func (r *recorder) received(line []byte) {
+	if r != nil {
+		r.line(&r.rec.Received, line)
+	}
+}
+
+// Record each message written with send
+func (r *recorder) send(send func(message []byte) error) func(message []byte) error {
+	if r == nil {
+		return send
+	}
+	return func(message []byte) error {
+		r.line(&r.rec.Sent, message)
+		return send(message)
+	}
+}
+
+// Append the recording to its file once the target ended
+func (r *recorder) save(transport Transport, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rec.Duration = time.Since(r.start)
+	r.rec.ExitCode = exitCode(transport, err)
+	if source, ok := transport.(interface{ Stderr() string }); ok {
+		r.rec.Stderr = source.Stderr()
+	}
+	if err != nil {
+		r.rec.Error = err.Error()
+	}
+	line, _ := json.Marshal(r.rec)
+	f, openErr := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if openErr == nil {
+		_, openErr = f.Write(append(line, '\n'))
+		f.Close()
+	}
+	if openErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: can't save recording to %s: %s\n", r.path, openErr.Error())
+	}
+}
+
+// Get the exit code of the target (-1 when unknown)
+func exitCode(transport Transport, err error) int {
+	var exitErr *ExitError
+	if cmd := transportProcess(transport); cmd != nil && cmd.ProcessState != nil {
+		return cmd.ProcessState.ExitCode()
+	} else if errors.As(err, &exitErr) {
+		return exitErr.Code
+	} else if err == nil {
+		return 0
+	}
+	return -1
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// RecoverAndReport turns a panic into a failed response
+//
+// Must be deferred directly, after Cleanup() so it runs first:
+//
+//	defer Cleanup()
+//	defer RecoverAndReport()
+//
+// The calling process gets request_status=false with the panic message
+// and the stack in Response.Errors instead of a bare exit code. Handlers
+// run by Serve() and Dispatch() are already protected.
+func (om *OutputManager) RecoverAndReport() {
+	if r := recover(); r != nil {
+		om.reportPanic(r)
+	}
+}
+
+// Report a recovered panic to the calling process
+func (om *OutputManager) reportPanic(r interface{}) error {
+	err := fmt.Errorf("panic: %v", r)
+	if om == nil || om.data == "" {
+		om.Output("")
+		return err
+	}
+	om.writeFailure([]Problem{{Code: CodePanic, Message: err.Error(), Detail: fmt.Sprintf("stack: %s", debug.Stack())}}, nil)
+	return err
+}
+
+// RecoverAndReport calls RecoverAndReport() on the OutputManager created by Init()
+func RecoverAndReport() {
+	// recover() only stops the panic when called by the deferred function
+	if r := recover(); r != nil {
+		globalOutputManager.reportPanic(r)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ReplayTransport plays back requests saved with WithRecording()
+//
+// No target is run: the lines it sent are read back as they were
+// recorded, with the key of the new request, and it ends as it did. A
+// Request() with an empty language and file replays the recordings in
+// order, otherwise the next one recorded for this language and file is
+// used. Recordings of signed requests (see WithSigningKey()) can't be
+// replayed since their signatures cover the original key.
+//
+// Fields:
+//
+//	Realtime: Wait between lines as long as the target did
+type ReplayTransport struct {
+	Realtime   bool
+	recordings []Recording
+	used       []bool
+	current    *Recording
+	key        string
+	next       int
+	opened     time.Time
+}
+
+// NewReplayTransport loads the recordings of a file
+//
+// Parameters:
+//
+//	path: File written with WithRecording()
+//
+// Returns:
+//
+//	*ReplayTransport: Transport for WithTransport()
+//	error: File not found or not a recording
+func NewReplayTransport(path string) (*ReplayTransport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &ReplayTransport{}
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var recording Recording
+			if err := json.Unmarshal(line, &recording); err != nil {
+				return nil, fmt.Errorf("Invalid recording at line %d of %s: %s", n, path, err.Error())
+			}
+			t.recordings = append(t.recordings, recording)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.used = make([]bool, len(t.recordings))
+	return t, nil
+}
+
+// Open picks the recording to play back
+func (t *ReplayTransport) Open(target Target) error {
+	t.current, t.key, t.next = nil, "", 0
+	anyTarget := target.Language == "" && target.File == ""
+	for i := range t.recordings {
+		recording := &t.recordings[i]
+		if !t.used[i] && (anyTarget || (recording.Language == target.Language && recording.File == target.File)) {
+			t.used[i] = true
+			t.current = recording
+			break
+		}
+	}
+	if t.current == nil {
+		return fmt.Errorf("Failed to replay: no recording left for %s %s", target.Language, target.File)
+	}
+	t.opened = time.Now()
+	return nil
+}
+
+// Send takes the key of the new request from the first message, the
+// messages themselves are dropped
+func (t *ReplayTransport) Send(message []byte) error {
+	if t.key == "" {
+		var envelope struct {
+			Key string `json:"key"`
+		}
+		json.Unmarshal(message, &envelope)
+		t.key = envelope.Key
+	}
+	return nil
+}
+
+// Receive returns the next recorded line, io.EOF after the last one
+func (t *ReplayTransport) Receive() ([]byte, error) {
+	if t.current == nil || t.next >= len(t.current.Received) {
+		return nil, io.EOF
+	}
+	recorded := t.current.Received[t.next]
+	t.next++
+	if t.Realtime {
+		time.Sleep(time.Until(t.opened.Add(recorded.Offset)))
+	}
+	line := []byte(recorded.Line)
+	if t.key != "" && t.current.Key != "" {
+		line = bytes.ReplaceAll(line, []byte(t.current.Key), []byte(t.key))
+	}
+	return line, nil
+}
+
+// Stderr returns what the recorded target wrote to stderr
+func (t *ReplayTransport) Stderr() string {
+	if t.current == nil {
+		return ""
+	}
+	return t.current.Stderr
+}
+
+// Close ends the request as the recorded target did
+//
+// Returns:
+//
+//	error: *ExitError if the recorded target exited with a non-zero code
+func (t *ReplayTransport) Close() error {
+	if t.current == nil || t.current.ExitCode <= 0 {
+		return nil
+	}
+	return &ExitError{Code: t.current.ExitCode, Stderr: t.current.Stderr}
+}
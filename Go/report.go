@@ -0,0 +1,40 @@
+package main
+
+// OutputError fails the request with an error
+//
+// Sends a request_status=false response carrying the error, which counts
+// as the output of the request (further outputs are out of bound when
+// isUnique=true). Pass a *Problem to give the error a code.
+//
+// Parameters:
+//
+//	err: Error reported to the calling process (in Response.Errors and Response.ErrorDetails)
+func (om *OutputManager) OutputError(err error) {
+	if om == nil || om.data == "" {
+		om.Output("")
+		return
+	}
+	om.writeFailure([]Problem{problemOf(err)}, nil)
+}
+
+// Warn reports a warning without failing the request
+//
+// The warning is sent right away to calling processes speaking the
+// versioned protocol, and with the next response to the others.
+//
+// Parameters:
+//
+//	message: Warning reported to the calling process (in Response.Warnings)
+func (om *OutputManager) Warn(message string) {
+	om.WarnProblem(Problem{Code: CodeWarning, Message: message})
+}
+
+// OutputError calls OutputError() on the OutputManager created by Init()
+func OutputError(err error) {
+	autoOutputManager().OutputError(err)
+}
+
+// Warn calls Warn() on the OutputManager created by Init()
+func Warn(message string) {
+	autoOutputManager().Warn(message)
+}
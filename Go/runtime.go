@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// RuntimeNotFoundError reports a target whose runtime isn't installed
+//
+// Fields:
+//
+//	Language: Language of the target
+//	Candidates: Interpreters looked up in PATH, in order
+type RuntimeNotFoundError struct {
+	Language   string
+	Candidates []string
+}
+
+func (e *RuntimeNotFoundError) Error() string {
+	return fmt.Sprintf("Runtime not installed for %s (tried: %s)", e.Language, strings.Join(e.Candidates, ", "))
+}
+
+// Interpreters tried in order for each default interpreter
+var (
+	candidatesMu          sync.RWMutex
+	interpreterCandidates = map[string][]string{
+		"python":  {"python3", "python"},
+		"php":     {"php", "php8", "php7"},
+		"lua":     {"lua", "luajit", "lua5.4", "lua5.3", "lua5.1"},
+		"tsx":     {"tsx", "ts-node"},
+		"Rscript": {"Rscript"},
+		"cc":      {"cc", "gcc", "clang"},
+		"c++":     {"c++", "g++", "clang++"},
+		"conda":   {"conda", "mamba"},
+	}
+)
+
+func init() {
+	// The py launcher is the usual Python entry point on Windows
+	if runtime.GOOS == "windows" {
+		interpreterCandidates["python"] = []string{"py", "python", "python3"}
+	}
+}
+
+// SetInterpreterCandidates sets the interpreters tried for a runtime
+//
+// When a target needs interpreter, the candidates are looked up in PATH in
+// order and the first one found runs it (PATHEXT is honored on Windows,
+// so node finds node.exe or a node.cmd shim). WithInterpreter() bypasses
+// the lookup order.
+//
+// Parameters:
+//
+//	interpreter: Default interpreter of a language (e.g. "python")
+//	candidates: Commands or paths to try, in order
+func SetInterpreterCandidates(interpreter string, candidates ...string) {
+	candidatesMu.Lock()
+	defer candidatesMu.Unlock()
+	interpreterCandidates[interpreter] = candidates
+}
+
+// Find the interpreter to run, *RuntimeNotFoundError when none is installed
+func lookupInterpreter(language, interpreter string) (string, error) {
+	candidatesMu.RLock()
+	candidates, ok := interpreterCandidates[interpreter]
+	candidatesMu.RUnlock()
+	if !ok {
+		candidates = []string{interpreter}
+	}
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", &RuntimeNotFoundError{Language: language, Candidates: candidates}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLookupInterpreter(t *testing.T) {
+	SetInterpreterCandidates("mangle-test-runtime", "mangle-missing-runtime", "sh")
+	if found, err := lookupInterpreter("TEST", "mangle-test-runtime"); err != nil || found != "sh" {
+		t.Errorf("expected the first installed candidate, got %q (%v)", found, err)
+	}
+
+	SetInterpreterCandidates("mangle-test-runtime", "mangle-missing-runtime", "mangle-missing-runtime2")
+	_, err := lookupInterpreter("TEST", "mangle-test-runtime")
+	var notFound *RuntimeNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected a RuntimeNotFoundError, got %v", err)
+	}
+	if want := []string{"mangle-missing-runtime", "mangle-missing-runtime2"}; notFound.Language != "TEST" || !reflect.DeepEqual(notFound.Candidates, want) {
+		t.Errorf("expected the candidates of TEST, got %+v", notFound)
+	}
+}
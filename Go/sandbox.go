@@ -0,0 +1,59 @@
+package main
+
+// Sandbox limits what a target process can reach
+//
+// The zero value takes the network and the privileges away, but neither
+// the files nor the memory: set IsolateFiles and MaxMemory for those. On
+// Linux the target runs in its own user, PID, IPC, UTS and mount
+// namespaces, and in an empty network namespace unless AllowNetwork is
+// set; it is killed when the calling process dies. It still sees and can
+// write every file the calling user can unless IsolateFiles is set. On
+// Windows it runs with a restricted token (no privileges, administrators
+// group denied) inside a Job Object killing it with the calling process,
+// AllowNetwork must be set since Windows can't take the network away from
+// a process, and the files of the calling user stay reachable. Other
+// systems can't sandbox, the request fails instead of running unprotected.
+//
+// Limits are in place before the target runs: on Linux MaxMemory is set by
+// the same helper as IsolateFiles (see below), on Windows the target is
+// created suspended and only resumed once in its Job Object.
+//
+// With IsolateFiles (Linux only), the target sees a filesystem of its own
+// instead of the one of the calling process: the system directories
+// (/usr, /bin, /lib, a few files of /etc) and the runtime running it
+// read-only, the directory of its file read-only, the declared data
+// directories, an empty /tmp and a private /proc. Nothing else is
+// reachable, even by path. The view is built by the calling program,
+// started again as a helper before the target, and the target keeps no
+// capability to undo it.
+//
+// Fields:
+//
+//	AllowNetwork: Keep network access
+//	MaxMemory: Largest address space (Linux) or committed memory (Windows) in bytes (0 = no limit)
+//	MaxProcesses: Largest number of processes of the target, itself included (Windows only, 0 = no limit)
+//	IsolateFiles: Show the target only the directories it needs (Linux only)
+//	ReadOnlyDirs: Data directories visible read-only with IsolateFiles
+//	WritableDirs: Data directories visible read-write with IsolateFiles
+type Sandbox struct {
+	AllowNetwork bool
+	MaxMemory    int64
+	MaxProcesses int
+	IsolateFiles bool
+	ReadOnlyDirs []string
+	WritableDirs []string
+}
+
+// WithSandbox runs targets started by the InputManager in a Sandbox
+//
+// Applies to the default ProcessTransport, set ProcessTransport.Sandbox
+// for transports built by hand.
+//
+// Parameters:
+//
+//	sandbox: Limits of the target processes
+func WithSandbox(sandbox Sandbox) Option {
+	return func(im *InputManager) {
+		im.sandbox = &sandbox
+	}
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Set the namespaces of the target before it starts
+func (s *Sandbox) prepare(cmd *exec.Cmd) error {
+	flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS | syscall.CLONE_NEWNS
+	if !s.AllowNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+	// The target keeps its ids (or the ones of WithUser()), without any
+	// capability outside its namespaces
+	uid, gid := os.Getuid(), os.Getgid()
+	var credential *syscall.Credential
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Credential != nil {
+		credential = cmd.SysProcAttr.Credential
+		uid, gid = int(credential.Uid), int(credential.Gid)
+		credential.Groups = nil
+		credential.NoSetGroups = true
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 uintptr(flags),
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Credential:                 credential,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+	return nil
+}
+
+// Nothing left to apply once the target started, its memory limit is set
+// by the helper before it runs (see isolate())
+func (s *Sandbox) started(process *os.Process) (func(), error) {
+	return func() {}, nil
+}
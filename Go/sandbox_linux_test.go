@@ -0,0 +1,38 @@
+//go:build linux
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Lines written by a sandboxed shell command
+func sandboxedOutput(t *testing.T, sandbox Sandbox, script string) []string {
+	transport := &ProcessTransport{Sandbox: &sandbox}
+	if err := transport.Open(Target{Command: []string{"sh", "-c", script}}); err != nil {
+		t.Skipf("sandbox unavailable: %s", err.Error())
+	}
+	lines := []string{}
+	for {
+		line, err := transport.Receive()
+		if err != nil {
+			break
+		}
+		lines = append(lines, string(line))
+	}
+	if err := transport.Close(); err != nil {
+		t.Fatalf("%s (%s)", err.Error(), transport.Stderr())
+	}
+	return lines
+}
+
+func TestSandboxMemoryLimitBeforeStart(t *testing.T) {
+	for _, isolate := range []bool{false, true} {
+		// The limit of the shell itself, set before it ran
+		lines := sandboxedOutput(t, Sandbox{AllowNetwork: true, MaxMemory: 512 << 20, IsolateFiles: isolate}, "ulimit -v")
+		if strings.Join(lines, "\n") != "524288" {
+			t.Errorf("IsolateFiles=%v: expected an address space limit of 524288 KB, got %q", isolate, lines)
+		}
+	}
+}
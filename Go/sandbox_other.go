@@ -0,0 +1,23 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Sandboxing isn't available, refuse to run the target
+func (s *Sandbox) prepare(cmd *exec.Cmd) error {
+	return fmt.Errorf("Sandboxing is not supported on %s", runtime.GOOS)
+}
+
+func (s *Sandbox) started(process *os.Process) (func(), error) {
+	return func() {}, nil
+}
+
+func (s *Sandbox) isolate(cmd *exec.Cmd, file string, extra []string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,195 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	advapi32                     = syscall.NewLazyDLL("advapi32.dll")
+	procCreateJobObject          = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procOpenProcess              = kernel32.NewProc("OpenProcess")
+	procCreateToolhelp32Snapshot = kernel32.NewProc("CreateToolhelp32Snapshot")
+	procThread32First            = kernel32.NewProc("Thread32First")
+	procThread32Next             = kernel32.NewProc("Thread32Next")
+	procOpenThread               = kernel32.NewProc("OpenThread")
+	procResumeThread             = kernel32.NewProc("ResumeThread")
+	procCreateRestrictedToken    = advapi32.NewProc("CreateRestrictedToken")
+	procAllocateAndInitializeSid = advapi32.NewProc("AllocateAndInitializeSid")
+	procFreeSid                  = advapi32.NewProc("FreeSid")
+)
+
+const (
+	jobObjectExtendedLimitInformation = 9
+	jobLimitActiveProcess             = 0x8
+	jobLimitProcessMemory             = 0x100
+	jobLimitKillOnJobClose            = 0x2000
+	disableMaxPrivilege               = 0x1
+	processSetQuota                   = 0x100
+	processTerminate                  = 0x1
+	createSuspended                   = 0x4
+	th32csSnapThread                  = 0x4
+	threadSuspendResume               = 0x2
+)
+
+type jobBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type jobExtendedLimitInformation struct {
+	BasicLimitInformation jobBasicLimitInformation
+	IoInfo                [6]uint64
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+type threadEntry32 struct {
+	Size           uint32
+	Usage          uint32
+	ThreadID       uint32
+	OwnerProcessID uint32
+	BasePriority   int32
+	DeltaPriority  int32
+	Flags          uint32
+}
+
+type sidAndAttributes struct {
+	Sid        *syscall.SID
+	Attributes uint32
+}
+
+// Run the target with a restricted token, suspended until started() put
+// it in its Job Object
+func (s *Sandbox) prepare(cmd *exec.Cmd) error {
+	if !s.AllowNetwork {
+		return errors.New("Sandboxing can't take the network away on windows, set AllowNetwork")
+	}
+	if s.IsolateFiles {
+		return errors.New("Filesystem isolation is not supported on windows")
+	}
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	var token syscall.Token
+	if err := syscall.OpenProcessToken(process, syscall.TOKEN_ALL_ACCESS, &token); err != nil {
+		return err
+	}
+	defer token.Close()
+
+	// BUILTIN\Administrators is only used to deny access
+	var admins *syscall.SID
+	authority := [6]byte{0, 0, 0, 0, 0, 5}
+	if r, _, err := procAllocateAndInitializeSid.Call(uintptr(unsafe.Pointer(&authority)), 2, 32, 544, 0, 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&admins))); r == 0 {
+		return err
+	}
+	defer procFreeSid.Call(uintptr(unsafe.Pointer(admins)))
+	deny := sidAndAttributes{Sid: admins}
+
+	var restricted syscall.Token
+	if r, _, err := procCreateRestrictedToken.Call(uintptr(token), disableMaxPrivilege, 1, uintptr(unsafe.Pointer(&deny)), 0, 0, 0, 0, uintptr(unsafe.Pointer(&restricted))); r == 0 {
+		return err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Token = restricted
+	cmd.SysProcAttr.CreationFlags |= createSuspended
+	return nil
+}
+
+// Put the suspended target in a Job Object with the limits of the
+// Sandbox, then let it run
+func (s *Sandbox) started(process *os.Process) (func(), error) {
+	job, _, err := procCreateJobObject.Call(0, 0)
+	if job == 0 {
+		return nil, err
+	}
+	release := func() { syscall.CloseHandle(syscall.Handle(job)) }
+
+	info := jobExtendedLimitInformation{}
+	info.BasicLimitInformation.LimitFlags = jobLimitKillOnJobClose
+	if s.MaxProcesses > 0 {
+		info.BasicLimitInformation.LimitFlags |= jobLimitActiveProcess
+		info.BasicLimitInformation.ActiveProcessLimit = uint32(s.MaxProcesses)
+	}
+	if s.MaxMemory > 0 {
+		info.BasicLimitInformation.LimitFlags |= jobLimitProcessMemory
+		info.ProcessMemoryLimit = uintptr(s.MaxMemory)
+	}
+	if r, _, err := procSetInformationJobObject.Call(job, jobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info)); r == 0 {
+		release()
+		return nil, err
+	}
+
+	handle, _, err := procOpenProcess.Call(processSetQuota|processTerminate, 0, uintptr(process.Pid))
+	if handle == 0 {
+		release()
+		return nil, err
+	}
+	defer syscall.CloseHandle(syscall.Handle(handle))
+	if r, _, err := procAssignProcessToJobObject.Call(job, handle); r == 0 {
+		release()
+		return nil, err
+	}
+	if err := resumeProcess(process.Pid); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// Resume the threads of a process created suspended
+func resumeProcess(pid int) error {
+	snapshot, _, err := procCreateToolhelp32Snapshot.Call(th32csSnapThread, 0)
+	if syscall.Handle(snapshot) == syscall.InvalidHandle {
+		return err
+	}
+	defer syscall.CloseHandle(syscall.Handle(snapshot))
+
+	entry := threadEntry32{Size: uint32(unsafe.Sizeof(threadEntry32{}))}
+	resumed := 0
+	r, _, err := procThread32First.Call(snapshot, uintptr(unsafe.Pointer(&entry)))
+	for ; r != 0; r, _, err = procThread32Next.Call(snapshot, uintptr(unsafe.Pointer(&entry))) {
+		if entry.OwnerProcessID != uint32(pid) {
+			continue
+		}
+		thread, _, openErr := procOpenThread.Call(threadSuspendResume, 0, uintptr(entry.ThreadID))
+		if thread == 0 {
+			return openErr
+		}
+		result, _, resumeErr := procResumeThread.Call(thread)
+		syscall.CloseHandle(syscall.Handle(thread))
+		if uint32(result) == 0xFFFFFFFF {
+			return resumeErr
+		}
+		resumed++
+	}
+	if resumed == 0 {
+		return err
+	}
+	return nil
+}
+
+// Filesystem isolation is refused by prepare()
+func (s *Sandbox) isolate(cmd *exec.Cmd, file string, extra []string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError describes one JSON Schema violation
+//
+// Fields:
+//
+//	Path: JSON pointer to the invalid value ("" for the root)
+//	Message: What is wrong with the value
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Schema is a compiled JSON Schema
+//
+// Supported keywords: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, uniqueItems, minLength,
+// maxLength, pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// multipleOf, allOf, anyOf, oneOf, not, and local $ref ("#/$defs/...",
+// "#/definitions/..."). Other keywords are ignored.
+type Schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// CompileSchema parses a JSON Schema
+//
+// Parameters:
+//
+//	schema: JSON Schema document as a JSON string
+//
+// Returns:
+//
+//	*Schema: Compiled schema
+//	error: Invalid JSON or invalid pattern
+func CompileSchema(schema string) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return nil, fmt.Errorf("Invalid schema: %s", err.Error())
+	}
+	s := &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.compilePatterns(root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Pre-compile every "pattern" keyword
+func (s *Schema) compilePatterns(node interface{}) error {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, value := range n {
+			if pattern, ok := value.(string); ok && key == "pattern" {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return fmt.Errorf("Invalid schema pattern %q: %s", pattern, err.Error())
+				}
+				s.patterns[pattern] = re
+			} else if err := s.compilePatterns(value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range n {
+			if err := s.compilePatterns(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks JSON data against the schema
+//
+// Parameters:
+//
+//	data: JSON string (as produced by Bundle())
+//
+// Returns:
+//
+//	[]ValidationError: Violations, empty when the data is valid
+func (s *Schema) Validate(data string) []ValidationError {
+	var value interface{}
+	if data != "" {
+		if err := unmarshalNumbers([]byte(data), &value); err != nil {
+			return []ValidationError{{Message: fmt.Sprintf("invalid JSON: %s", err.Error())}}
+		}
+	}
+	return s.ValidateValue(value)
+}
+
+// ValidateValue checks an already decoded value against the schema
+func (s *Schema) ValidateValue(value interface{}) []ValidationError {
+	errs := []ValidationError{}
+	s.validate(s.root, value, "", &errs, 0)
+	return errs
+}
+
+func (s *Schema) validate(node interface{}, value interface{}, path string, errs *[]ValidationError, depth int) {
+	if depth > 64 {
+		*errs = append(*errs, ValidationError{path, "schema nesting too deep"})
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, ValidationError{path, fmt.Sprintf(format, args...)})
+	}
+
+	// Losslessly decoded numbers are checked as float64
+	if number, ok := value.(json.Number); ok {
+		value, _ = number.Float64()
+	}
+
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			fail("no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+		if ref, ok := n["$ref"].(string); ok {
+			target, found := s.resolve(ref)
+			if !found {
+				fail("unresolved $ref %s", ref)
+				return
+			}
+			s.validate(target, value, path, errs, depth+1)
+		}
+
+		if t, ok := n["type"]; ok && !schemaTypeMatches(t, value) {
+			fail("expected %s, got %s", schemaTypeString(t), jsonTypeName(value))
+			return
+		}
+
+		if enum, ok := n["enum"].([]interface{}); ok {
+			found := false
+			for _, option := range enum {
+				if jsonEqual(option, value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fail("value must be one of %s", compactJSON(enum))
+			}
+		}
+		if constant, ok := n["const"]; ok && !jsonEqual(constant, value) {
+			fail("value must be %s", compactJSON(constant))
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			s.validateObject(n, v, path, errs, depth)
+		case []interface{}:
+			s.validateArray(n, v, path, errs, depth)
+		case string:
+			length := float64(utf8.RuneCountInString(v))
+			if min, ok := n["minLength"].(float64); ok && length < min {
+				fail("string shorter than %v", min)
+			}
+			if max, ok := n["maxLength"].(float64); ok && length > max {
+				fail("string longer than %v", max)
+			}
+			if pattern, ok := n["pattern"].(string); ok && !s.patterns[pattern].MatchString(v) {
+				fail("string does not match pattern %s", pattern)
+			}
+		case float64:
+			if min, ok := n["minimum"].(float64); ok && v < min {
+				fail("value must be >= %v", min)
+			}
+			if max, ok := n["maximum"].(float64); ok && v > max {
+				fail("value must be <= %v", max)
+			}
+			if min, ok := n["exclusiveMinimum"].(float64); ok && v <= min {
+				fail("value must be > %v", min)
+			}
+			if max, ok := n["exclusiveMaximum"].(float64); ok && v >= max {
+				fail("value must be < %v", max)
+			}
+			if multiple, ok := n["multipleOf"].(float64); ok && multiple > 0 {
+				if q := v / multiple; math.Abs(q-math.Round(q)) > 1e-9 {
+					fail("value must be a multiple of %v", multiple)
+				}
+			}
+		}
+
+		if all, ok := n["allOf"].([]interface{}); ok {
+			for _, sub := range all {
+				s.validate(sub, value, path, errs, depth+1)
+			}
+		}
+		if anyOf, ok := n["anyOf"].([]interface{}); ok {
+			if s.countMatches(anyOf, value, depth) == 0 {
+				fail("value does not match any allowed schema")
+			}
+		}
+		if oneOf, ok := n["oneOf"].([]interface{}); ok {
+			if matches := s.countMatches(oneOf, value, depth); matches != 1 {
+				fail("value must match exactly one schema, matched %d", matches)
+			}
+		}
+		if not, ok := n["not"]; ok {
+			sub := []ValidationError{}
+			s.validate(not, value, path, &sub, depth+1)
+			if len(sub) == 0 {
+				fail("value matches a forbidden schema")
+			}
+		}
+	}
+}
+
+func (s *Schema) validateObject(n map[string]interface{}, v map[string]interface{}, path string, errs *[]ValidationError, depth int) {
+	if required, ok := n["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := v[key]; !present {
+					*errs = append(*errs, ValidationError{path, fmt.Sprintf("missing required property %q", key)})
+				}
+			}
+		}
+	}
+
+	properties, _ := n["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "/" + escapePointer(key)
+		if sub, ok := properties[key]; ok {
+			s.validate(sub, v[key], childPath, errs, depth+1)
+			continue
+		}
+		switch additional := n["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, ValidationError{path, fmt.Sprintf("unexpected property %q", key)})
+			}
+		case map[string]interface{}:
+			s.validate(additional, v[key], childPath, errs, depth+1)
+		}
+	}
+}
+
+func (s *Schema) validateArray(n map[string]interface{}, v []interface{}, path string, errs *[]ValidationError, depth int) {
+	length := float64(len(v))
+	if min, ok := n["minItems"].(float64); ok && length < min {
+		*errs = append(*errs, ValidationError{path, fmt.Sprintf("array shorter than %v", min)})
+	}
+	if max, ok := n["maxItems"].(float64); ok && length > max {
+		*errs = append(*errs, ValidationError{path, fmt.Sprintf("array longer than %v", max)})
+	}
+	if unique, _ := n["uniqueItems"].(bool); unique {
+		for i := range v {
+			for j := i + 1; j < len(v); j++ {
+				if jsonEqual(v[i], v[j]) {
+					*errs = append(*errs, ValidationError{path, fmt.Sprintf("items %d and %d are equal", i, j)})
+				}
+			}
+		}
+	}
+	if items, ok := n["items"]; ok {
+		for i, item := range v {
+			s.validate(items, item, path+"/"+strconv.Itoa(i), errs, depth+1)
+		}
+	}
+}
+
+// Count the sub-schemas matched by a value
+func (s *Schema) countMatches(schemas []interface{}, value interface{}, depth int) int {
+	matches := 0
+	for _, sub := range schemas {
+		subErrs := []ValidationError{}
+		s.validate(sub, value, "", &subErrs, depth+1)
+		if len(subErrs) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+// Resolve a local $ref ("#", "#/$defs/name", "#/definitions/name", ...)
+func (s *Schema) resolve(ref string) (interface{}, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+	node := s.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+func schemaTypeMatches(t interface{}, value interface{}) bool {
+	switch typ := t.(type) {
+	case string:
+		return jsonTypeIs(typ, value)
+	case []interface{}:
+		for _, option := range typ {
+			if name, ok := option.(string); ok && jsonTypeIs(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func schemaTypeString(t interface{}) string {
+	if list, ok := t.([]interface{}); ok {
+		names := []string{}
+		for _, item := range list {
+			names = append(names, fmt.Sprint(item))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func jsonTypeIs(name string, value interface{}) bool {
+	switch name {
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return jsonTypeName(value) == name
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func compactJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// ValidateData checks the request data against a schema
+//
+// If the data is invalid, a request_status=false response listing the
+// violations (as "validation_errors") is sent to the calling process, so
+// the child can stop before type assertions on bad data panic.
+//
+// Parameters:
+//
+//	schema: Compiled schema, see CompileSchema()
+//
+// Returns:
+//
+//	[]ValidationError: Violations, empty when the data is valid
+func (om *OutputManager) ValidateData(schema *Schema) []ValidationError {
+	if om == nil || om.data == "" {
+		return []ValidationError{{Message: "OutputManager isn't initialized"}}
+	}
+
+	errs := schema.Validate(om.data)
+	if len(errs) == 0 {
+		return errs
+	}
+
+	problems := []Problem{}
+	for _, e := range errs {
+		problems = append(problems, Problem{Code: CodeInvalidData, Message: fmt.Sprintf("invalid request data: %s", e.Error())})
+	}
+	om.writeFailure(problems, map[string]interface{}{"validation_errors": errs})
+	return errs
+}
+
+// ValidateData calls ValidateData() on the OutputManager created by Init()
+func ValidateData(schema *Schema) []ValidationError {
+	return autoOutputManager().ValidateData(schema)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// SecretFDEnv tells the target which inherited file descriptor (or handle
+// on Windows) carries the secrets of SendSecret()
+const SecretFDEnv = "MANGLE_SECRET_FD"
+
+// SendSecret passes a secret to the targets of the InputManager
+//
+// Secrets go through a pipe the target inherits, never on its command
+// line, in its environment or in the request, so they don't show in
+// process listings or logged requests. The target gets them with
+// GetSecret(name). Only the default ProcessTransport can pass them.
+//
+// Parameters:
+//
+//	name: Name of the secret
+//	value: Secret value
+func (im *InputManager) SendSecret(name string, value []byte) {
+	if im.secrets == nil {
+		im.secrets = make(map[string][]byte)
+	}
+	im.secrets[name] = value
+}
+
+// Start writing secrets to a pipe, returns the end the target inherits
+func secretPipe(secrets map[string][]byte) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	secretBytes, _ := json.Marshal(secrets)
+	// Written aside, secrets larger than the pipe buffer would block Start()
+	go func() {
+		w.Write(secretBytes)
+		w.Close()
+	}()
+	return r, nil
+}
+
+// Secrets received from the calling process, read once
+var (
+	secretsOnce     sync.Once
+	receivedSecrets map[string][]byte
+	secretsErr      error
+)
+
+// Read the secrets passed by the calling process
+func readSecrets() {
+	value := os.Getenv(SecretFDEnv)
+	if value == "" {
+		return
+	}
+	os.Unsetenv(SecretFDEnv)
+	fd, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		secretsErr = fmt.Errorf("Invalid %s: %s", SecretFDEnv, value)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "secrets")
+	if f == nil {
+		secretsErr = fmt.Errorf("Invalid %s: %s", SecretFDEnv, value)
+		return
+	}
+	defer f.Close()
+	secretBytes, err := io.ReadAll(f)
+	if err != nil {
+		secretsErr = fmt.Errorf("Failed to read secrets: %s", err.Error())
+		return
+	}
+	if err := json.Unmarshal(secretBytes, &receivedSecrets); err != nil {
+		secretsErr = fmt.Errorf("Failed to read secrets: %s", err.Error())
+	}
+}
+
+// GetSecret gets a secret passed by the calling process with InputManager.SendSecret()
+//
+// Parameters:
+//
+//	name: Name of the secret
+//
+// Returns:
+//
+//	[]byte: Secret value
+//	error: Secret not received or unreadable
+func GetSecret(name string) ([]byte, error) {
+	secretsOnce.Do(readSecrets)
+	if secretsErr != nil {
+		return nil, secretsErr
+	}
+	value, ok := receivedSecrets[name]
+	if !ok {
+		return nil, errors.New("Secret not received: " + name)
+	}
+	return value, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Serve handles requests from stdin in a loop until it is closed
+//
+// Each request is passed to handler (or dispatched to the handlers
+// registered with RegisterHandler() when handler is nil), then ended with
+// a message on ChannelDone so the calling process knows it is complete.
+// Use it with a Mux on the parent side to keep one worker process alive:
+//
+//	mux := NewMux(NewProcessTransport())
+//	mux.Open(Target{Command: []string{"./worker"}})
+//	im := NewInputManager(WithTransport(mux.Transport()))
+//
+// Parameters:
+//
+//	handler: Function receiving the request data and returning the output (JSON strings)
+//
+// Returns:
+//
+//	error: nil once stdin is closed, or the read error that stopped the loop
+func Serve(handler Handler) error {
+	for {
+		om, err := Init()
+		if err != nil && om.requestJSON == "" {
+			if err == ErrNoRequest {
+				return nil
+			}
+			return err
+		}
+
+		if handler == nil {
+			om.Dispatch()
+		} else {
+			om.runHandler(handler)
+		}
+		// Ends the request with a message on ChannelDone
+		om.Cleanup()
+	}
+}
+
+// Run a handler on the request data and output its result or error
+//
+// A panicking handler fails the request (see RecoverAndReport()).
+func (om *OutputManager) runHandler(handler Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = om.reportPanic(r)
+		}
+	}()
+	if om.data == "" {
+		om.Output("")
+		return errors.New("OutputManager isn't initialized")
+	}
+	output, err := handler(om.data)
+	if err != nil {
+		om.writeFailure([]Problem{problemOf(err)}, nil)
+		return err
+	}
+	om.Output(output)
+	return nil
+}
+
+// End the current request with a message on ChannelDone
+//
+// The message carries the final status of the request, so the calling
+// process can tell a complete response from a target that died halfway.
+// Callers speaking the original protocol would take it for an output.
+func (om *OutputManager) writeDone() {
+	if !om.versioned {
+		// Captured text isn't lost (see CaptureStdout())
+		if om.printed != "" {
+			fmt.Fprint(os.Stderr, om.printed)
+		}
+		return
+	}
+	var key interface{}
+	if om.key != "" {
+		key = om.key
+	}
+	message := map[string]interface{}{
+		"key":            key,
+		"channel":        ChannelDone,
+		"request_status": len(om.errors) == 0,
+	}
+	if om.printed != "" {
+		message["stdout"] = om.printed
+	}
+	om.emitMessage(message)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+)
+
+// SigningKeyEnv passes the key of WithSigningKey() to the target, hex encoded
+//
+// The OutputManager reads it then removes it from its environment, so the
+// processes it starts don't inherit it.
+const SigningKeyEnv = "MANGLE_SIGNING_KEY"
+
+// Field appended to signed messages
+const signatureField = `"sig":"`
+
+// ErrBadSignature reports a message whose signature is missing or wrong
+var ErrBadSignature = errors.New("Invalid message signature")
+
+// WithSigningKey signs the messages exchanged with the target
+//
+// Every message gets an HMAC-SHA256 signature made with key, and every
+// message of the target must carry a valid one: forged or unsigned
+// messages are dropped and fail the request. The key is passed to the
+// target in SigningKeyEnv, the Go OutputManager then signs and verifies
+// on its side.
+//
+// Parameters:
+//
+//	key: Secret shared with the target (32 random bytes or more)
+func WithSigningKey(key []byte) Option {
+	return func(im *InputManager) {
+		im.signKey = key
+	}
+}
+
+// Key of the OutputManager, from SetSigningKey() or SigningKeyEnv
+var (
+	signingMu  sync.Mutex
+	signingKey []byte
+)
+
+// SetSigningKey sets the key the OutputManager signs and verifies messages with
+//
+// Only needed when the key isn't passed in SigningKeyEnv, call it before
+// Init().
+//
+// Parameters:
+//
+//	key: Secret shared with the calling process
+func SetSigningKey(key []byte) {
+	signingMu.Lock()
+	defer signingMu.Unlock()
+	signingKey = key
+}
+
+// Get the key of the OutputManager, nil when messages aren't signed
+func outputSigningKey() []byte {
+	signingMu.Lock()
+	defer signingMu.Unlock()
+	if signingKey == nil {
+		if encoded := os.Getenv(SigningKeyEnv); encoded != "" {
+			signingKey, _ = hex.DecodeString(encoded)
+			os.Unsetenv(SigningKeyEnv)
+		}
+	}
+	return signingKey
+}
+
+// Compute the signature of a message
+func messageSignature(key, message []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign a JSON object message by adding a last "sig" field
+func signMessage(key, message []byte) []byte {
+	if key == nil || len(message) < 2 || message[len(message)-1] != '}' {
+		return message
+	}
+	signed := append([]byte{}, message[:len(message)-1]...)
+	if !bytes.Equal(bytes.TrimSpace(signed), []byte("{")) {
+		signed = append(signed, ',')
+	}
+	signed = append(signed, signatureField...)
+	signed = append(signed, messageSignature(key, message)...)
+	return append(signed, '"', '}')
+}
+
+// Check the signature of a message, returns it without the "sig" field
+func verifyMessage(key, message []byte) ([]byte, error) {
+	if key == nil {
+		return message, nil
+	}
+	suffix := len(signatureField) + sha256.Size*2 + 2
+	if len(message) < suffix+1 || !bytes.HasPrefix(message[len(message)-suffix:], []byte(signatureField)) {
+		return nil, ErrBadSignature
+	}
+	signature := message[len(message)-suffix+len(signatureField) : len(message)-2]
+	original := append(bytes.TrimSuffix(append([]byte{}, message[:len(message)-suffix]...), []byte(",")), '}')
+	if !hmac.Equal(signature, []byte(messageSignature(key, original))) {
+		return nil, ErrBadSignature
+	}
+	return original, nil
+}
+
+// Sign the messages sent through send
+func signedSender(key []byte, send func(message []byte) error) func(message []byte) error {
+	if key == nil {
+		return send
+	}
+	return func(message []byte) error {
+		return send(signMessage(key, message))
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Transport answering each request with lines built from its key
+type scriptedTransport struct {
+	lines func(key string) [][]byte
+	queue [][]byte
+}
+
+func (t *scriptedTransport) Open(target Target) error {
+	return nil
+}
+
+func (t *scriptedTransport) Send(message []byte) error {
+	var request struct {
+		Key string `json:"key"`
+	}
+	if json.Unmarshal(message, &request) == nil && request.Key != "" && t.queue == nil {
+		t.queue = t.lines(request.Key)
+	}
+	return nil
+}
+
+func (t *scriptedTransport) Receive() ([]byte, error) {
+	if len(t.queue) == 0 {
+		return nil, io.EOF
+	}
+	line := t.queue[0]
+	t.queue = t.queue[1:]
+	return line, nil
+}
+
+func (t *scriptedTransport) Close() error {
+	return nil
+}
+
+// Output message of a target answering a request
+func outputLine(key string, data string) []byte {
+	return []byte(fmt.Sprintf(`{"key":%q,"request_status":true,"data":%s,"optionalOutput":false,"isUnique":true,"errors":[],"warnings":[]}`, key, data))
+}
+
+func TestSignVerify(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	message := []byte(`{"key":"k","data":[1,2]}`)
+	signed := signMessage(key, message)
+	verified, err := verifyMessage(key, signed)
+	if err != nil || string(verified) != string(message) {
+		t.Fatalf("expected %s back, got %s (%v)", message, verified, err)
+	}
+
+	tampered := []byte(strings.Replace(string(signed), "[1,2]", "[1,3]", 1))
+	if _, err := verifyMessage(key, tampered); err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature for a tampered message, got %v", err)
+	}
+	if _, err := verifyMessage([]byte("another key, 32 bytes long......"), signed); err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature for another key, got %v", err)
+	}
+	if _, err := verifyMessage(key, message); err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature for an unsigned message, got %v", err)
+	}
+}
+
+func TestUnsignedOutputFails(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	transport := &scriptedTransport{lines: func(requestKey string) [][]byte {
+		return [][]byte{outputLine(requestKey, "1")}
+	}}
+	im := NewInputManager(WithTransport(transport), WithSigningKey(key))
+	im.Request(true, false, "1", "", "")
+
+	if im.Response.RequestStatus || im.Response.Data != "" {
+		t.Errorf("an unsigned output was accepted: %+v", im.Response)
+	}
+}
+
+func TestSignedMessagesSucceed(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	transport := &scriptedTransport{lines: func(requestKey string) [][]byte {
+		return [][]byte{signMessage(key, outputLine(requestKey, "1"))}
+	}}
+	im := NewInputManager(WithTransport(transport), WithSigningKey(key))
+	im.Request(true, false, "1", "", "")
+
+	if !im.Response.RequestStatus || im.Response.Data != "1" {
+		t.Errorf("expected a successful request, got %+v", im.Response)
+	}
+}
+
+func TestForgedMessageFailsRequest(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	transport := &scriptedTransport{lines: func(requestKey string) [][]byte {
+		return [][]byte{
+			signMessage(key, outputLine(requestKey, "1")),
+			[]byte(fmt.Sprintf(`{"key":%q,"channel":"warning","warning":"forged"}`, requestKey)),
+		}
+	}}
+	im := NewInputManager(WithTransport(transport), WithSigningKey(key))
+	im.Request(true, false, "1", "", "")
+
+	if im.Response.RequestStatus {
+		t.Errorf("request succeeded with a forged message: %+v", im.Response)
+	}
+	if len(im.Response.Errors) != 1 {
+		t.Errorf("expected one error, got %q", im.Response.Errors)
+	}
+	for _, warning := range im.Response.Warnings {
+		if warning == "forged" {
+			t.Error("the forged message wasn't dropped")
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// CodeSlowRequest is the code of the warning of requests slower than WithSlowThreshold()
+const CodeSlowRequest = "SLOW_REQUEST"
+
+// WithSlowThreshold flags the requests taking longer than threshold
+//
+// A slow request still completes, it gets a CodeSlowRequest warning in
+// Response.Warnings and Response.WarningDetails and calls Hooks.OnSlow,
+// so a target getting slower shows before it times out.
+//
+// Parameters:
+//
+//	threshold: Longest expected duration of a request (0 = no check)
+func WithSlowThreshold(threshold time.Duration) Option {
+	return func(im *InputManager) {
+		im.slow = threshold
+	}
+}
+
+// Flag the request once its duration is known
+func (im *InputManager) checkSlow() {
+	if im.slow <= 0 || im.Response.Duration <= im.slow {
+		return
+	}
+	problem := Problem{
+		Code:    CodeSlowRequest,
+		Message: fmt.Sprintf("the request took %s, more than %s.", im.Response.Duration.Round(time.Millisecond), im.slow),
+	}
+	im.Response.Warnings = append(im.Response.Warnings, "Warning: "+problem.Message)
+	im.Response.WarningDetails = append(im.Response.WarningDetails, problem)
+	im.log().Warn("slow request", "duration", im.Response.Duration, "threshold", im.slow)
+	if im.hooks != nil && im.hooks.OnSlow != nil {
+		im.hooks.OnSlow(im.info, im.Response.Duration)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Number of failed requests kept for Status()
+const statusFailures = 20
+
+// HealthStatus is a snapshot of the requests of the process, for health checks
+//
+// Fields:
+//
+//	Time: When the snapshot was taken
+//	Healthy: No probed runtime is missing
+//	Total: Requests made since the process started
+//	Failed: Requests that failed since the process started
+//	Active: Requests waiting for their target, oldest first
+//	RecentFailures: Last failed requests, most recent first
+//	Runtimes: Last result of Probe() or Doctor() for each language probed
+type HealthStatus struct {
+	Time           time.Time       `json:"time"`
+	Healthy        bool            `json:"healthy"`
+	Total          int64           `json:"total"`
+	Failed         int64           `json:"failed"`
+	Active         []ActiveRequest `json:"active"`
+	RecentFailures []FailedRequest `json:"recent_failures"`
+	Runtimes       []RuntimeStatus `json:"runtimes"`
+}
+
+// ActiveRequest is a request waiting for its target
+//
+// Fields:
+//
+//	Key: Key of the request
+//	CorrelationID: See WithCorrelationID()
+//	Language: Target language as passed to Request()
+//	File: Target file as passed to Request()
+//	PID: Process ID of the target (0 before it started or without a local process)
+//	Started: When Request() was called
+type ActiveRequest struct {
+	Key           string    `json:"key"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Language      string    `json:"language"`
+	File          string    `json:"file"`
+	PID           int       `json:"pid,omitempty"`
+	Started       time.Time `json:"started"`
+}
+
+// FailedRequest is a request that failed
+//
+// Fields:
+//
+//	Time: When Request() was called
+//	Key: Key of the request
+//	CorrelationID: See WithCorrelationID()
+//	Language: Target language as passed to Request()
+//	File: Target file as passed to Request()
+//	Duration: Time the request took
+//	Errors: Response.Errors of the request
+type FailedRequest struct {
+	Time          time.Time     `json:"time"`
+	Key           string        `json:"key"`
+	CorrelationID string        `json:"correlation_id,omitempty"`
+	Language      string        `json:"language"`
+	File          string        `json:"file"`
+	Duration      time.Duration `json:"duration_ns"`
+	Errors        []string      `json:"errors"`
+}
+
+// RuntimeStatus is the last probe of a language runtime
+//
+// Fields:
+//
+//	Language: Main name of the language
+//	Installed: The runtime was found
+//	Path: Full path of the runtime
+//	Version: Version reported by the runtime
+//	Error: Why the runtime can't be used
+//	Time: When it was probed
+type RuntimeStatus struct {
+	Language  string    `json:"language"`
+	Installed bool      `json:"installed"`
+	Path      string    `json:"path,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Requests and probes seen by the process
+var (
+	statusMu       sync.Mutex
+	statusTotal    int64
+	statusFailed   int64
+	statusActive   = map[string]*ActiveRequest{}
+	statusRecent   []FailedRequest
+	statusRuntimes = map[string]RuntimeStatus{}
+)
+
+// Status returns a snapshot of the requests of the process
+//
+// Cheap enough to be called on every health check: runtimes aren't probed
+// again, call Doctor() at startup (and from time to time) to refresh them.
+//
+// Returns:
+//
+//	HealthStatus: Snapshot, safe to encode as JSON
+func Status() HealthStatus {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	status := HealthStatus{
+		Time:           time.Now(),
+		Healthy:        true,
+		Total:          statusTotal,
+		Failed:         statusFailed,
+		Active:         []ActiveRequest{},
+		RecentFailures: append([]FailedRequest{}, statusRecent...),
+		Runtimes:       []RuntimeStatus{},
+	}
+	for _, request := range statusActive {
+		status.Active = append(status.Active, *request)
+	}
+	sort.Slice(status.Active, func(i, j int) bool {
+		return status.Active[i].Started.Before(status.Active[j].Started)
+	})
+	for _, runtime := range statusRuntimes {
+		status.Runtimes = append(status.Runtimes, runtime)
+		if !runtime.Installed {
+			status.Healthy = false
+		}
+	}
+	sort.Slice(status.Runtimes, func(i, j int) bool {
+		return status.Runtimes[i].Language < status.Runtimes[j].Language
+	})
+	return status
+}
+
+// StatusHandler serves Status() as JSON, e.g. on /healthz
+//
+// Answers 200 when healthy, 503 otherwise.
+//
+// Returns:
+//
+//	http.Handler: Handler to register on the service mux
+func StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := Status()
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+// Count the request and list it as active
+func (im *InputManager) statusStart(language, file string, start time.Time) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	statusTotal++
+	statusActive[im.key] = &ActiveRequest{
+		Key:           im.key,
+		CorrelationID: im.info.CorrelationID,
+		Language:      language,
+		File:          file,
+		Started:       start,
+	}
+}
+
+// Note the process running the target of the request
+func (im *InputManager) statusProcess(transport Transport) {
+	cmd := transportProcess(transport)
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if request, ok := statusActive[im.key]; ok {
+		request.PID = cmd.Process.Pid
+	}
+}
+
+// Remove the request from the active ones, keeping it when it failed
+func (im *InputManager) statusEnd(language, file string, start time.Time) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if _, ok := statusActive[im.key]; !ok {
+		return
+	}
+	delete(statusActive, im.key)
+	if !im.Response.RequestStatusSet || im.Response.RequestStatus {
+		return
+	}
+	statusFailed++
+	failure := FailedRequest{
+		Time:          start,
+		Key:           im.key,
+		CorrelationID: im.info.CorrelationID,
+		Language:      language,
+		File:          file,
+		Duration:      time.Since(start),
+		Errors:        append([]string{}, im.Response.Errors...),
+	}
+	statusRecent = append([]FailedRequest{failure}, statusRecent...)
+	if len(statusRecent) > statusFailures {
+		statusRecent = statusRecent[:statusFailures]
+	}
+}
+
+// Keep the result of a probe for Status()
+func recordProbe(result ProbeResult) {
+	runtime := RuntimeStatus{
+		Language:  result.Language,
+		Installed: result.Installed,
+		Path:      result.Path,
+		Version:   result.Version,
+		Time:      time.Now(),
+	}
+	if result.Err != nil {
+		runtime.Error = result.Err.Error()
+	}
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	statusRuntimes[runtime.Language] = runtime
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Writer returned by OutputStream()
+type outputStream struct {
+	om     *OutputManager
+	buf    bytes.Buffer
+	closed bool
+}
+
+// OutputStream returns a writer streaming text to the calling process
+//
+// Each Write is sent right away on ChannelStream, Close ends the stream
+// with an output holding the whole text: Request() gets it as one output,
+// ResponseStream() yields every write as it arrives. Calling processes
+// speaking the original protocol get the whole text on Close only.
+//
+// Returns:
+//
+//	io.WriteCloser: Stream writer, must be closed
+func (om *OutputManager) OutputStream() io.WriteCloser {
+	return &outputStream{om: om}
+}
+
+func (s *outputStream) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("Stream is closed")
+	}
+	if s.om == nil || s.om.data == "" {
+		return 0, errors.New("OutputManager isn't initialized")
+	}
+	if !s.om.versioned {
+		return s.buf.Write(p)
+	}
+	if len(p) > 0 {
+		s.om.emitMessage(map[string]interface{}{
+			"key":     s.om.key,
+			"channel": ChannelStream,
+			"data":    string(p),
+		})
+	}
+	return len(p), nil
+}
+
+func (s *outputStream) Close() error {
+	if s.closed {
+		return errors.New("Stream is closed")
+	}
+	s.closed = true
+	if s.om == nil || !s.om.versioned {
+		s.om.writeOutput(s.buf.String(), "", nil)
+		return nil
+	}
+	s.om.writeOutput(nil, "", map[string]interface{}{"streamed": true})
+	return nil
+}
+
+// OutputStream calls OutputStream() on the OutputManager created by Init()
+func OutputStream() io.WriteCloser {
+	return autoOutputManager().OutputStream()
+}
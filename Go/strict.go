@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Reasons of a SecurityError, check them with errors.Is()
+var (
+	// ErrOutsideRoot: the path leads outside the root (e.g. "../")
+	ErrOutsideRoot = errors.New("path outside the root")
+	// ErrSymlinkEscape: the path is inside the root but a symlink leads outside
+	ErrSymlinkEscape = errors.New("symlink escapes the root")
+	// ErrUnsafeName: the file name could be taken for an option or holds control characters
+	ErrUnsafeName = errors.New("unsafe file name")
+	// ErrWritableTarget: other users can modify the file or replace it
+	ErrWritableTarget = errors.New("file writable by other users")
+	// ErrSuspiciousTarget: the file isn't what its language expects (e.g. a script given as an executable)
+	ErrSuspiciousTarget = errors.New("file doesn't match its language")
+)
+
+// SecurityError reports a target refused by the strict mode
+//
+// Fields:
+//
+//	File: Path of the target as passed to Request()
+//	Err: Reason (ErrOutsideRoot, ErrSymlinkEscape, ...)
+type SecurityError struct {
+	File string
+	Err  error
+}
+
+func (e *SecurityError) Error() string {
+	return fmt.Sprintf("Unsafe target %s: %s", e.File, e.Err.Error())
+}
+
+func (e *SecurityError) Unwrap() error {
+	return e.Err
+}
+
+// WithStrictMode only runs target files found under root, checked for tampering
+//
+// The target path is made absolute with its symlinks resolved, and the
+// command runs that path. The target is refused with *SecurityError when
+// it leads outside root, its name starts with "-" or holds control
+// characters, other users can write it or replace it in its directory
+// (Unix), or it doesn't match its language: scripts given as compiled
+// executables, executables that aren't programs, or shell targets whose
+// shebang names another language.
+//
+// The checks cover the file as it is when the request starts: the target
+// is then started (or compiled) from its path, so a process of the same
+// user changing the file in between isn't detected. Only keep targets
+// where nothing else running as that user can write.
+//
+// Parameters:
+//
+//	root: Directory holding every target
+func WithStrictMode(root string) Option {
+	return func(im *InputManager) {
+		im.strictRoot = root
+	}
+}
+
+// Check a target file in strict mode, returns its canonical path
+func strictTarget(root string, spec *languageSpec, file string, info os.FileInfo) (string, error) {
+	base := filepath.Base(file)
+	if strings.HasPrefix(base, "-") || strings.ContainsAny(file, "\x00\n\r") {
+		return "", &SecurityError{File: file, Err: ErrUnsafeName}
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	if !insideDir(root, path) {
+		return "", &SecurityError{File: file, Err: ErrOutsideRoot}
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", err
+	}
+	if !insideDir(realRoot, path) {
+		return "", &SecurityError{File: file, Err: ErrSymlinkEscape}
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0002 != 0 {
+		return "", &SecurityError{File: file, Err: ErrWritableTarget}
+	}
+	// Without the sticky bit, anyone writing the directory can swap the file
+	if dir, err := os.Stat(filepath.Dir(path)); err == nil && runtime.GOOS != "windows" && dir.Mode().Perm()&0002 != 0 && dir.Mode()&os.ModeSticky == 0 {
+		return "", &SecurityError{File: file, Err: ErrWritableTarget}
+	}
+
+	// Targets executed directly must be what their language runs
+	shells := map[string]bool{"SH": true, "BASH": true, "SHELL": true}
+	interpreter := shebangInterpreter(path)
+	if spec.compiled {
+		if _, source := sourceCompilers[strings.ToLower(filepath.Ext(path))]; !source && !executableFormat(path) {
+			return "", &SecurityError{File: file, Err: ErrSuspiciousTarget}
+		}
+	} else if shells[spec.name] && interpreter != "" {
+		if language, ok := shebangLanguages[interpreter]; !ok || !shells[language] {
+			return "", &SecurityError{File: file, Err: ErrSuspiciousTarget}
+		}
+	}
+	return path, nil
+}
+
+// Tell whether path is dir or inside it
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Tell whether a file starts with the header of a native executable (ELF, PE, Mach-O)
+func executableFormat(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	for _, magic := range [][]byte{{0x7f, 'E', 'L', 'F'}, {0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf}, {0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe}, {0xca, 0xfe, 0xba, 0xbe}} {
+		if bytes.Equal(head, magic) {
+			return true
+		}
+	}
+	return bytes.HasPrefix(head, []byte("MZ"))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestStrictTargetWritableDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are checked on Unix only")
+	}
+	spec, _ := lookupLanguage("python")
+	root := t.TempDir()
+	for _, c := range []struct {
+		mode os.FileMode
+		err  error
+	}{
+		{0755, nil},
+		{0777, ErrWritableTarget},
+		{0777 | os.ModeSticky, nil},
+	} {
+		dir, err := os.MkdirTemp(root, "targets-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, "main.py")
+		os.WriteFile(file, []byte("print(1)\n"), 0644)
+		if err := os.Chmod(dir, c.mode); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(file)
+		if _, err := strictTarget(root, spec, file, info); !errors.Is(err, c.err) {
+			t.Errorf("directory mode %s: expected %v, got %v", c.mode, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// OutputManager helper written by GenerateStub()
+//
+// Fields:
+//
+//	file: Name of the module file
+//	source: Template of the module (<% %> delimiters, see stubData)
+type stubTemplate struct {
+	file   string
+	source string
+}
+
+// Helper modules by main language name (see stub_sources.go)
+var stubTemplates = map[string]stubTemplate{
+	"PYTHON":     {file: "mangle_stub.py", source: pythonStub},
+	"JAVASCRIPT": {file: "mangle_stub.js", source: javascriptStub},
+	"RUBY":       {file: "mangle_stub.rb", source: rubyStub},
+	"PERL":       {file: "MangleStub.pm", source: perlStub},
+}
+
+// Protocol details filled in the helper templates, so they follow the Go library
+//
+// Fields:
+//
+//	Version: ProtocolVersion
+//	Library: Library name announced in the handshake (e.g. "python-stub")
+//	Features: Features announced in the handshake
+//	Unsupported: Request fields the helpers can't decode (encoded, compressed, ...)
+//	Handshake, Progress, Warning, Done, Chunk: Channel names
+type stubData struct {
+	Version     int
+	Library     string
+	Features    []string
+	Unsupported []string
+	Handshake   string
+	Progress    string
+	Warning     string
+	Done        string
+	Chunk       string
+}
+
+// StubLanguages lists the languages GenerateStub() writes helpers for
+//
+// Returns:
+//
+//	[]string: Main language names, sorted
+func StubLanguages() []string {
+	names := []string{}
+	for name := range stubTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GenerateStub writes an OutputManager helper module for a language
+//
+// Targets written in languages without a maintained library import the
+// module instead of building the JSON envelope by hand. It reads the
+// request, answers the handshake, checks isUnique/optionalOutput and ends
+// the request on ChannelDone as the Go OutputManager does. Requests it
+// can't decode (codecs, compression, encryption, signatures, chunks) fail
+// with an explicit error. Regenerate the modules when the library is
+// updated, they carry the ProtocolVersion they were written for.
+//
+// Parameters:
+//
+//	language: Language name, aliases included (see StubLanguages())
+//
+// Returns:
+//
+//	string: File name of the module (e.g. "mangle_stub.py")
+//	[]byte: Module source
+//	error: No helper for the language
+func GenerateStub(language string) (string, []byte, error) {
+	name := strings.ToUpper(language)
+	if spec, ok := lookupLanguage(language); ok {
+		name = spec.name
+	}
+	stub, ok := stubTemplates[name]
+	if !ok {
+		return "", nil, fmt.Errorf("No stub for language %s (available: %s)", language, strings.Join(StubLanguages(), ", "))
+	}
+
+	tmpl, err := template.New(stub.file).Delims("<%", "%>").Funcs(template.FuncMap{
+		"list": stubList,
+	}).Parse(stub.source)
+	if err != nil {
+		return "", nil, err
+	}
+	var source bytes.Buffer
+	err = tmpl.Execute(&source, stubData{
+		Version:     ProtocolVersion,
+		Library:     strings.ToLower(name) + "-stub",
+		Features:    []string{FeatureFields, FeatureMeta, FeatureDone},
+		Unsupported: []string{"encoding", "compression", "encryption", "sig"},
+		Handshake:   ChannelHandshake,
+		Progress:    ChannelProgress,
+		Warning:     ChannelWarning,
+		Done:        ChannelDone,
+		Chunk:       ChannelChunk,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return stub.file, source.Bytes(), nil
+}
+
+// Comma-separated quoted strings, valid in the list literals of every helper
+func stubList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,644 @@
+package main
+
+// Templates of the helper modules written by GenerateStub()
+//
+// Each one implements the target side of the protocol with the standard
+// library of its language: read one request line, announce itself when
+// the request is versioned, send outputs, progress reports and warnings,
+// then end with the final status. Writes go to the original stdout,
+// prints are moved to stderr so they can't break the protocol.
+
+const pythonStub = `"""
+OutputManager helper for protocol version <%.Version%>, generated by mangle gen
+
+Do not edit, generate it again when the Go library is updated.
+
+Usage:
+
+    import mangle_stub as om
+
+    om.init()
+    om.output({"double": om.get_data() * 2})
+"""
+import atexit
+import json
+import sys
+
+PROTOCOL_VERSION = <%.Version%>
+
+_stdout = sys.stdout
+_request = None
+_versioned = False
+_initialized = False
+_outputs = 0
+_failed = False
+_closed = False
+_warnings = []
+
+
+def _write(message):
+    _stdout.write(json.dumps(message, separators=(",", ":")) + "\n")
+    _stdout.flush()
+
+
+def _key():
+    return _request.get("key") if _request else None
+
+
+def _envelope(status, data, errors):
+    global _warnings
+    warnings, _warnings = _warnings, []
+    return {
+        "key": _key(),
+        "request_status": status,
+        "data": data,
+        "optionalOutput": _request.get("optionalOutput") if _request else None,
+        "isUnique": _request.get("isUnique") if _request else None,
+        "errors": errors,
+        "warnings": warnings,
+    }
+
+
+def init():
+    """Read the request from stdin, call it before anything else"""
+    global _request, _versioned, _initialized
+    _initialized = True
+    # print() goes to stderr from now on
+    sys.stdout = sys.stderr
+    atexit.register(cleanup)
+    try:
+        _request = json.loads(sys.stdin.readline())
+    except ValueError as e:
+        _request = None
+        fail("Invalid request: %s" % e)
+        return
+    if not isinstance(_request, dict):
+        _request = None
+        fail("Invalid request: not a JSON object")
+        return
+    _versioned = "version" in _request
+    if _versioned:
+        _write({
+            "key": _key(),
+            "channel": "<%.Handshake%>",
+            "version": PROTOCOL_VERSION,
+            "library": "<%.Library%>",
+            "features": [<%list .Features%>],
+        })
+    unsupported = [name for name in (<%list .Unsupported%>) if name in _request]
+    if _request.get("channel") == "<%.Chunk%>":
+        unsupported.append("<%.Chunk%>")
+    if unsupported:
+        fail("Unsupported request (%s), only plain JSON requests can be read" % ", ".join(unsupported))
+
+
+def get_data(name=None):
+    """Get the request data, or one of its named fields"""
+    if not _request or _failed:
+        return None
+    if name is not None:
+        return (_request.get("fields") or {}).get(name)
+    return _request.get("data")
+
+
+def get_meta():
+    """Get the metadata of the request"""
+    return dict((_request or {}).get("meta") or {})
+
+
+def output(value):
+    """Send an output, only once unless the request isn't unique"""
+    global _outputs, _failed
+    if not _initialized:
+        _write(_envelope(False, None, ["Error: OutputManager isn't initialized."]))
+        return
+    if _failed:
+        return
+    errors = []
+    if _outputs > 0 and _request.get("isUnique"):
+        errors.append("Error: outputs out of bound (isUnique: true).")
+        _failed = True
+    _write(_envelope(not errors, value, errors))
+    _outputs += 1
+
+
+def progress(percent, message=""):
+    """Report the progress (0-100) of a long task, it isn't an output"""
+    if _versioned:
+        _write({"key": _key(), "channel": "<%.Progress%>", "percent": percent, "message": message})
+
+
+def warn(message):
+    """Report a warning without failing the request"""
+    if _versioned:
+        _write({"key": _key(), "channel": "<%.Warning%>", "warning": "Warning: " + message})
+    else:
+        _warnings.append("Warning: " + message)
+
+
+def fail(message):
+    """Fail the request, the failure counts as its output"""
+    global _outputs, _failed
+    if _failed:
+        return
+    _write(_envelope(False, None, ["Error: " + message]))
+    _outputs += 1
+    _failed = True
+
+
+def cleanup():
+    """End the request, called at exit"""
+    global _closed
+    if _closed or not _initialized:
+        return
+    _closed = True
+    if _request and _outputs == 0 and not _request.get("optionalOutput"):
+        fail("the target ended without output.")
+    if _versioned:
+        _write({"key": _key(), "channel": "<%.Done%>", "request_status": not _failed})
+    sys.stdout = _stdout
+`
+
+const javascriptStub = `/**
+ * OutputManager helper for protocol version <%.Version%>, generated by mangle gen
+ *
+ * Do not edit, generate it again when the Go library is updated.
+ *
+ * Usage:
+ *
+ *     const om = require("./mangle_stub");
+ *
+ *     om.init();
+ *     om.output({ double: om.getData() * 2 });
+ */
+"use strict";
+
+const fs = require("fs");
+
+const PROTOCOL_VERSION = <%.Version%>;
+
+let request = null;
+let versioned = false;
+let initialized = false;
+let outputs = 0;
+let failed = false;
+let closed = false;
+let warnings = [];
+
+function write(message) {
+  fs.writeSync(1, JSON.stringify(message) + "\n");
+}
+
+function key() {
+  return request && request.key !== undefined ? request.key : null;
+}
+
+function envelope(status, data, errors) {
+  const pending = warnings;
+  warnings = [];
+  return {
+    key: key(),
+    request_status: status,
+    data: data === undefined ? null : data,
+    optionalOutput: request ? request.optionalOutput : null,
+    isUnique: request ? request.isUnique : null,
+    errors: errors,
+    warnings: pending,
+  };
+}
+
+// Read stdin up to the first line end
+function readLine() {
+  const chunks = [];
+  const buffer = Buffer.alloc(65536);
+  for (;;) {
+    let n;
+    try {
+      n = fs.readSync(0, buffer, 0, buffer.length, null);
+    } catch (e) {
+      if (e.code === "EAGAIN") continue;
+      if (e.code === "EOF") break;
+      throw e;
+    }
+    if (n === 0) break;
+    const chunk = Buffer.from(buffer.subarray(0, n));
+    const end = chunk.indexOf(10);
+    if (end >= 0) {
+      chunks.push(chunk.subarray(0, end));
+      break;
+    }
+    chunks.push(chunk);
+  }
+  return Buffer.concat(chunks).toString("utf8");
+}
+
+/** Read the request from stdin, call it before anything else */
+function init() {
+  initialized = true;
+  // console.log() goes to stderr from now on
+  console.log = console.error;
+  process.on("exit", cleanup);
+  try {
+    request = JSON.parse(readLine());
+  } catch (e) {
+    request = null;
+    fail("Invalid request: " + e.message);
+    return;
+  }
+  if (request === null || typeof request !== "object" || Array.isArray(request)) {
+    request = null;
+    fail("Invalid request: not a JSON object");
+    return;
+  }
+  versioned = "version" in request;
+  if (versioned) {
+    write({
+      key: key(),
+      channel: "<%.Handshake%>",
+      version: PROTOCOL_VERSION,
+      library: "<%.Library%>",
+      features: [<%list .Features%>],
+    });
+  }
+  const unsupported = [<%list .Unsupported%>].filter((name) => name in request);
+  if (request.channel === "<%.Chunk%>") {
+    unsupported.push("<%.Chunk%>");
+  }
+  if (unsupported.length > 0) {
+    fail("Unsupported request (" + unsupported.join(", ") + "), only plain JSON requests can be read");
+  }
+}
+
+/** Get the request data, or one of its named fields */
+function getData(name) {
+  if (!request || failed) return null;
+  if (name !== undefined) {
+    const fields = request.fields || {};
+    return name in fields ? fields[name] : null;
+  }
+  return request.data === undefined ? null : request.data;
+}
+
+/** Get the metadata of the request */
+function getMeta() {
+  return Object.assign({}, (request && request.meta) || {});
+}
+
+/** Send an output, only once unless the request isn't unique */
+function output(value) {
+  if (!initialized) {
+    write(envelope(false, null, ["Error: OutputManager isn't initialized."]));
+    return;
+  }
+  if (failed) return;
+  const errors = [];
+  if (outputs > 0 && request.isUnique) {
+    errors.push("Error: outputs out of bound (isUnique: true).");
+    failed = true;
+  }
+  write(envelope(errors.length === 0, value, errors));
+  outputs++;
+}
+
+/** Report the progress (0-100) of a long task, it isn't an output */
+function progress(percent, message) {
+  if (versioned) {
+    write({ key: key(), channel: "<%.Progress%>", percent: percent, message: message || "" });
+  }
+}
+
+/** Report a warning without failing the request */
+function warn(message) {
+  if (versioned) {
+    write({ key: key(), channel: "<%.Warning%>", warning: "Warning: " + message });
+  } else {
+    warnings.push("Warning: " + message);
+  }
+}
+
+/** Fail the request, the failure counts as its output */
+function fail(message) {
+  if (failed) return;
+  write(envelope(false, null, ["Error: " + message]));
+  outputs++;
+  failed = true;
+}
+
+/** End the request, called at exit */
+function cleanup() {
+  if (closed || !initialized) return;
+  closed = true;
+  if (request && outputs === 0 && !request.optionalOutput) {
+    fail("the target ended without output.");
+  }
+  if (versioned) {
+    write({ key: key(), channel: "<%.Done%>", request_status: !failed });
+  }
+}
+
+module.exports = { PROTOCOL_VERSION, init, getData, getMeta, output, progress, warn, fail, cleanup };
+`
+
+const rubyStub = `# OutputManager helper for protocol version <%.Version%>, generated by mangle gen
+#
+# Do not edit, generate it again when the Go library is updated.
+#
+# Usage:
+#
+#     require_relative "mangle_stub"
+#
+#     MangleStub.init
+#     MangleStub.output({ "double" => MangleStub.get_data * 2 })
+
+require "json"
+
+module MangleStub
+  PROTOCOL_VERSION = <%.Version%>
+
+  @stdout = $stdout
+  @request = nil
+  @versioned = false
+  @initialized = false
+  @outputs = 0
+  @failed = false
+  @closed = false
+  @warnings = []
+
+  module_function
+
+  def write(message)
+    @stdout.write(JSON.generate(message) + "\n")
+    @stdout.flush
+  end
+
+  def key
+    @request ? @request["key"] : nil
+  end
+
+  def envelope(status, data, errors)
+    warnings = @warnings
+    @warnings = []
+    {
+      "key" => key,
+      "request_status" => status,
+      "data" => data,
+      "optionalOutput" => @request ? @request["optionalOutput"] : nil,
+      "isUnique" => @request ? @request["isUnique"] : nil,
+      "errors" => errors,
+      "warnings" => warnings
+    }
+  end
+
+  # Read the request from stdin, call it before anything else
+  def init
+    @initialized = true
+    # puts goes to stderr from now on
+    $stdout = $stderr
+    at_exit { cleanup }
+    begin
+      @request = JSON.parse($stdin.gets || "")
+    rescue JSON::ParserError => e
+      @request = nil
+      fail("Invalid request: #{e.message}")
+      return
+    end
+    unless @request.is_a?(Hash)
+      @request = nil
+      fail("Invalid request: not a JSON object")
+      return
+    end
+    @versioned = @request.key?("version")
+    if @versioned
+      write({
+        "key" => key,
+        "channel" => "<%.Handshake%>",
+        "version" => PROTOCOL_VERSION,
+        "library" => "<%.Library%>",
+        "features" => [<%list .Features%>]
+      })
+    end
+    unsupported = [<%list .Unsupported%>].select { |name| @request.key?(name) }
+    unsupported << "<%.Chunk%>" if @request["channel"] == "<%.Chunk%>"
+    fail("Unsupported request (#{unsupported.join(", ")}), only plain JSON requests can be read") unless unsupported.empty?
+  end
+
+  # Get the request data, or one of its named fields
+  def get_data(name = nil)
+    return nil if @request.nil? || @failed
+    return (@request["fields"] || {})[name] unless name.nil?
+    @request["data"]
+  end
+
+  # Get the metadata of the request
+  def get_meta
+    ((@request || {})["meta"] || {}).dup
+  end
+
+  # Send an output, only once unless the request isn't unique
+  def output(value)
+    unless @initialized
+      write(envelope(false, nil, ["Error: OutputManager isn't initialized."]))
+      return
+    end
+    return if @failed
+    errors = []
+    if @outputs > 0 && @request["isUnique"]
+      errors << "Error: outputs out of bound (isUnique: true)."
+      @failed = true
+    end
+    write(envelope(errors.empty?, value, errors))
+    @outputs += 1
+  end
+
+  # Report the progress (0-100) of a long task, it isn't an output
+  def progress(percent, message = "")
+    write({ "key" => key, "channel" => "<%.Progress%>", "percent" => percent, "message" => message }) if @versioned
+  end
+
+  # Report a warning without failing the request
+  def warn(message)
+    if @versioned
+      write({ "key" => key, "channel" => "<%.Warning%>", "warning" => "Warning: #{message}" })
+    else
+      @warnings << "Warning: #{message}"
+    end
+  end
+
+  # Fail the request, the failure counts as its output
+  def fail(message)
+    return if @failed
+    write(envelope(false, nil, ["Error: #{message}"]))
+    @outputs += 1
+    @failed = true
+  end
+
+  # End the request, called at exit
+  def cleanup
+    return if @closed || !@initialized
+    @closed = true
+    fail("the target ended without output.") if @request && @outputs.zero? && !@request["optionalOutput"]
+    write({ "key" => key, "channel" => "<%.Done%>", "request_status" => !@failed }) if @versioned
+    $stdout = @stdout
+  end
+
+  private_class_method :write, :key, :envelope
+end
+`
+
+const perlStub = `# OutputManager helper for protocol version <%.Version%>, generated by mangle gen
+#
+# Do not edit, generate it again when the Go library is updated.
+#
+# Usage:
+#
+#     use lib '.';
+#     use MangleStub;
+#
+#     MangleStub::init();
+#     MangleStub::output({ double => MangleStub::get_data() * 2 });
+package MangleStub;
+
+use strict;
+use warnings;
+use JSON::PP;
+
+our $PROTOCOL_VERSION = <%.Version%>;
+
+my $json = JSON::PP->new->utf8->allow_nonref;
+my $stdout;
+my $request;
+my $versioned = 0;
+my $initialized = 0;
+my $outputs = 0;
+my $failed = 0;
+my $closed = 0;
+my @warnings;
+
+sub _write {
+    my ($message) = @_;
+    print {$stdout} $json->encode($message), "\n";
+    $stdout->flush;
+}
+
+sub _key {
+    return $request ? $request->{key} : undef;
+}
+
+sub _envelope {
+    my ($status, $data, $errors) = @_;
+    my @pending = @warnings;
+    @warnings = ();
+    return {
+        key            => _key(),
+        request_status => $status ? JSON::PP::true : JSON::PP::false,
+        data           => $data,
+        optionalOutput => $request ? $request->{optionalOutput} : undef,
+        isUnique       => $request ? $request->{isUnique} : undef,
+        errors         => $errors,
+        warnings       => \@pending,
+    };
+}
+
+# Read the request from stdin, call it before anything else
+sub init {
+    $initialized = 1;
+    # print goes to stderr from now on
+    open($stdout, '>&', \*STDOUT) or die "Can't keep stdout: $!";
+    open(STDOUT, '>&', \*STDERR) or die "Can't move stdout: $!";
+    my $line = <STDIN>;
+    $request = eval { $json->decode(defined $line ? $line : '') };
+    if (!defined $request || ref $request ne 'HASH') {
+        my $reason = $@ ? $@ : "not a JSON object\n";
+        $reason =~ s/ at \S+ line \d+\.?\n?\z//;
+        $request = undef;
+        fail("Invalid request: $reason");
+        return;
+    }
+    $versioned = exists $request->{version};
+    if ($versioned) {
+        _write({
+            key      => _key(),
+            channel  => "<%.Handshake%>",
+            version  => $PROTOCOL_VERSION,
+            library  => "<%.Library%>",
+            features => [<%list .Features%>],
+        });
+    }
+    my @unsupported = grep { exists $request->{$_} } (<%list .Unsupported%>);
+    push @unsupported, "<%.Chunk%>" if (defined $request->{channel} && $request->{channel} eq "<%.Chunk%>");
+    if (@unsupported) {
+        fail("Unsupported request (" . join(", ", @unsupported) . "), only plain JSON requests can be read");
+    }
+}
+
+# Get the request data, or one of its named fields
+sub get_data {
+    my ($name) = @_;
+    return undef if !$request || $failed;
+    return ($request->{fields} || {})->{$name} if defined $name;
+    return $request->{data};
+}
+
+# Get the metadata of the request
+sub get_meta {
+    return { %{ ($request && $request->{meta}) || {} } };
+}
+
+# Send an output, only once unless the request isn't unique
+sub output {
+    my ($value) = @_;
+    if (!$initialized) {
+        $stdout = \*STDOUT;
+        _write(_envelope(0, undef, ["Error: OutputManager isn't initialized."]));
+        return;
+    }
+    return if $failed;
+    my @errors;
+    if ($outputs > 0 && $request->{isUnique}) {
+        push @errors, "Error: outputs out of bound (isUnique: true).";
+        $failed = 1;
+    }
+    _write(_envelope(!@errors, $value, \@errors));
+    $outputs++;
+}
+
+# Report the progress (0-100) of a long task, it isn't an output
+sub progress {
+    my ($percent, $message) = @_;
+    return if !$versioned;
+    _write({ key => _key(), channel => "<%.Progress%>", percent => $percent, message => defined $message ? $message : "" });
+}
+
+# Report a warning without failing the request
+sub warn {
+    my ($message) = @_;
+    if ($versioned) {
+        _write({ key => _key(), channel => "<%.Warning%>", warning => "Warning: $message" });
+    } else {
+        push @warnings, "Warning: $message";
+    }
+}
+
+# Fail the request, the failure counts as its output
+sub fail {
+    my ($message) = @_;
+    return if $failed;
+    _write(_envelope(0, undef, ["Error: $message"]));
+    $outputs++;
+    $failed = 1;
+}
+
+# End the request, called at exit
+sub cleanup {
+    return if $closed || !$initialized;
+    $closed = 1;
+    fail("the target ended without output.") if ($request && $outputs == 0 && !$request->{optionalOutput});
+    if ($versioned) {
+        _write({ key => _key(), channel => "<%.Done%>", request_status => $failed ? JSON::PP::false : JSON::PP::true });
+    }
+}
+
+END { cleanup() }
+
+1;
+`
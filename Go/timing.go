@@ -0,0 +1,43 @@
+package main
+
+import "time"
+
+// Timing splits the duration of a request by phase
+//
+// A phase the request didn't reach stays zero.
+//
+// Fields:
+//
+//	Prepare: Command resolution and request encoding
+//	Spawn: Starting the target (process start, connection, ...)
+//	Write: Sending the request and its files
+//	Exec: From the request sent to the target ended, outputs included
+//	Parse: Building the response from the outputs
+type Timing struct {
+	Prepare time.Duration `json:"prepare"`
+	Spawn   time.Duration `json:"spawn"`
+	Write   time.Duration `json:"write"`
+	Exec    time.Duration `json:"exec"`
+	Parse   time.Duration `json:"parse"`
+}
+
+// Measures the phases of a request into a Timing
+type phaseClock struct {
+	phase *time.Duration
+	mark  time.Time
+}
+
+// Start timing the first phase
+func startPhases(timing *Timing, start time.Time) *phaseClock {
+	*timing = Timing{}
+	return &phaseClock{phase: &timing.Prepare, mark: start}
+}
+
+// End the current phase and start the next one (nil = none)
+func (c *phaseClock) next(phase *time.Duration) {
+	now := time.Now()
+	if c.phase != nil {
+		*c.phase += now.Sub(c.mark)
+	}
+	c.phase, c.mark = phase, now
+}
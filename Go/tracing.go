@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Span is the part of a tracing span used by InputManager
+//
+// Methods:
+//
+//	SetAttribute(key, value): Attach an attribute to the span
+//	RecordError(err): Mark the span as failed
+//	End(): Complete the span
+//	TraceParent(): W3C traceparent of the span ("00-<trace id>-<span id>-<flags>")
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+	TraceParent() string
+}
+
+// Tracer starts the spans of the requests
+//
+// The library has no dependency, wrap an OpenTelemetry tracer (or any
+// other) to plug it in: Start() calls tracer.Start(ctx, name) and the
+// Span wraps the returned span, its TraceParent() formats
+// span.SpanContext().
+//
+// Each request gets a "mangle.request" span, child of the context given
+// with WithTraceContext(), with one child span per phase: "mangle.start"
+// (target started), "mangle.write" (request and files sent),
+// "mangle.wait" (outputs received, target ended) and "mangle.parse"
+// (response built). Its trace context is sent to the target in the
+// envelope, see TraceCarrier().
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Tracer of InputManagers without their own, see SetTracer()
+var (
+	tracerMu      sync.RWMutex
+	defaultTracer Tracer
+)
+
+// SetTracer traces the requests of every InputManager
+//
+// Parameters:
+//
+//	tracer: Tracer starting the spans, nil stops tracing
+func SetTracer(tracer Tracer) {
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+	defaultTracer = tracer
+}
+
+// WithTracer traces the requests of an InputManager, replacing the tracer of SetTracer()
+//
+// Parameters:
+//
+//	tracer: Tracer starting the spans
+func WithTracer(tracer Tracer) Option {
+	return func(im *InputManager) {
+		im.tracer = tracer
+	}
+}
+
+// WithTraceContext makes the spans of the requests children of the span in ctx
+//
+// Parameters:
+//
+//	ctx: Context holding the parent span (e.g. the one of an HTTP handler)
+func WithTraceContext(ctx context.Context) Option {
+	return func(im *InputManager) {
+		im.traceCtx = ctx
+	}
+}
+
+// Spans of one request, nil when it isn't traced
+type requestTrace struct {
+	tracer Tracer
+	ctx    context.Context
+	span   Span
+	phase  Span
+}
+
+// Start the span of a request
+func (im *InputManager) startTrace(language, file string) *requestTrace {
+	tracer := im.tracer
+	if tracer == nil {
+		tracerMu.RLock()
+		tracer = defaultTracer
+		tracerMu.RUnlock()
+	}
+	if tracer == nil {
+		return nil
+	}
+	ctx := im.traceCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracer.Start(ctx, "mangle.request")
+	span.SetAttribute("mangle.key", im.key)
+	span.SetAttribute("mangle.language", language)
+	span.SetAttribute("mangle.file", file)
+	if im.info.CorrelationID != "" {
+		span.SetAttribute("mangle.correlation_id", im.info.CorrelationID)
+	}
+	return &requestTrace{tracer: tracer, ctx: ctx, span: span}
+}
+
+// End the current phase and start the next one
+func (t *requestTrace) enter(name string) {
+	if t == nil {
+		return
+	}
+	if t.phase != nil {
+		t.phase.End()
+	}
+	_, t.phase = t.tracer.Start(t.ctx, name)
+}
+
+// End the request span, failed when the request failed
+func (t *requestTrace) end(im *InputManager) {
+	if t == nil {
+		return
+	}
+	err := im.err
+	if err == nil && im.Response.RequestStatusSet && !im.Response.RequestStatus && len(im.Response.Errors) > 0 {
+		err = errors.New(im.Response.Errors[0])
+	}
+	if t.phase != nil {
+		if err != nil {
+			t.phase.RecordError(err)
+		}
+		t.phase.End()
+	}
+	if err != nil {
+		t.span.RecordError(err)
+	}
+	t.span.End()
+}
+
+// Get the W3C traceparent sent to the target, "" when there is none
+//
+// Untraced requests made by a target pass on the trace context it
+// received, so call chains stay in one trace.
+func (t *requestTrace) traceParent() string {
+	if t != nil {
+		return t.span.TraceParent()
+	}
+	if owner := globalOutputManager; owner != nil && !owner.closed {
+		return owner.traceParent
+	}
+	return ""
+}
+
+// Format of a W3C traceparent
+var traceParentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// ParseTraceParent splits a W3C traceparent
+//
+// Parameters:
+//
+//	traceParent: Value as returned in TraceCarrier()["traceparent"]
+//
+// Returns:
+//
+//	string: Trace ID (32 hex digits)
+//	string: Span ID of the parent span (16 hex digits)
+//	bool: Sampled flag
+//	error: Malformed traceparent
+func ParseTraceParent(traceParent string) (string, string, bool, error) {
+	match := traceParentPattern.FindStringSubmatch(traceParent)
+	if match == nil {
+		return "", "", false, fmt.Errorf("Malformed traceparent: %q", traceParent)
+	}
+	return match[1], match[2], match[3] == "01", nil
+}
+
+// TraceCarrier returns the trace context of the calling process
+//
+// The map holds the W3C "traceparent" of the request span of the calling
+// process (empty when the request isn't traced). It is what OpenTelemetry
+// propagators extract from: Extract(ctx, propagation.MapCarrier(carrier))
+// gives a context whose spans continue the trace of the caller.
+//
+// Returns:
+//
+//	map[string]string: W3C trace context headers
+func (om *OutputManager) TraceCarrier() map[string]string {
+	carrier := make(map[string]string)
+	if om != nil && om.traceParent != "" {
+		carrier["traceparent"] = om.traceParent
+	}
+	return carrier
+}
+
+// TraceCarrier calls TraceCarrier() on the OutputManager created by Init()
+func TraceCarrier() map[string]string {
+	return autoOutputManager().TraceCarrier()
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Target describes what a Transport connects to
+//
+// Fields:
+//
+//	Language: Target language/runtime as passed to Request()
+//	File: Path to target file as passed to Request()
+//	Command: Command array built from Language and File (empty for custom transports)
+//	Env: Extra environment variables of the target (KEY=value)
+//	Secrets: Secrets to pass out of band (see SendSecret()), transports that can't must fail
+type Target struct {
+	Language string
+	File     string
+	Command  []string
+	Env      []string
+	Secrets  map[string][]byte
+}
+
+// Transport carries protocol messages between an InputManager and its target
+//
+// Implement this interface to reach targets that are not local processes
+// (serial port, embedded device, remote service, ...).
+//
+// Methods:
+//
+//	Open(target): Connect to or start the target
+//	Send(message): Write one JSON message to the target
+//	Receive(): Read the next JSON message, returns io.EOF once the target is done
+//	Close(): Release resources and report how the target terminated
+type Transport interface {
+	Open(target Target) error
+	Send(message []byte) error
+	Receive() ([]byte, error)
+	Close() error
+}
+
+// SendCloser is implemented by transports that can signal the end of the
+// request stream while still receiving (e.g. closing a child's stdin)
+type SendCloser interface {
+	CloseSend() error
+}
+
+// StreamSender is implemented by transports that can forward raw bytes
+// after the request (see WithStdin())
+type StreamSender interface {
+	SendStream(r io.Reader) error
+}
+
+// Killer is implemented by transports that can stop the target right
+// away (see WithTimeout())
+type Killer interface {
+	Kill() error
+}
+
+// ExitError reports a target process that exited with a non-zero code
+//
+// Fields:
+//
+//	Code: Process exit code
+//	Stderr: Everything the process wrote to stderr
+type ExitError struct {
+	Code   int
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("Process exited with code %d", e.Code)
+}
+
+// Time given to the processes started by the target to release stderr
+// once it exited, its output after that is lost
+const processWaitDelay = time.Second
+
+// ProcessTransport runs the target as a child process and talks to it
+// through its stdin/stdout pipes
+//
+// This is the default transport used by InputManager.
+//
+// Fields:
+//
+//	Sandbox: Limits of the process (nil = none, see WithSandbox())
+//	User: User the process runs as ("" = current, see WithUser())
+//	Environ: Environment of the process (nil = the one of the calling process, see WithCleanEnv())
+//	TempHome: Give the process an empty read-only HOME (see WithTempHome())
+//	MaxReceive: Largest message read and stderr kept, in bytes (0 = no limit, see WithMaxResponseSize())
+//	OnStderr: Called with each chunk written to stderr, from another goroutine (nil = none, see WithHooks())
+//	OnWire: Called with each message written to stdin and each line read from stdout, line ends included (nil = none, see WithWireTrace())
+type ProcessTransport struct {
+	Sandbox    *Sandbox
+	User       string
+	Environ    []string
+	TempHome   bool
+	MaxReceive int64
+	OnStderr   func(chunk []byte)
+	OnWire     func(sent bool, raw []byte)
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	stdout     *bufio.Reader
+	stdoutPipe io.ReadCloser
+	stderr     bytes.Buffer
+	release    []func()
+	path       string
+}
+
+// NewProcessTransport creates a new ProcessTransport instance
+func NewProcessTransport() *ProcessTransport {
+	return &ProcessTransport{}
+}
+
+// Open starts the process described by target.Command
+func (t *ProcessTransport) Open(target Target) error {
+	if len(target.Command) == 0 {
+		return errors.New("Failed to start process: empty command")
+	}
+
+	t.cmd = exec.Command(target.Command[0], target.Command[1:]...)
+	t.path = t.cmd.Path
+	t.cmd.WaitDelay = processWaitDelay
+	t.cmd.Stderr = &t.stderr
+	if t.MaxReceive > 0 {
+		t.cmd.Stderr = &limitedBuffer{buf: &t.stderr, limit: t.MaxReceive}
+	}
+	if t.OnStderr != nil {
+		t.cmd.Stderr = io.MultiWriter(t.cmd.Stderr, stderrFunc(t.OnStderr))
+	}
+	// Lets the target initialize itself (see AutoInitEnv)
+	environ := t.Environ
+	if environ == nil {
+		environ = os.Environ()
+	}
+	t.cmd.Env = append(append(append([]string{}, environ...), AutoInitEnv+"=1"), target.Env...)
+	if t.User != "" {
+		account, err := lookupProcessUser(t.User)
+		if err == nil {
+			err = account.apply(t.cmd)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to start process: %s", err.Error())
+		}
+	}
+	if t.Sandbox != nil {
+		if err := t.Sandbox.prepare(t.cmd); err != nil {
+			return fmt.Errorf("Failed to start process: %s", err.Error())
+		}
+	}
+	if len(target.Secrets) > 0 {
+		secrets, err := secretPipe(target.Secrets)
+		if err != nil {
+			return fmt.Errorf("Failed to start process: %s", err.Error())
+		}
+		// The process has its own copy, this one is closed once it ended
+		t.release = append(t.release, func() { secrets.Close() })
+		t.cmd.Env = append(t.cmd.Env, SecretFDEnv+"="+inheritFile(t.cmd, secrets))
+	}
+
+	stdin, err := t.cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("Failed to start process: %s", err.Error())
+	}
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("Failed to start process: %s", err.Error())
+	}
+	var visible []string
+	if t.TempHome {
+		home, remove, err := createTempHome()
+		if err != nil {
+			return fmt.Errorf("Failed to start process: %s", err.Error())
+		}
+		t.cmd.Env = append(t.cmd.Env, home...)
+		t.release = append(t.release, remove)
+		visible = append(visible, strings.TrimPrefix(home[0], "HOME="))
+	}
+	// Last, the helper applying the sandbox is set up from the final
+	// command and environment
+	if t.Sandbox != nil {
+		remove, err := t.Sandbox.isolate(t.cmd, target.File, visible)
+		if err != nil {
+			t.releaseAll()
+			return fmt.Errorf("Failed to isolate process: %s", err.Error())
+		}
+		t.release = append(t.release, remove)
+	}
+
+	if err := t.cmd.Start(); err != nil {
+		t.releaseAll()
+		return fmt.Errorf("Failed to start process: %s", err.Error())
+	}
+	if t.Sandbox != nil {
+		release, err := t.Sandbox.started(t.cmd.Process)
+		if err != nil {
+			t.cmd.Process.Kill()
+			t.cmd.Wait()
+			t.releaseAll()
+			return fmt.Errorf("Failed to sandbox process: %s", err.Error())
+		}
+		t.release = append(t.release, release)
+	}
+
+	t.stdin = stdin
+	t.stdout = bufio.NewReader(stdout)
+	t.stdoutPipe = stdout
+	return nil
+}
+
+// Release what was set up for the process (Job Object, temp HOME, ...)
+func (t *ProcessTransport) releaseAll() {
+	for _, release := range t.release {
+		release()
+	}
+	t.release = nil
+}
+
+// Send writes a message followed by a newline to the process stdin
+func (t *ProcessTransport) Send(message []byte) error {
+	if t.OnWire != nil {
+		t.OnWire(true, append(append([]byte{}, message...), '\n'))
+	}
+	return writeLine(t.stdin, message)
+}
+
+// SendStream copies r to the process stdin until r ends
+func (t *ProcessTransport) SendStream(r io.Reader) error {
+	_, err := io.Copy(t.stdin, r)
+	return err
+}
+
+// Kill stops the process
+//
+// Its pipes are closed too: processes it started may still hold them,
+// pending reads and writes must not wait for those.
+func (t *ProcessTransport) Kill() error {
+	if t.cmd == nil || t.cmd.Process == nil {
+		return nil
+	}
+	err := t.cmd.Process.Kill()
+	t.stdin.Close()
+	t.stdoutPipe.Close()
+	return err
+}
+
+// Stderr returns everything the process wrote to stderr so far
+func (t *ProcessTransport) Stderr() string {
+	return t.stderr.String()
+}
+
+// CloseSend closes the process stdin so it sees the end of the request
+func (t *ProcessTransport) CloseSend() error {
+	return t.stdin.Close()
+}
+
+// Receive reads the next line written by the process on stdout
+//
+// Returns:
+//
+//	[]byte: Line without its end
+//	error: io.EOF once the process closed stdout, *SizeLimitError for a line larger than MaxReceive
+func (t *ProcessTransport) Receive() ([]byte, error) {
+	line, err := readLimitedLine(t.stdout, t.MaxReceive)
+	if len(line) > 0 {
+		if t.OnWire != nil {
+			t.OnWire(false, line)
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+	return nil, err
+}
+
+// Read the next line of r with its end, never buffering more than limit bytes (0 = no limit)
+func readLimitedLine(r *bufio.Reader, limit int64) ([]byte, error) {
+	var line []byte
+	for {
+		part, err := r.ReadSlice('\n')
+		line = append(line, part...)
+		if limit > 0 && int64(len(line)) > limit {
+			return nil, &SizeLimitError{Direction: "response", Limit: limit, Size: int64(len(line))}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if len(line) > 0 {
+			return line, nil
+		}
+		return nil, err
+	}
+}
+
+// Close waits for the process to exit
+//
+// Returns:
+//
+//	error: *ExitError if the process exited with a non-zero code
+func (t *ProcessTransport) Close() error {
+	if t.cmd == nil || t.cmd.Process == nil {
+		return nil
+	}
+
+	t.stdin.Close()
+	// Drain unread output so the process can't block on a full pipe
+	io.Copy(io.Discard, t.stdout)
+
+	err := t.cmd.Wait()
+	t.releaseAll()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &ExitError{Code: exitErr.ExitCode(), Stderr: t.stderr.String()}
+	}
+	return err
+}
+
+// Writer calling a function with each chunk
+type stderrFunc func(chunk []byte)
+
+func (f stderrFunc) Write(p []byte) (int, error) {
+	f(p)
+	return len(p), nil
+}
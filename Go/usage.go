@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// Usage is what the target process consumed, as reported by the OS
+//
+// Fields:
+//
+//	UserTime: CPU time spent in the process code
+//	SystemTime: CPU time spent in the kernel for the process
+//	MaxRSS: Peak resident memory in bytes (0 when the OS doesn't report it, e.g. Windows)
+type Usage struct {
+	UserTime   time.Duration `json:"user_time"`
+	SystemTime time.Duration `json:"system_time"`
+	MaxRSS     int64         `json:"max_rss,omitempty"`
+}
+
+// Get the usage of the process started by transport, nil without one
+func processUsage(transport Transport) *Usage {
+	cmd := transportProcess(transport)
+	if cmd == nil || cmd.ProcessState == nil {
+		return nil
+	}
+	return stateUsage(cmd.ProcessState)
+}
+
+// Get the usage of an ended process
+func stateUsage(state *os.ProcessState) *Usage {
+	return &Usage{
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		MaxRSS:     maxRSS(state),
+	}
+}
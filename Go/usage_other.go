@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// The peak memory isn't reported by Windows once the process ended
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
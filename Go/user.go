@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// WithUser runs targets started by the InputManager as another user (Unix)
+//
+// Lets a supervisor running as root start untrusted targets without its
+// privileges. The target gets the groups of the user and its HOME, USER
+// and LOGNAME. Applies to the default ProcessTransport, set
+// ProcessTransport.User for transports built by hand.
+//
+// Parameters:
+//
+//	name: User name, uid, or uid:gid (e.g. "nobody", "1000", "1000:1000")
+func WithUser(name string) Option {
+	return func(im *InputManager) {
+		im.user = name
+	}
+}
+
+// Ids and environment of the user a target runs as
+type processUser struct {
+	uid    uint32
+	gid    uint32
+	groups []uint32
+	env    []string
+}
+
+// Resolve a user given as a name, uid or uid:gid
+func lookupProcessUser(name string) (*processUser, error) {
+	spec, group, explicitGroup := strings.Cut(name, ":")
+	account, err := user.Lookup(spec)
+	if err != nil {
+		if account, err = user.LookupId(spec); err != nil {
+			// Numeric ids don't need an account
+			uid, convErr := strconv.ParseUint(spec, 10, 32)
+			if convErr != nil {
+				return nil, fmt.Errorf("Unknown user: %s", spec)
+			}
+			account = &user.User{Uid: strconv.FormatUint(uid, 10), Gid: strconv.FormatUint(uid, 10)}
+		}
+	}
+	if !explicitGroup {
+		group = account.Gid
+	}
+
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown user: %s", spec)
+	}
+	gid, err := strconv.ParseUint(group, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown group: %s", group)
+	}
+	result := &processUser{uid: uint32(uid), gid: uint32(gid)}
+	if account.Username != "" {
+		if ids, err := account.GroupIds(); err == nil {
+			for _, id := range ids {
+				if value, err := strconv.ParseUint(id, 10, 32); err == nil {
+					result.groups = append(result.groups, uint32(value))
+				}
+			}
+		}
+		result.env = []string{"HOME=" + account.HomeDir, "USER=" + account.Username, "LOGNAME=" + account.Username}
+	}
+	return result, nil
+}
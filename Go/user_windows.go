@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Windows can't start a process as another user without its password
+func (u *processUser) apply(cmd *exec.Cmd) error {
+	return errors.New("Running as another user is not supported on windows")
+}
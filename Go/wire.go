@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// WithWireTrace writes the bytes exchanged with the targets to w
+//
+// Unlike WithLogger() and WithDebug(), nothing is interpreted: each
+// message is written as it went over the transport, signature included,
+// Go-quoted so line ends, byte order marks and invalid UTF-8 show. One
+// line is written per message: the request key, its direction ("->"
+// sent, "<-" received) and the quoted bytes. Lines read by the default
+// ProcessTransport keep their end, other transports give them without it.
+//
+// Parameters:
+//
+//	w: Destination of the trace (shared by all requests, safe for concurrent use)
+//	redact: Replace the payloads ("data" and "fields") with "[redacted]"
+func WithWireTrace(w io.Writer, redact bool) Option {
+	trace := &wireTrace{w: w, redact: redact}
+	return func(im *InputManager) {
+		im.wire = trace
+	}
+}
+
+// Destination of a wire trace
+type wireTrace struct {
+	mu     sync.Mutex
+	w      io.Writer
+	redact bool
+}
+
+func (t *wireTrace) write(key string, sent bool, raw []byte) {
+	direction := "<-"
+	if sent {
+		direction = "->"
+	}
+	if t.redact {
+		raw = redactPayload(raw)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%s %s %q\n", key, direction, raw)
+}
+
+// Get the wire trace of the current request, nil when off
+func (im *InputManager) wireFunc() func(sent bool, raw []byte) {
+	if im.wire == nil {
+		return nil
+	}
+	trace, key := im.wire, im.key
+	return func(sent bool, raw []byte) {
+		trace.write(key, sent, raw)
+	}
+}
+
+// Trace each message written with send
+func tracedSend(wire func(sent bool, raw []byte), send func(message []byte) error) func(message []byte) error {
+	if wire == nil {
+		return send
+	}
+	return func(message []byte) error {
+		wire(true, message)
+		return send(message)
+	}
+}
+
+// Replace the payload fields of a JSON object, the other bytes are kept
+func redactPayload(raw []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return raw
+	}
+	var redacted []byte
+	last := 0
+	for dec.More() {
+		name, err := dec.Token()
+		if err != nil {
+			return raw
+		}
+		// The value starts after the colon following the name
+		start := int(dec.InputOffset())
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return raw
+		}
+		if name != "data" && name != "fields" {
+			continue
+		}
+		end := int(dec.InputOffset())
+		colon := bytes.IndexByte(raw[start:end], ':')
+		if colon < 0 {
+			return raw
+		}
+		redacted = append(redacted, raw[last:start+colon+1]...)
+		redacted = append(redacted, `"[redacted]"`...)
+		last = end
+	}
+	return append(redacted, raw[last:]...)
+}